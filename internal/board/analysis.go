@@ -0,0 +1,106 @@
+package board
+
+import (
+	"fmt"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+	"image"
+	"strconv"
+	"strings"
+	"us.figge.chess/internal/board/graphics"
+	. "us.figge.chess/internal/common"
+)
+
+const (
+	analysisScoreWidth = 56
+	analysisMargin     = 6
+)
+
+// ToggleAnalysis switches the engine analysing the position on the
+// board on or off, showing its best lines under the move list
+func (b *Board) ToggleAnalysis() {
+	b.engine.SetEngineAnalysis(!b.engine.IsEngineAnalysing())
+}
+
+// analysisHeight returns the height of the analysis panel, a heading
+// and a row for each line, or zero when analysis is off
+func (b *Board) analysisHeight() int {
+	if !b.engine.IsEngineAnalysing() {
+		return 0
+	}
+	return (b.engine.AnalysisLines() + 1) * moveRowHeight
+}
+
+// drawAnalysis draws the engine's lines across the bottom of the side
+// panel, above the lower clock: the depth and speed of the search,
+// then each line's score and its moves, cut off at the window's edge
+func (b *Board) drawAnalysis(screen *ebiten.Image) {
+	x, h := b.panelX, b.analysisHeight()
+	w := screen.Bounds().Dx() - x
+	if h == 0 || w <= 0 {
+		return
+	}
+	y := b.squareSize*8 + buttonHeight - h
+	if b.isTimed() {
+		y -= clockHeight
+	}
+	panel := screen.SubImage(image.Rect(x, y, x+w, y+h)).(*ebiten.Image)
+	vector.DrawFilledRect(panel, float32(x), float32(y), float32(w), float32(h), b.colors.Black(), false)
+	vector.DrawFilledRect(panel, float32(x), float32(y), float32(w), moveRowHeight, b.colors.Valid(), false)
+
+	lines, ok := b.engine.Analysis()
+	heading := "Analysis: waiting"
+	if ok && len(lines) > 0 {
+		heading = fmt.Sprintf("Depth %d  %s nodes  %s/s", lines[0].Depth, formatCount(lines[0].Nodes), formatCount(lines[0].NodesPerSecond))
+	} else if ok {
+		heading = "Analysis: searching"
+	}
+	graphics.TextAt(panel, heading, x+analysisMargin, y+2, moveFontSize, b.colors.PlayerWhite())
+	for i, line := range lines {
+		ly := y + (i+1)*moveRowHeight + 2
+		graphics.TextAt(panel, formatScore(line.Score, line.Mate), x+analysisMargin, ly, moveFontSize, b.colors.PlayerWhite())
+		pv := numberMoves(line.Moves, b.engine.Fullmove(), b.engine.Turn())
+		graphics.TextAt(panel, pv, x+analysisScoreWidth, ly, moveFontSize, b.colors.PlayerBlack())
+	}
+}
+
+// formatScore formats a score from white's point of view in pawns, or
+// as mate in moves
+func formatScore(score int, mate bool) string {
+	if mate {
+		return "#" + strconv.Itoa(score)
+	}
+	return fmt.Sprintf("%+.2f", float64(score)/100)
+}
+
+// formatCount shortens a count of nodes to thousands or millions
+func formatCount(n int) string {
+	switch {
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1_000_000)
+	case n >= 1_000:
+		return fmt.Sprintf("%.1fk", float64(n)/1_000)
+	}
+	return strconv.Itoa(n)
+}
+
+// numberMoves writes moves in SAN with their move numbers, starting
+// from the move and player to move given
+func numberMoves(moves []string, number int, player uint8) string {
+	var sb strings.Builder
+	for i, move := range moves {
+		switch {
+		case player == PlayerWhite:
+			_, _ = fmt.Fprintf(&sb, "%d. ", number)
+		case i == 0:
+			_, _ = fmt.Fprintf(&sb, "%d... ", number)
+		}
+		sb.WriteString(move)
+		sb.WriteByte(' ')
+		if player == PlayerBlack {
+			number++
+		}
+		player = 1 - player
+	}
+	return strings.TrimSpace(sb.String())
+}
@@ -0,0 +1,145 @@
+package board
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"slices"
+	"time"
+	"us.figge.chess/internal/board/graphics"
+	. "us.figge.chess/internal/common"
+	"us.figge.chess/internal/engine"
+)
+
+const defaultAnimation = 200 * time.Millisecond
+
+// sprite is a piece drawn over the board while a move is animated,
+// sliding from one point to another or fading out where it was taken
+type sprite struct {
+	piece        *graphics.Piece
+	fromX, fromY float64
+	toX, toY     float64
+	fade         bool
+}
+
+// animation is a move being shown. Its progress is measured by the
+// clock rather than in frames, so it takes as long at any frame rate
+type animation struct {
+	sprites  []sprite
+	hidden   []uint8 // squares left out of the foreground until it's done
+	started  time.Time
+	duration time.Duration
+}
+
+// progress returns how far through the animation is, from 0 to 1
+func (a *animation) progress() float64 {
+	return min(1, float64(time.Since(a.started))/float64(a.duration))
+}
+
+// animateMove slides the pieces of a move just played to their squares,
+// the rook as well as the king when castling, and fades out a piece it
+// took. A piece dropped by the mouse is already on its square
+func (b *Board) animateMove(move engine.Move, dropped bool) {
+	a := &animation{}
+	if captured, ok := b.capturedBy(move); ok {
+		a.sprites = append(a.sprites, b.newSprite(captured.piece, captured.index, captured.index, true))
+	}
+	from := move.From
+	if dropped {
+		from = move.To
+	}
+	a.sprites = append(a.sprites, b.newSprite(move.Piece, from, move.To, false))
+	a.hidden = append(a.hidden, move.To)
+	if move.Piece&PieceMask == PieceKing && (move.To == move.From+2 || move.From == move.To+2) {
+		rookFrom, rookTo := move.From+3, move.To-1
+		if move.To < move.From {
+			rookFrom, rookTo = move.From-4, move.To+1
+		}
+		a.sprites = append(a.sprites, b.newSprite(PieceRook|move.Piece&PlayerMask, rookFrom, rookTo, false))
+		a.hidden = append(a.hidden, rookTo)
+	}
+	b.startAnimation(a)
+}
+
+// animateSnapBack slides a piece dropped on a square it can't move to
+// back to the square it came from
+func (b *Board) animateSnapBack(from, to, pieceType uint8) {
+	b.startAnimation(&animation{
+		sprites: []sprite{b.newSprite(pieceType, to, from, false)},
+		hidden:  []uint8{from},
+	})
+}
+
+func (b *Board) startAnimation(a *animation) {
+	if b.animationDuration <= 0 {
+		return
+	}
+	a.started, a.duration = time.Now(), b.animationDuration
+	b.animation = a
+}
+
+// capturedPiece is a piece taken by a move, and the square it was on
+type capturedPiece struct {
+	piece uint8
+	index uint8
+}
+
+// capturedBy returns the piece a move takes, looked up in the position
+// shown before it was played, which may be a pawn taken en passant
+func (b *Board) capturedBy(move engine.Move) (capturedPiece, bool) {
+	if piece, ok := pieceOn(b.shown, move.To); ok && piece&PlayerMask != move.Piece&PlayerMask {
+		return capturedPiece{piece: piece, index: move.To}, true
+	}
+	if move.Piece&PieceMask == PiecePawn && move.From%8 != move.To%8 {
+		index := move.From/8*8 + move.To%8
+		if piece, ok := pieceOn(b.shown, index); ok {
+			return capturedPiece{piece: piece, index: index}, true
+		}
+	}
+	return capturedPiece{}, false
+}
+
+func (b *Board) newSprite(pieceType, from, to uint8, fade bool) sprite {
+	s := sprite{piece: graphics.GetPiece(pieceType), fade: fade}
+	s.fromX, s.fromY = b.squareXY(from)
+	s.toX, s.toY = b.squareXY(to)
+	return s
+}
+
+// squareXY returns the top left corner of a square on the screen
+func (b *Board) squareXY(index uint8) (float64, float64) {
+	rank, file := ItoRF(index)
+	x, y := RFtoXY(rank, file, b.squareSize, b.flipped)
+	return float64(x), float64(y)
+}
+
+// updateAnimation puts the pieces of a finished animation back into
+// the foreground
+func (b *Board) updateAnimation() {
+	if b.animation != nil && b.animation.progress() >= 1 {
+		b.animation = nil
+		b.generateForeground()
+	}
+}
+
+// isAnimating reports whether a square is left out of the foreground
+// while its piece is animated
+func (b *Board) isAnimating(index int) bool {
+	return b.animation != nil && slices.Contains(b.animation.hidden, uint8(index))
+}
+
+// drawAnimation draws the sprites where they are, easing out as they
+// reach their squares
+func (b *Board) drawAnimation(screen *ebiten.Image) {
+	if b.animation == nil {
+		return
+	}
+	t := b.animation.progress()
+	eased := 1 - (1-t)*(1-t)*(1-t)
+	for _, s := range b.animation.sprites {
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Translate(s.fromX+(s.toX-s.fromX)*eased, s.fromY+(s.toY-s.fromY)*eased)
+		if s.fade {
+			op.ColorScale.ScaleAlpha(float32(1 - t))
+		}
+		s.piece.Draw(screen, op)
+	}
+}
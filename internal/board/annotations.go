@@ -0,0 +1,106 @@
+package board
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"us.figge.chess/internal/board/highlighers"
+	. "us.figge.chess/internal/common"
+)
+
+// annotate draws the user's arrows and circles with the right mouse
+// button: dragging from one square to another toggles an arrow and
+// clicking a square toggles a circle. The colour is green, or red with
+// Shift, blue with Alt and yellow with both
+func (b *Board) annotate(x, y int) {
+	rank, file, onBoard := XYtoRF(x, y, b.squareSize, b.flipped)
+	index := RFtoI(rank, file)
+	switch {
+	case inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonRight):
+		b.annotating, b.annotateFrom = onBoard, index
+	case inpututil.IsMouseButtonJustReleased(ebiten.MouseButtonRight) && b.annotating:
+		b.annotating = false
+		switch {
+		case !onBoard:
+		case index == b.annotateFrom:
+			b.engine.ToggleCircle(index, annotationColour())
+		default:
+			b.engine.ToggleArrow(b.annotateFrom, index, annotationColour())
+		}
+	}
+	if b.annotating && onBoard {
+		b.annotationPreview.UpdateByIndex(b.annotateFrom, index, b.colors.Annotation(annotationColour()))
+	} else {
+		b.annotationPreview.Hide()
+	}
+}
+
+// annotationColour returns the PGN colour of the annotation the keys
+// held down choose
+func annotationColour() byte {
+	shift, alt := ebiten.IsKeyPressed(ebiten.KeyShift), ebiten.IsKeyPressed(ebiten.KeyAlt)
+	switch {
+	case shift && alt:
+		return 'Y'
+	case shift:
+		return 'R'
+	case alt:
+		return 'B'
+	}
+	return 'G'
+}
+
+// ClearAnnotations removes the user's arrows and circles from the
+// position on the board
+func (b *Board) ClearAnnotations() {
+	b.engine.ClearAnnotations()
+}
+
+// updateAnnotations shows the arrows and circles stored with the
+// position on the board
+func (b *Board) updateAnnotations() {
+	var arrows, circles []string
+	if b.editor == nil {
+		annotations := b.engine.Annotations()
+		arrows, circles = annotations.Arrows, annotations.Circles
+	}
+	shown := 0
+	for _, annotation := range arrows {
+		from, to, ok := uciSquares(annotation[1:])
+		if !ok {
+			continue
+		}
+		if shown == len(b.annotationArrows) {
+			b.annotationArrows = append(b.annotationArrows, highlighers.NewArrow(b, b.squareSize, nil))
+		}
+		b.annotationArrows[shown].UpdateByIndex(from, to, b.colors.Annotation(annotation[0]))
+		shown++
+	}
+	for _, arrow := range b.annotationArrows[shown:] {
+		arrow.Hide()
+	}
+	shown = 0
+	for _, annotation := range circles {
+		rank, file, ok := NtoRF(annotation[1:])
+		if !ok {
+			continue
+		}
+		if shown == len(b.annotationCircles) {
+			b.annotationCircles = append(b.annotationCircles, highlighers.NewCircle(b, b.squareSize, nil))
+		}
+		b.annotationCircles[shown].UpdateByIndex(RFtoI(rank, file), b.colors.Annotation(annotation[0]))
+		shown++
+	}
+	for _, circle := range b.annotationCircles[shown:] {
+		circle.Hide()
+	}
+}
+
+func (b *Board) drawAnnotations(screen *ebiten.Image) {
+	for _, circle := range b.annotationCircles {
+		circle.Draw(screen)
+	}
+	for _, arrow := range b.annotationArrows {
+		arrow.Draw(screen)
+	}
+	b.annotationPreview.Draw(screen)
+}
@@ -0,0 +1,81 @@
+package board
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"image/color"
+	"math"
+	"us.figge.chess/internal/board/highlighers"
+	. "us.figge.chess/internal/common"
+	"us.figge.chess/internal/engine"
+)
+
+// arrowFade is the share of the opacity kept by the arrow of each move
+// following the best move
+const arrowFade = .6
+
+// updateArrows points the arrows at the moves the engine suggests in
+// the position on the board, in the order they are drawn so that the
+// best move goes over the rest
+func (b *Board) updateArrows() {
+	var lines []engine.AnalysisLine
+	if b.arrowsEnabled && b.editor == nil {
+		lines, _ = b.engine.Analysis()
+	}
+	shown := 0
+	add := func(move string, clr color.Color) {
+		from, to, ok := uciSquares(move)
+		if !ok {
+			return
+		}
+		if shown == len(b.arrows) {
+			b.arrows = append(b.arrows, highlighers.NewArrow(b, b.squareSize, clr))
+		}
+		b.arrows[shown].UpdateByIndex(from, to, clr)
+		shown++
+	}
+	for i := 1; i < len(lines); i++ {
+		if len(lines[i].UCI) > 0 {
+			add(lines[i].UCI[0], b.colors.OtherMove())
+		}
+	}
+	if len(lines) > 0 && len(lines[0].UCI) > 0 {
+		best := lines[0].UCI
+		for i := min(len(best)-1, b.followingMoves); i > 0; i-- {
+			add(best[i], fadeColor(b.colors.BestMove(), math.Pow(arrowFade, float64(i))))
+		}
+		add(best[0], b.colors.BestMove())
+	}
+	for _, arrow := range b.arrows[shown:] {
+		arrow.Hide()
+	}
+}
+
+func (b *Board) drawArrows(screen *ebiten.Image) {
+	for _, arrow := range b.arrows {
+		arrow.Draw(screen)
+	}
+}
+
+// uciSquares returns the squares a move in UCI long algebraic notation
+// moves from and to
+func uciSquares(move string) (uint8, uint8, bool) {
+	if len(move) < 4 {
+		return 0, 0, false
+	}
+	fromRank, fromFile, ok := NtoRF(move[:2])
+	if !ok {
+		return 0, 0, false
+	}
+	toRank, toFile, ok := NtoRF(move[2:4])
+	if !ok {
+		return 0, 0, false
+	}
+	return RFtoI(fromRank, fromFile), RFtoI(toRank, toFile), true
+}
+
+// fadeColor returns a colour with its opacity scaled down
+func fadeColor(clr color.Color, opacity float64) color.Color {
+	c := color.NRGBAModel.Convert(clr).(color.NRGBA)
+	c.A = uint8(float64(c.A) * opacity)
+	return c
+}
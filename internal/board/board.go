@@ -1,27 +1,34 @@
 package board
 
 import (
+	"errors"
 	"fmt"
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/hajimehoshi/ebiten/v2/vector"
 	"image/color"
+	"log"
 	"strconv"
+	"time"
 	"us.figge.chess/internal/board/colors"
 	"us.figge.chess/internal/board/graphics"
 	"us.figge.chess/internal/board/highlighers"
 	. "us.figge.chess/internal/common"
 	"us.figge.chess/internal/engine"
+	"us.figge.chess/internal/pgn"
 )
 
 const (
-	debugHeight = 16
+	debugHeight   = 16
+	messageHeight = 20
 )
 
 type Board struct {
 	colors     *colors.Colors
 	engine     *engine.Engine
 	squareSize int
+	flipped    bool
 
 	// Graphics elements
 	canvas        *ebiten.Image
@@ -36,6 +43,7 @@ type Board struct {
 	labelFontSize float64
 
 	// Highlighting
+	shown       []uint64
 	redraw      bool
 	regenerate  bool
 	rehighlight bool
@@ -44,6 +52,45 @@ type Board struct {
 	enPassant   *highlighers.EnPassant
 	validMoves  []*highlighers.ValidMove
 	lastMove    []*highlighers.Highlight
+	cursor      *highlighers.Highlight
+
+	// Engine suggestions
+	arrows         []*highlighers.Arrow
+	arrowsEnabled  bool
+	followingMoves int
+
+	// User annotations
+	annotationArrows  []*highlighers.Arrow
+	annotationCircles []*highlighers.Circle
+	annotationPreview *highlighers.Arrow
+	annotating        bool
+	annotateFrom      uint8
+
+	// Hints and threats
+	probe       *shownProbe
+	hint        [2]*highlighers.Highlight
+	threatArrow *highlighers.Arrow
+
+	// Animation
+	animation         *animation
+	animationDuration time.Duration
+
+	// Controls
+	navigation    []*button
+	moves         *moveList
+	moveListWidth int
+	evalBar       *evalBar
+	panelX        int
+
+	// Editing
+	editor       *positionEditor
+	text         *textEntry
+	prompt       *textEntry
+	windowHeight int
+
+	// Status
+	message string
+	pgnDir  string
 
 	// Debugging
 	debugEnabled bool
@@ -55,9 +102,12 @@ type Board struct {
 
 func NewBoard(engine *engine.Engine, options ...Option) *Board {
 	b := &Board{
-		colors:     colors.NewColors(),
-		engine:     engine,
-		squareSize: 71,
+		colors:            colors.NewColors(),
+		engine:            engine,
+		squareSize:        71,
+		pgnDir:            ".",
+		animationDuration: defaultAnimation,
+		arrowsEnabled:     true,
 	}
 	for _, option := range options {
 		option(b)
@@ -88,16 +138,37 @@ func (b *Board) Initialize() {
 		highlighers.NewHighlight(b, b.squareSize, b.colors.Tints(b.colors.LastMove())),
 		highlighers.NewHighlight(b, b.squareSize, b.colors.Tints(b.colors.LastMove())),
 	)
+	b.cursor = highlighers.NewHighlight(b, b.squareSize, b.colors.Tints(b.colors.Cursor()))
+	b.annotationPreview = highlighers.NewArrow(b, b.squareSize, b.colors.Annotation('G'))
+	for i := range b.hint {
+		b.hint[i] = highlighers.NewHighlight(b, b.squareSize, b.colors.Tints(b.colors.Hint()))
+	}
+	b.threatArrow = highlighers.NewArrow(b, b.squareSize, b.colors.Threat())
+
+	white, black := b.engine.Player(PlayerWhite), b.engine.Player(PlayerBlack)
+	b.flipped = black.IsHuman() && !white.IsHuman()
 
+	b.layoutNavigation()
+	b.panelX = b.squareSize * 8
+	if b.evalBar != nil {
+		b.panelX += evalBarWidth
+	}
+	b.moves = newMoveList(b.panelX)
+	if b.moveListWidth == 0 {
+		b.moveListWidth = b.squareSize * 3
+	}
 	for i := range 8 {
-		b.debugY = b.squareSize*8 + 1
+		b.debugY = b.squareSize*8 + buttonHeight + 1
 		b.debugX[i] = b.squareSize*i + 1
 	}
-	height := b.squareSize * 8
+	height := b.squareSize*8 + buttonHeight
 	if b.debugEnabled {
 		height += debugHeight + 2
 	}
-	ebiten.SetWindowSize(b.squareSize*8, height)
+	b.windowHeight = height
+	ebiten.SetWindowSize(b.panelX+max(minMoveList, b.moveListWidth), height)
+	ebiten.SetWindowSizeLimits(b.panelX+minMoveList, height, -1, height)
+	ebiten.SetWindowResizingMode(ebiten.WindowResizingModeEnabled)
 
 	b.generateBackground()
 }
@@ -105,16 +176,68 @@ func (b *Board) Initialize() {
 func (b *Board) Update() error {
 	x, y := ebiten.CursorPosition()
 	b.lastCursorX, b.lastCursorY = x-1, y-2
-	b.rehighlight = b.rehighlight || b.selector.Update(b.lastCursorX, b.lastCursorY)
+	if b.text != nil {
+		b.updateText()
+		return nil
+	}
+	if b.editor != nil {
+		b.updateEditor(b.lastCursorX, b.lastCursorY)
+		return nil
+	}
+	if b.prompt != nil {
+		b.updatePrompt()
+	} else {
+		b.updateMoves(b.lastCursorX, b.lastCursorY)
+		if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+			if btn := buttonAt(b.navigation, b.lastCursorX, b.lastCursorY); btn != nil && btn.action != nil {
+				btn.action()
+			}
+		}
+		b.rehighlight = b.rehighlight || b.selector.Update(b.lastCursorX, b.lastCursorY)
+		b.annotate(b.lastCursorX, b.lastCursorY)
+	}
+
+	b.updateAnimation()
+	b.updateEvalBar()
+	b.updateArrows()
+	b.updateAnnotations()
+	b.updateProbe()
+	played, err := b.engine.Update()
+	if err != nil {
+		b.ShowMessage(err.Error())
+		if errors.Is(err, engine.ErrOutOfTime) || errors.Is(err, engine.ErrGameOver) {
+			b.selector.Deselect()
+			b.gameOver()
+		}
+	} else if played != nil {
+		b.ShowMessage("")
+		b.animateMove(played.Move, false)
+		b.movePlayed()
+		b.generateForeground()
+	}
 	return nil
 }
 
+// SaveGame writes the game played so far to the PGN directory
+func (b *Board) SaveGame() {
+	path, err := b.engine.SavePGN(b.pgnDir)
+	if err != nil {
+		b.ShowMessage(err.Error())
+		return
+	}
+	b.ShowMessage("Game saved to " + path)
+}
+
 func (b *Board) Draw(screen *ebiten.Image) {
 	if b.rehighlight || b.redraw {
 		b.highlights.Clear()
 		for i := range b.lastMove {
 			b.lastMove[i].Draw(b.highlights)
 		}
+		b.cursor.Draw(b.highlights)
+		for i := range b.hint {
+			b.hint[i].Draw(b.highlights)
+		}
 		b.selector.Draw(b.highlights)
 		b.enPassant.Draw(b.highlights)
 		for i := range b.validMoves {
@@ -135,36 +258,72 @@ func (b *Board) Draw(screen *ebiten.Image) {
 		b.redraw = false
 	}
 	screen.DrawImage(b.canvas, nil)
+	b.drawAnimation(screen)
+	b.drawArrows(screen)
+	b.drawAnnotations(screen)
+	b.threatArrow.Draw(screen)
+	b.drawButtons(screen, b.navigation)
+	b.drawEvalBar(screen)
 	if b.selector.IsDragging() {
 		b.selector.DrawDrag(screen)
 	}
+	if b.editor != nil {
+		b.drawEditor(screen)
+	} else {
+		b.drawMoves(screen)
+		b.drawAnalysis(screen)
+		b.drawClocks(screen)
+	}
+	if b.prompt != nil {
+		b.drawPrompt(screen)
+	}
+	if b.text != nil {
+		b.drawText(screen)
+	}
+	if b.message != "" {
+		s := float32(b.squareSize * 8)
+		vector.DrawFilledRect(screen, 0, 0, s, messageHeight, b.colors.Invalid(), false)
+		ebitenutil.DebugPrintAt(screen, b.message, 4, 2)
+	}
 	if b.debugEnabled {
 		s := float32(b.squareSize * 8)
-		vector.DrawFilledRect(screen, 0, s, s, float32(b.debugY), b.colors.Black(), false)
+		vector.DrawFilledRect(screen, 0, float32(b.debugY-1), s, debugHeight+2, b.colors.Black(), false)
 		if b.selector != nil {
 			b.selector.Debug(screen, b.debugX, b.debugY)
 		}
-		ebitenutil.DebugPrintAt(screen, fmt.Sprintf("Turn: "+graphics.TurnName(b.engine.Turn())), b.debugX[5], b.debugY)
+		ebitenutil.DebugPrintAt(screen, "Turn: "+graphics.TurnName(b.engine.Turn()), b.debugX[5], b.debugY)
 		ebitenutil.DebugPrintAt(screen, fmt.Sprintf("X,Y:%d,%d", b.lastCursorX, b.lastCursorY), b.debugX[6], b.debugY)
 		ebitenutil.DebugPrintAt(screen, fmt.Sprintf("  TPS: %0.0f", ebiten.ActualTPS()), b.debugX[7], b.debugY)
 	}
 }
 
 func (b *Board) Setup(fen string) {
-	b.engine.SetFEN(fen)
+	if err := b.engine.SetFEN(fen); err != nil {
+		b.ShowMessage(err.Error())
+	}
 	b.generateForeground()
 }
 
+// ShowMessage displays a message across the top of the board until
+// it is replaced or cleared with an empty message
+func (b *Board) ShowMessage(message string) {
+	if message != "" {
+		log.Println(message)
+	}
+	b.message = message
+	b.redraw = true
+}
+
 func (b *Board) GetPieceType(rank, file uint8) (uint8, bool) {
 	return b.engine.GetPieceType(rank, file)
 }
 
 func (b *Board) DragBegin(index, pieceType uint8) bool {
-	if pieceType&PlayerMask != b.engine.Turn() {
+	if pieceType&PlayerMask != b.engine.Turn() || !b.engine.IsHumanTurn() {
 		return false
 	}
 	rank, file := ItoRF(index)
-	b.dragStart.Update(RFtoXY(rank, file, b.squareSize))
+	b.dragStart.Update(RFtoXY(rank, file, b.squareSize, b.flipped))
 	b.updateValidMoves(index, pieceType)
 	b.generateForeground()
 	return true
@@ -175,31 +334,200 @@ func (b *Board) DragOver(index, pieceType uint8) {
 	b.rehighlight = true
 }
 
+// DragSelect leaves a piece dropped where it was picked up selected,
+// showing its moves until a square is clicked
+func (b *Board) DragSelect(_, _ uint8) {
+	b.rehighlight = true
+	b.generateForeground()
+}
+
 func (b *Board) DragEnd(from, to, pieceType uint8, cancelled bool) {
 	b.dragStart.Hide()
 	b.rehighlight = true
 	b.validMoves = nil
 	if !cancelled {
-		msg, ok := b.engine.MovePiece(from, to, pieceType)
-		if ok {
-			fmt.Printf("%03d.  %-7s", b.engine.Fullmove(), msg)
-			if epi, ok := b.engine.GetEnPassant(); ok {
-				b.enPassant.UpdateByIndex(epi)
-			} else {
-				b.enPassant.Hide()
-			}
-			b.lastMove[0].UpdateByIndex(from)
-			b.lastMove[1].UpdateByIndex(to)
-			if engineMove, ok := b.engine.FetchMove(from, to); ok {
-				fmt.Printf("  %s\n", engineMove)
-			} else {
-				fmt.Println()
-			}
+		if _, ok := b.engine.MovePiece(from, to, pieceType); ok {
+			move, _ := b.engine.LastMove()
+			b.animateMove(move, b.selector.Dropped())
+			b.movePlayed()
+		} else if b.selector.Dropped() {
+			b.animateSnapBack(from, to, pieceType)
 		}
 	}
 	b.generateForeground()
 }
 
+// LoadGame shows the starting position of a game to step through
+func (b *Board) LoadGame(g *pgn.Game) {
+	if err := b.engine.LoadGame(g); err != nil {
+		b.ShowMessage(err.Error())
+		return
+	}
+	b.positionChanged()
+}
+
+// Step moves through the game by a number of moves, backwards
+// when negative
+func (b *Board) Step(moves int) {
+	if b.selector.IsDragging() {
+		return
+	}
+	ply, _ := b.engine.Ply()
+	b.engine.GotoPly(ply + moves)
+	b.positionChanged()
+}
+
+// Takeback takes back the last move a human made, along with the
+// moves replied to it
+func (b *Board) Takeback() {
+	if b.selector.IsDragging() || !b.engine.Takeback() {
+		return
+	}
+	b.positionChanged()
+}
+
+// Redo plays forward the moves taken back, up to the next move a
+// human is to make
+func (b *Board) Redo() {
+	if b.selector.IsDragging() || !b.engine.Redo() {
+		return
+	}
+	b.positionChanged()
+}
+
+// PromoteVariation moves the variation the position is on one place up,
+// making it the mainline of the game when it is first
+func (b *Board) PromoteVariation() {
+	if !b.engine.PromoteVariation() {
+		b.ShowMessage("Already the mainline")
+	}
+}
+
+// DeleteFromHere removes the move that reached the position, and the
+// moves after it, going back to the position before it
+func (b *Board) DeleteFromHere() {
+	if b.selector.IsDragging() || !b.engine.DeleteFromHere() {
+		return
+	}
+	b.positionChanged()
+}
+
+// IsFlipped reports whether the board is turned to show black at the
+// bottom
+func (b *Board) IsFlipped() bool {
+	return b.flipped
+}
+
+// Flip turns the board around
+func (b *Board) Flip() {
+	if b.selector.IsDragging() || b.editor != nil && b.editor.dragging {
+		return
+	}
+	b.setFlipped(!b.flipped)
+}
+
+// PlayAs starts a new game with the human playing the side given,
+// shown at the bottom of the board. A computer playing White makes
+// the first move
+func (b *Board) PlayAs(player uint8) {
+	if b.selector.IsDragging() || b.editor != nil {
+		return
+	}
+	b.engine.PlayAs(player)
+	b.setFlipped(player == PlayerBlack)
+	b.ShowMessage("New game as " + graphics.TurnName(player))
+}
+
+// setFlipped turns the board to show a side at the bottom, and redraws
+// the squares, labels, pieces and highlights where they now are
+func (b *Board) setFlipped(flipped bool) {
+	b.flipped = flipped
+	b.generateBackground()
+	if b.editor != nil {
+		b.editChanged()
+		return
+	}
+	b.positionChanged()
+}
+
+// layoutNavigation places the buttons that step through the game
+// under the board
+func (b *Board) layoutNavigation() {
+	label := func(text string) func() string {
+		return func() string { return text }
+	}
+	b.navigation = layoutButtons(0, b.squareSize*8, b.squareSize*8, [][]*button{{
+		{label: label("|<"), action: func() {
+			ply, _ := b.engine.Ply()
+			b.Step(-ply)
+		}},
+		{label: label("<"), action: func() { b.Step(-1) }},
+		{label: label("Undo"), action: b.Takeback},
+		{label: label("Redo"), action: b.Redo},
+		{label: label(">"), action: func() { b.Step(1) }},
+		{label: label(">|"), action: func() {
+			ply, end := b.engine.Ply()
+			b.Step(end - ply)
+		}},
+		{label: label("Flip"), action: b.Flip},
+	}})
+}
+
+// positionChanged shows the position the game has been moved to
+func (b *Board) positionChanged() {
+	b.selector.Deselect()
+	b.animation = nil
+	b.ShowMessage("")
+	b.highlightPosition()
+	b.generateForeground()
+}
+
+// highlightPosition highlights the move that reached the position
+// on the board and any en passant square
+func (b *Board) highlightPosition() {
+	if epi, ok := b.engine.GetEnPassant(); ok {
+		b.enPassant.UpdateByIndex(epi)
+	} else {
+		b.enPassant.Hide()
+	}
+	if move, ok := b.engine.LastMove(); ok {
+		b.lastMove[0].UpdateByIndex(move.From)
+		b.lastMove[1].UpdateByIndex(move.To)
+	} else {
+		b.lastMove[0].Hide()
+		b.lastMove[1].Hide()
+	}
+	if b.cursor.IsVisible() {
+		b.cursor.UpdateByIndex(b.cursor.Index())
+	}
+	for _, hint := range b.hint {
+		if hint.IsVisible() {
+			hint.UpdateByIndex(hint.Index())
+		}
+	}
+	b.rehighlight = true
+}
+
+// movePlayed highlights a move played by either side, and ends the
+// game when it's over
+func (b *Board) movePlayed() {
+	b.highlightPosition()
+	if b.engine.PositionResult() != pgn.ResultOngoing {
+		b.gameOver()
+	}
+}
+
+// gameOver logs the result of a game that has ended, with the rule it
+// was drawn by, and saves it
+func (b *Board) gameOver() {
+	if reason := b.engine.DrawReason(); reason != "" {
+		log.Printf("Game over: %s (%s)", b.engine.PositionResult(), reason)
+	} else {
+		log.Printf("Game over: %s", b.engine.PositionResult())
+	}
+	b.SaveGame()
+}
+
 func (b *Board) updateValidMoves(index, pieceType uint8) {
 	b.validMoves = nil
 	rank, file := ItoRF(index)
@@ -212,63 +540,79 @@ func (b *Board) updateValidMoves(index, pieceType uint8) {
 
 func (b *Board) generateForeground() {
 	dragIndex := -1
-	if b.selector.IsDragging() {
+	bitBoards := b.engine.GetBoards()
+	switch {
+	case b.editor != nil:
+		dragIndex = b.editor.dragIndex()
+		bitBoards = b.editor.Boards()
+	case b.selector.IsDragging():
 		dragIndex = int(b.selector.DragIndex())
 	}
+	b.shown = bitBoards
 	b.foreground.Clear()
-	bitBoards := b.engine.GetBoards()
-bit:
 	for i := range 64 {
-		if i == dragIndex {
+		if i == dragIndex || b.isAnimating(i) {
 			continue
 		}
-		bit := uint64(1 << (63 - i))
-		player := PlayerWhite
-		if bitBoards[BitBlack]&bit != 0 {
-			player = PlayerBlack
+		if pieceType, ok := pieceOn(bitBoards, uint8(i)); ok {
+			graphics.GetPiece(pieceType).Draw(b.foreground, b.foregroundOp[i])
 		}
-		var piece *graphics.Piece
-		switch {
-		case bitBoards[BitPawns]&bit != 0:
-			piece = graphics.GetPiece(PiecePawn | player)
-		case bitBoards[BitKnights]&bit != 0:
-			piece = graphics.GetPiece(PieceKnight | player)
-		case bitBoards[BitBishops]&bit != 0:
-			piece = graphics.GetPiece(PieceBishop | player)
-		case bitBoards[BitRooks]&bit != 0:
-			piece = graphics.GetPiece(PieceRook | player)
-		case bitBoards[BitQueens]&bit != 0:
-			piece = graphics.GetPiece(PieceQueen | player)
-		case bitBoards[BitKings]&bit != 0:
-			piece = graphics.GetPiece(PieceKing | player)
-		default:
-			continue bit
-		}
-		piece.Draw(b.foreground, b.foregroundOp[i])
 	}
 	b.regenerate = false
 	b.redraw = true
 }
 
+// pieceOn returns the piece type on a square of a position's bitboards
+func pieceOn(bitBoards []uint64, index uint8) (uint8, bool) {
+	bit := ItoB(index)
+	player := PlayerWhite
+	if bitBoards[BitBlack]&bit != 0 {
+		player = PlayerBlack
+	}
+	switch {
+	case bitBoards[BitPawns]&bit != 0:
+		return PiecePawn | player, true
+	case bitBoards[BitKnights]&bit != 0:
+		return PieceKnight | player, true
+	case bitBoards[BitBishops]&bit != 0:
+		return PieceBishop | player, true
+	case bitBoards[BitRooks]&bit != 0:
+		return PieceRook | player, true
+	case bitBoards[BitQueens]&bit != 0:
+		return PieceQueen | player, true
+	case bitBoards[BitKings]&bit != 0:
+		return PieceKing | player, true
+	}
+	return 0, false
+}
+
 func (b *Board) generateBackground() {
 	s := float32(b.squareSize)
 	oddEven := 0
 	clr := []color.Color{b.colors.PlayerWhite(), b.colors.PlayerBlack()}
 
 	w, _ := graphics.TextSize("8", b.labelFontSize-2)
+	b.labelingX.Clear()
+	b.labelingY.Clear()
 	for i := range 8 {
 		for j := range 8 {
 			index := i*8 + j
+			rank, file := ItoRF(uint8(index))
+			x, y := RFtoXY(rank, file, b.squareSize, b.flipped)
 			op := ebiten.DrawImageOptions{}
-			op.GeoM.Translate(float64(j*b.squareSize), float64(i*b.squareSize))
+			op.GeoM.Translate(float64(x), float64(y))
 			b.foregroundOp[index] = &op
 			vector.DrawFilledRect(b.background, float32(i)*s, float32(j)*s, s, s, clr[oddEven], false)
 			oddEven = 1 - oddEven
 		}
-		wp, _ := graphics.TextSize(strconv.Itoa(i+1), b.labelFontSize-2)
+		file, rank := i, i+1
+		if b.flipped {
+			file, rank = 7-i, 8-i
+		}
+		wp, _ := graphics.TextSize(strconv.Itoa(rank), b.labelFontSize-2)
 
-		graphics.TextAt(b.labelingX, string([]byte{byte('A' + i)}), (i+1)*b.squareSize-int(w*1.5), 0, b.labelFontSize, clr[oddEven])
-		graphics.TextAt(b.labelingY, strconv.Itoa(i+1), int((w-wp)/2), (7-i)*b.squareSize, b.labelFontSize, clr[oddEven])
+		graphics.TextAt(b.labelingX, string([]byte{byte('A' + file)}), (i+1)*b.squareSize-int(w*1.5), 0, b.labelFontSize, clr[oddEven])
+		graphics.TextAt(b.labelingY, strconv.Itoa(rank), int((w-wp)/2), (7-i)*b.squareSize, b.labelFontSize, clr[oddEven])
 		oddEven = 1 - oddEven
 	}
 }
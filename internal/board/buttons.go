@@ -0,0 +1,58 @@
+package board
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const buttonHeight = 20
+
+// button is a control drawn beside the board. Buttons without an
+// action are labels, and those that can be on are shown lit when on
+type button struct {
+	x, y, w, h int
+	label      func() string
+	on         func() bool
+	action     func()
+}
+
+// layoutButtons places rows of buttons one under another, starting at
+// x, y, with the buttons of each row sharing its width
+func layoutButtons(x, y, width int, rows [][]*button) []*button {
+	var buttons []*button
+	for _, row := range rows {
+		w := width / len(row)
+		for i, btn := range row {
+			btn.x, btn.y, btn.w, btn.h = x+i*w, y, w, buttonHeight
+			buttons = append(buttons, btn)
+		}
+		y += buttonHeight
+	}
+	return buttons
+}
+
+// buttonAt returns the button at a point on the screen, if any
+func buttonAt(buttons []*button, x, y int) *button {
+	for _, btn := range buttons {
+		if x >= btn.x && x < btn.x+btn.w && y >= btn.y && y < btn.y+btn.h {
+			return btn
+		}
+	}
+	return nil
+}
+
+func (b *Board) drawButtons(screen *ebiten.Image, buttons []*button) {
+	for _, btn := range buttons {
+		clr := b.colors.Black()
+		switch {
+		case btn.on != nil && btn.on():
+			clr = b.colors.Valid()
+		case btn.action != nil:
+			clr = b.colors.PlayerBlack()
+		}
+		vector.DrawFilledRect(screen, float32(btn.x+1), float32(btn.y+1), float32(btn.w-2), float32(btn.h-2), clr, false)
+		label := btn.label()
+		ebitenutil.DebugPrintAt(screen, label, btn.x+(btn.w-len(label)*charWidth)/2, btn.y+2)
+	}
+}
@@ -0,0 +1,58 @@
+package board
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+	"image/color"
+	"time"
+	"us.figge.chess/internal/board/graphics"
+	. "us.figge.chess/internal/common"
+	"us.figge.chess/internal/game/clock"
+)
+
+const (
+	clockHeight   = 32
+	clockFontSize = 22
+	clockMargin   = 8
+)
+
+// isTimed reports whether the game has clocks to show beside the board
+func (b *Board) isTimed() bool {
+	return b.engine.Clock().IsTimed()
+}
+
+// drawClocks draws the clock of the player at the top of the board above
+// the move list, and the other below it. The clock of the player to
+// move is lit, and one that has run out turns red
+func (b *Board) drawClocks(screen *ebiten.Image) {
+	c := b.engine.Clock()
+	x := b.panelX
+	w := screen.Bounds().Dx() - x
+	if !c.IsTimed() || w <= 0 {
+		return
+	}
+	top := PlayerBlack
+	if b.flipped {
+		top = PlayerWhite
+	}
+	left := [2]time.Duration{c.WhiteTime, c.BlackTime}
+	for _, player := range []uint8{top, 1 - top} {
+		y := 0
+		if player != top {
+			y = b.squareSize*8 + buttonHeight - clockHeight
+		}
+		var background color.Color = b.colors.Black()
+		switch {
+		case left[player] <= 0:
+			background = b.colors.Invalid()
+		case player == b.engine.Turn() && !b.engine.IsGameOver():
+			background = b.colors.Valid()
+		}
+		vector.DrawFilledRect(screen, float32(x), float32(y), float32(w), clockHeight, background, false)
+		ty := y + (clockHeight-clockFontSize)/2
+		graphics.TextAt(screen, graphics.TurnName(player), x+clockMargin, ty, clockFontSize, b.colors.PlayerWhite())
+		text := clock.Format(left[player])
+		tw, _ := graphics.TextSize(text, clockFontSize)
+		graphics.TextAt(screen, text, x+w-clockMargin-int(tw), ty, clockFontSize, b.colors.PlayerWhite())
+	}
+}
@@ -14,6 +14,12 @@ type Colors struct {
 	dragStart   color.Color
 	enPassant   color.Color
 	lastMove    color.Color
+	cursor      color.Color
+	bestMove    color.Color
+	otherMove   color.Color
+	hint        color.Color
+	threat      color.Color
+	annotations map[byte]color.Color
 }
 
 func NewColors() *Colors {
@@ -29,6 +35,17 @@ func NewColors() *Colors {
 		//enPassant: &color.RGBA{R: 0x00, G: 0xff, B: 0xff, A: 0xd0},
 		enPassant: &color.RGBA{R: 0x00, G: 0x00, B: 0xff, A: 0xd0},
 		lastMove:  &color.RGBA{R: 0xff, G: 0xff, B: 0x00, A: 0xd0},
+		cursor:    &color.RGBA{R: 0x00, G: 0x88, B: 0xff, A: 0x80},
+		bestMove:  &color.RGBA{R: 0x15, G: 0x78, B: 0x1b, A: 0xc0},
+		otherMove: &color.RGBA{R: 0x00, G: 0x30, B: 0x88, A: 0x80},
+		hint:      &color.RGBA{R: 0x00, G: 0xcc, B: 0x66, A: 0x90},
+		threat:    &color.RGBA{R: 0xcc, G: 0x22, B: 0x22, A: 0xc0},
+		annotations: map[byte]color.Color{
+			'G': &color.RGBA{R: 0x15, G: 0x78, B: 0x1b, A: 0xa0},
+			'R': &color.RGBA{R: 0x88, G: 0x20, B: 0x20, A: 0xa0},
+			'Y': &color.RGBA{R: 0xe6, G: 0x8f, B: 0x00, A: 0xa0},
+			'B': &color.RGBA{R: 0x00, G: 0x30, B: 0x88, A: 0xa0},
+		},
 	}
 }
 
@@ -65,6 +82,30 @@ func (c *Colors) EnPassant() color.Color {
 func (c *Colors) LastMove() color.Color {
 	return c.lastMove
 }
+func (c *Colors) Cursor() color.Color {
+	return c.cursor
+}
+func (c *Colors) BestMove() color.Color {
+	return c.bestMove
+}
+func (c *Colors) OtherMove() color.Color {
+	return c.otherMove
+}
+func (c *Colors) Hint() color.Color {
+	return c.hint
+}
+func (c *Colors) Threat() color.Color {
+	return c.threat
+}
+
+// Annotation returns the colour of the arrows and circles drawn by the
+// user in one of the PGN annotation colours: G, R, Y or B
+func (c *Colors) Annotation(colour byte) color.Color {
+	if clr, ok := c.annotations[colour]; ok {
+		return clr
+	}
+	return c.annotations['G']
+}
 func (c *Colors) SetPlayerWhite(newColor *color.RGBA) {
 	c.playerWhite = newColor
 }
@@ -89,6 +130,25 @@ func (c *Colors) SetEnPassant(newColor *color.RGBA) {
 func (c *Colors) SetLastMove(newColor *color.RGBA) {
 	c.lastMove = newColor
 }
+func (c *Colors) SetCursor(newColor *color.RGBA) {
+	c.cursor = newColor
+}
+
+func (c *Colors) SetBestMove(newColor *color.RGBA) {
+	c.bestMove = newColor
+}
+func (c *Colors) SetOtherMove(newColor *color.RGBA) {
+	c.otherMove = newColor
+}
+func (c *Colors) SetHint(newColor *color.RGBA) {
+	c.hint = newColor
+}
+func (c *Colors) SetThreat(newColor *color.RGBA) {
+	c.threat = newColor
+}
+func (c *Colors) SetAnnotation(colour byte, newColor *color.RGBA) {
+	c.annotations[colour] = newColor
+}
 
 func (c *Colors) Tints(tint color.Color) [2]color.Color {
 	return [2]color.Color{
@@ -30,3 +30,21 @@ func TestColors_Tint(t *testing.T) {
 		})
 	}
 }
+
+func TestColors_Annotation(t *testing.T) {
+	c := NewColors()
+	c.SetAnnotation('Y', &color.RGBA{R: 0xff, G: 0xff, B: 0x00, A: 0xff})
+	tests := map[string]struct {
+		colour byte
+		want   color.Color
+	}{
+		"set":     {colour: 'Y', want: &color.RGBA{R: 0xff, G: 0xff, B: 0x00, A: 0xff}},
+		"default": {colour: 'R', want: &color.RGBA{R: 0x88, G: 0x20, B: 0x20, A: 0xa0}},
+		"unknown": {colour: 'X', want: c.Annotation('G')},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			assert.Equal(tt, test.want, c.Annotation(test.colour))
+		})
+	}
+}
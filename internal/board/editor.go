@@ -0,0 +1,238 @@
+package board
+
+import (
+	"fmt"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+	"image/color"
+	"us.figge.chess/internal/board/graphics"
+	. "us.figge.chess/internal/common"
+	"us.figge.chess/internal/engine"
+)
+
+const (
+	paletteRows = 6
+	fromPalette = -1
+)
+
+var paletteOrder = [paletteRows]uint8{PieceKing, PieceQueen, PieceRook, PieceBishop, PieceKnight, PiecePawn}
+
+// positionEditor is the panel beside the board while a position is set
+// up: a palette of pieces to drag onto the board and buttons for the
+// rest of the position
+type positionEditor struct {
+	*engine.Editor
+	x, width  int
+	buttons   []*button
+	dragging  bool
+	dragFrom  int
+	dragPiece uint8
+	dragOp    *ebiten.DrawImageOptions
+}
+
+// Edit switches the board to editing the position it shows
+func (b *Board) Edit() {
+	if b.editor != nil || b.prompt != nil || b.selector.IsDragging() {
+		return
+	}
+	b.selector.Deselect()
+	b.cursor.Hide()
+	b.animation = nil
+	b.editor = &positionEditor{
+		Editor: b.engine.Editor(),
+		x:      b.panelX,
+		width:  b.squareSize * 2,
+		dragOp: &ebiten.DrawImageOptions{},
+	}
+	b.layoutEditor()
+	b.lastMove[0].Hide()
+	b.lastMove[1].Hide()
+	b.annotating = false
+	b.annotationPreview.Hide()
+	b.updateArrows()
+	b.updateAnnotations()
+	if w, _ := ebiten.WindowSize(); w < b.panelX+b.editor.width {
+		ebiten.SetWindowSize(b.panelX+b.editor.width, b.windowHeight)
+	}
+	b.editChanged()
+}
+
+// IsEditing reports whether the board is showing the position editor
+func (b *Board) IsEditing() bool {
+	return b.editor != nil
+}
+
+// CancelEdit leaves the editor, returning to the game as it was
+func (b *Board) CancelEdit() {
+	if b.editor == nil {
+		return
+	}
+	b.editor = nil
+	b.ShowMessage("")
+	b.highlightPosition()
+	b.generateForeground()
+}
+
+// StartFromEdit starts a new game from the position being edited, with
+// both sides moved through the GUI when analysing
+func (b *Board) StartFromEdit(analyse bool) {
+	if b.editor == nil {
+		return
+	}
+	if err := b.editor.Validate(); err != nil {
+		b.ShowMessage(err.Error())
+		return
+	}
+	if err := b.engine.SetFEN(b.editor.FEN()); err != nil {
+		b.ShowMessage(err.Error())
+		return
+	}
+	b.engine.SetAnalysis(analyse)
+	b.CancelEdit()
+}
+
+// layoutEditor places the palette at the top of the panel and a row of
+// buttons for each part of the position below it
+func (b *Board) layoutEditor() {
+	ed := b.editor
+	flag := func(right uint8) func() bool {
+		return func() bool { return ed.CastleRights()&right != 0 }
+	}
+	rows := [][]*button{
+		{{label: func() string { return graphics.TurnName(ed.Turn()) + " to move" }, action: func() { ed.SetTurn(1 - ed.Turn()) }}},
+		{
+			{label: func() string { return "K" }, on: flag(CastleRightsWhiteKing), action: func() { ed.ToggleCastling(CastleRightsWhiteKing) }},
+			{label: func() string { return "Q" }, on: flag(CastleRightsWhiteQueen), action: func() { ed.ToggleCastling(CastleRightsWhiteQueen) }},
+			{label: func() string { return "k" }, on: flag(CastleRightsBlackKing), action: func() { ed.ToggleCastling(CastleRightsBlackKing) }},
+			{label: func() string { return "q" }, on: flag(CastleRightsBlackQueen), action: func() { ed.ToggleCastling(CastleRightsBlackQueen) }},
+		},
+		{{label: func() string {
+			if index, ok := ed.EnPassant(); ok {
+				return "En passant " + RFtoN(ItoRF(index))
+			}
+			return "En passant -"
+		}, action: ed.CycleEnPassant}},
+		{
+			{label: func() string { return fmt.Sprintf("Half %d", ed.HalfMove()) }},
+			{label: func() string { return "-" }, action: func() { ed.SetHalfMove(ed.HalfMove() - 1) }},
+			{label: func() string { return "+" }, action: func() { ed.SetHalfMove(ed.HalfMove() + 1) }},
+		},
+		{
+			{label: func() string { return fmt.Sprintf("Move %d", ed.FullMove()) }},
+			{label: func() string { return "-" }, action: func() { ed.SetFullMove(ed.FullMove() - 1) }},
+			{label: func() string { return "+" }, action: func() { ed.SetFullMove(ed.FullMove() + 1) }},
+		},
+		{
+			{label: func() string { return "Clear" }, action: ed.Clear},
+			{label: func() string { return "Start" }, action: func() { _ = ed.SetFEN("") }},
+			{label: func() string { return "Cancel" }, action: b.CancelEdit},
+		},
+		{
+			{label: func() string { return "Play" }, action: func() { b.StartFromEdit(false) }},
+			{label: func() string { return "Analyse" }, action: func() { b.StartFromEdit(true) }},
+		},
+	}
+	ed.buttons = layoutButtons(ed.x, b.squareSize*paletteRows, ed.width, rows)
+}
+
+// updateEditor handles the mouse while editing: pieces are dragged from
+// the palette or around the board, dragged off the board or right
+// clicked to remove them, and the buttons clicked
+func (b *Board) updateEditor(x, y int) {
+	ed := b.editor
+	rank, file, onBoard := XYtoRF(x, y, b.squareSize, b.flipped)
+	index := RFtoI(rank, file)
+	switch {
+	case inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft):
+		if onBoard {
+			if pieceType, ok := ed.PieceAt(index); ok {
+				ed.dragging, ed.dragFrom, ed.dragPiece = true, int(index), pieceType
+				b.generateForeground()
+			}
+		} else if pieceType, ok := b.paletteAt(x, y); ok {
+			ed.dragging, ed.dragFrom, ed.dragPiece = true, fromPalette, pieceType
+		} else if btn := buttonAt(ed.buttons, x, y); btn != nil && btn.action != nil {
+			btn.action()
+			if b.editor != nil {
+				b.editChanged()
+			}
+			return
+		}
+	case inpututil.IsMouseButtonJustReleased(ebiten.MouseButtonLeft) && ed.dragging:
+		ed.dragging = false
+		switch {
+		case onBoard && ed.dragFrom == fromPalette:
+			ed.Put(index, ed.dragPiece)
+		case onBoard:
+			ed.Move(uint8(ed.dragFrom), index)
+		case ed.dragFrom != fromPalette:
+			ed.Remove(uint8(ed.dragFrom))
+		}
+		b.editChanged()
+	case inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonRight) && onBoard && !ed.dragging:
+		ed.Remove(index)
+		b.editChanged()
+	}
+	if ed.dragging {
+		half := float64(b.squareSize / 2)
+		ed.dragOp.GeoM.Reset()
+		ed.dragOp.GeoM.Translate(float64(x)-half, float64(y)-half)
+	}
+}
+
+// editChanged redraws the position being edited and shows why it
+// can't be played from yet, if it can't
+func (b *Board) editChanged() {
+	ed := b.editor
+	b.message = ""
+	if err := ed.Validate(); err != nil {
+		b.message = err.Error()
+	}
+	if index, ok := ed.EnPassant(); ok {
+		b.enPassant.UpdateByIndex(index)
+	} else {
+		b.enPassant.Hide()
+	}
+	b.rehighlight = true
+	b.generateForeground()
+}
+
+// paletteAt returns the piece in the palette at a point on the screen
+func (b *Board) paletteAt(x, y int) (uint8, bool) {
+	ed := b.editor
+	if x < ed.x || x >= ed.x+ed.width || y < 0 || y >= b.squareSize*paletteRows {
+		return 0, false
+	}
+	player := uint8((x - ed.x) / b.squareSize)
+	return paletteOrder[y/b.squareSize] | player, true
+}
+
+// dragIndex returns the square a piece is being dragged from, or -1
+func (ed *positionEditor) dragIndex() int {
+	if !ed.dragging {
+		return -1
+	}
+	return ed.dragFrom
+}
+
+// drawEditor draws the panel, and the piece being dragged over the
+// board or panel
+func (b *Board) drawEditor(screen *ebiten.Image) {
+	ed := b.editor
+	vector.DrawFilledRect(screen, float32(ed.x), 0, float32(screen.Bounds().Dx()-ed.x), float32(b.squareSize*8+buttonHeight), b.colors.Black(), false)
+	clr := []color.Color{b.colors.PlayerWhite(), b.colors.PlayerBlack()}
+	for row, piece := range paletteOrder {
+		for player := PlayerWhite; player <= PlayerBlack; player++ {
+			x, y := ed.x+int(player)*b.squareSize, row*b.squareSize
+			vector.DrawFilledRect(screen, float32(x), float32(y), float32(b.squareSize), float32(b.squareSize), clr[(int(player)+row)%2], false)
+			op := &ebiten.DrawImageOptions{}
+			op.GeoM.Translate(float64(x), float64(y))
+			graphics.GetPiece(piece|player).Draw(screen, op)
+		}
+	}
+	b.drawButtons(screen, ed.buttons)
+	if ed.dragging {
+		graphics.GetPiece(ed.dragPiece).Draw(screen, ed.dragOp)
+	}
+}
@@ -0,0 +1,128 @@
+package board
+
+import (
+	"fmt"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+	"math"
+	"time"
+	"us.figge.chess/internal/board/graphics"
+	. "us.figge.chess/internal/common"
+)
+
+const (
+	evalBarWidth    = 20
+	evalBarFontSize = 9
+	evalBarEase     = 130 * time.Millisecond // time to move about two thirds of the way to the score
+
+	// winningChances scales centipawns for the sigmoid, so that a pawn
+	// up fills about three fifths of the bar and a rook nearly all of it
+	winningChances = 0.00368208
+)
+
+// evalBar is the bar between the board and the side panel showing how
+// much of the game white is winning, from the latest score
+type evalBar struct {
+	shown   float64 // share of the bar white fills, easing to the target
+	target  float64
+	label   string
+	updated time.Time
+}
+
+func newEvalBar() *evalBar {
+	return &evalBar{shown: .5, target: .5}
+}
+
+// updateEvalBar eases the bar towards the latest score of the position
+// on the board. The easing is measured by the clock rather than in
+// frames, so it takes as long at any frame rate
+func (b *Board) updateEvalBar() {
+	bar := b.evalBar
+	if bar == nil {
+		return
+	}
+	score, mate, ok := b.engine.Evaluation()
+	bar.target, bar.label = .5, ""
+	if ok {
+		bar.target = whiteShare(score, mate, b.engine.Turn())
+		bar.label = evalLabel(score, mate)
+	}
+	now := time.Now()
+	if !bar.updated.IsZero() {
+		elapsed := now.Sub(bar.updated)
+		bar.shown += (bar.target - bar.shown) * (1 - math.Exp(-float64(elapsed)/float64(evalBarEase)))
+	}
+	bar.updated = now
+	if math.Abs(bar.target-bar.shown) < .001 {
+		bar.shown = bar.target
+	}
+}
+
+// whiteShare maps a score from white's point of view to the share of
+// the bar white fills. Mate fills it for the side mating, and in a
+// position already mate, for the side that isn't to move
+func whiteShare(score int, mate bool, turn uint8) float64 {
+	switch {
+	case mate && score == 0 && turn == PlayerWhite:
+		return 0
+	case mate && score == 0:
+		return 1
+	case mate && score > 0:
+		return 1
+	case mate:
+		return 0
+	}
+	return 1 / (1 + math.Exp(-winningChances*float64(score)))
+}
+
+// evalLabel writes a score the way it fits on the bar, in pawns or as
+// mate in moves, without a sign as the end it is shown at tells whose
+// advantage it is
+func evalLabel(score int, mate bool) string {
+	if mate {
+		return fmt.Sprintf("M%d", abs(score))
+	}
+	return fmt.Sprintf("%.1f", math.Abs(float64(score))/100)
+}
+
+// drawEvalBar draws the bar beside the board, white's share at white's
+// end of the board, with the score at the end of the side ahead
+func (b *Board) drawEvalBar(screen *ebiten.Image) {
+	bar := b.evalBar
+	if bar == nil {
+		return
+	}
+	x, height := float32(b.squareSize*8), float32(b.squareSize*8)
+	vector.DrawFilledRect(screen, x, 0, evalBarWidth, height+buttonHeight, b.colors.Black(), false)
+	if b.editor != nil {
+		return
+	}
+	white := float32(bar.shown) * height
+	top := float32(0)
+	if !b.flipped {
+		top = height - white
+	}
+	vector.DrawFilledRect(screen, x, top, evalBarWidth, white, b.colors.PlayerWhite(), false)
+	if bar.label == "" {
+		return
+	}
+	w, h := graphics.TextSize(bar.label, evalBarFontSize)
+	tx := int(x) + (evalBarWidth-int(w))/2
+	whiteAhead := bar.target >= .5
+	clr := b.colors.Black()
+	if !whiteAhead {
+		clr = b.colors.PlayerWhite()
+	}
+	ty := 2
+	if whiteAhead != b.flipped {
+		ty = int(height) - int(h) - 2
+	}
+	graphics.TextAt(screen, bar.label, tx, ty, evalBarFontSize, clr)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
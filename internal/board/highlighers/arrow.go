@@ -0,0 +1,152 @@
+package highlighers
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+	"image/color"
+	"math"
+	. "us.figge.chess/internal/common"
+)
+
+// sizes of an arrow as shares of a square
+const (
+	arrowShaft      = .09 // half the width of the shaft
+	arrowHeadWidth  = .24 // half the width of the head
+	arrowHeadLength = .36
+)
+
+// Arrow is an arrow drawn from the centre of one square to another, as
+// for a move suggested by an engine. A knight's move is drawn along its
+// longer leg and then turns a right angle
+type Arrow struct {
+	highlighter Highlighter
+	squareSize  int
+	color       color.Color
+	visible     bool
+	from        uint8
+	to          uint8
+	flipped     bool
+	vertices    []ebiten.Vertex
+	indices     []uint16
+}
+
+func NewArrow(highlighter Highlighter, squareSize int, clr color.Color) *Arrow {
+	return &Arrow{
+		highlighter: highlighter,
+		squareSize:  squareSize,
+		color:       clr,
+	}
+}
+
+// UpdateByIndex points the arrow from one square to another, in the
+// colour given
+func (a *Arrow) UpdateByIndex(from, to uint8, clr color.Color) {
+	if a.visible && a.from == from && a.to == to && a.color == clr && a.flipped == a.highlighter.IsFlipped() {
+		return
+	}
+	a.from, a.to, a.color = from, to, clr
+	a.visible = from != to
+	a.flipped = a.highlighter.IsFlipped()
+	a.vertices, a.indices = nil, nil
+}
+
+func (a *Arrow) Hide() {
+	a.visible = false
+}
+
+func (a *Arrow) IsVisible() bool {
+	return a.visible
+}
+
+func (a *Arrow) Draw(dst *ebiten.Image) {
+	if !a.visible {
+		return
+	}
+	if a.flipped != a.highlighter.IsFlipped() {
+		a.UpdateByIndex(a.from, a.to, a.color)
+	}
+	if a.vertices == nil {
+		a.tessellate()
+	}
+	op := &ebiten.DrawTrianglesOptions{AntiAlias: true, FillRule: ebiten.FillRuleNonZero}
+	dst.DrawTriangles(a.vertices, a.indices, whiteSubImage, op)
+}
+
+// tessellate outlines the arrow as one path, the shaft's sides meeting
+// at the corner of a knight's move, and fills it with the arrow's colour
+func (a *Arrow) tessellate() {
+	points := a.points()
+	size := float64(a.squareSize)
+	shaft, headWidth, headLength := arrowShaft*size, arrowHeadWidth*size, arrowHeadLength*size
+
+	// the left and right sides of the outline, from the tail to the head
+	var left, right [][2]float64
+	for i := 0; i < len(points)-1; i++ {
+		nx, ny := normal(points[i], points[i+1])
+		if i > 0 {
+			// the sides of legs at right angles meet a shaft's width
+			// from the corner along the normals of both
+			px, py := normal(points[i-1], points[i])
+			nx, ny = nx+px, ny+py
+		}
+		left = append(left, [2]float64{points[i][0] + nx*shaft, points[i][1] + ny*shaft})
+		right = append(right, [2]float64{points[i][0] - nx*shaft, points[i][1] - ny*shaft})
+	}
+	tip := points[len(points)-1]
+	nx, ny := normal(points[len(points)-2], tip)
+	bx, by := tip[0]+ny*headLength, tip[1]-nx*headLength
+
+	path := &vector.Path{}
+	path.MoveTo(float32(left[0][0]), float32(left[0][1]))
+	for _, p := range left[1:] {
+		path.LineTo(float32(p[0]), float32(p[1]))
+	}
+	path.LineTo(float32(bx+nx*shaft), float32(by+ny*shaft))
+	path.LineTo(float32(bx+nx*headWidth), float32(by+ny*headWidth))
+	path.LineTo(float32(tip[0]), float32(tip[1]))
+	path.LineTo(float32(bx-nx*headWidth), float32(by-ny*headWidth))
+	path.LineTo(float32(bx-nx*shaft), float32(by-ny*shaft))
+	for i := len(right) - 1; i >= 0; i-- {
+		path.LineTo(float32(right[i][0]), float32(right[i][1]))
+	}
+	path.Close()
+
+	a.vertices, a.indices = path.AppendVerticesAndIndicesForFilling(nil, nil)
+	c := color.NRGBAModel.Convert(a.color).(color.NRGBA)
+	for i := range a.vertices {
+		a.vertices[i].SrcX, a.vertices[i].SrcY = 1, 1
+		a.vertices[i].ColorR = float32(c.R) / 0xff
+		a.vertices[i].ColorG = float32(c.G) / 0xff
+		a.vertices[i].ColorB = float32(c.B) / 0xff
+		a.vertices[i].ColorA = float32(c.A) / 0xff
+	}
+}
+
+// points returns the centres of the squares the arrow runs through,
+// with the corner of a knight's move
+func (a *Arrow) points() [][2]float64 {
+	half := float64(a.squareSize) / 2
+	centre := func(index uint8) [2]float64 {
+		rank, file := ItoRF(index)
+		x, y := RFtoXY(rank, file, a.squareSize, a.flipped)
+		return [2]float64{float64(x) + half, float64(y) + half}
+	}
+	from, to := centre(a.from), centre(a.to)
+	dx, dy := math.Abs(to[0]-from[0]), math.Abs(to[1]-from[1])
+	square := float64(a.squareSize)
+	switch {
+	case math.Round(dx/square) == 1 && math.Round(dy/square) == 2:
+		return [][2]float64{from, {from[0], to[1]}, to}
+	case math.Round(dx/square) == 2 && math.Round(dy/square) == 1:
+		return [][2]float64{from, {to[0], from[1]}, to}
+	}
+	return [][2]float64{from, to}
+}
+
+// normal returns the unit vector to the left of the line between two
+// points, as seen on the screen
+func normal(from, to [2]float64) (float64, float64) {
+	dx, dy := to[0]-from[0], to[1]-from[1]
+	length := math.Hypot(dx, dy)
+	return dy / length, -dx / length
+}
@@ -0,0 +1,53 @@
+package highlighers
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+	"image/color"
+	. "us.figge.chess/internal/common"
+)
+
+// circleWidth is the width of the ring as a share of a square
+const circleWidth = .07
+
+// Circle is a ring drawn just inside the edges of a square to mark it
+type Circle struct {
+	highlighter Highlighter
+	squareSize  int
+	color       color.Color
+	visible     bool
+	index       uint8
+}
+
+func NewCircle(highlighter Highlighter, squareSize int, clr color.Color) *Circle {
+	return &Circle{
+		highlighter: highlighter,
+		squareSize:  squareSize,
+		color:       clr,
+	}
+}
+
+// UpdateByIndex moves the circle to the square, in the colour given
+func (c *Circle) UpdateByIndex(index uint8, clr color.Color) {
+	c.index, c.color = index, clr
+	c.visible = true
+}
+
+func (c *Circle) Hide() {
+	c.visible = false
+}
+
+func (c *Circle) IsVisible() bool {
+	return c.visible
+}
+
+func (c *Circle) Draw(dst *ebiten.Image) {
+	if !c.visible {
+		return
+	}
+	rank, file := ItoRF(c.index)
+	x, y := RFtoXY(rank, file, c.squareSize, c.highlighter.IsFlipped())
+	half := float32(c.squareSize) / 2
+	width := circleWidth * float32(c.squareSize)
+	vector.StrokeCircle(dst, float32(x)+half, float32(y)+half, half-width/2-1, width, c.color, true)
+}
@@ -5,12 +5,14 @@ import (
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"image/color"
 	"us.figge.chess/internal/board/graphics"
+	. "us.figge.chess/internal/common"
 )
 
 type DragHighlighter interface {
 	Highlighter
 	DragBegin(index uint8, pieceType uint8) bool
 	DragOver(index uint8, pieceType uint8)
+	DragSelect(index uint8, pieceType uint8)
 	DragEnd(from, to uint8, pieceType uint8, cancelled bool)
 }
 
@@ -26,6 +28,9 @@ type DragAndDrop struct {
 	dragOver    uint8
 	dragPiece   *graphics.Piece
 	dragging    bool
+	selected    bool
+	reselected  bool
+	dropped     bool
 }
 
 func NewDragAndDrop(highlighter DragHighlighter, squareSize int, background, dragColor [2]color.Color) *DragAndDrop {
@@ -39,28 +44,36 @@ func NewDragAndDrop(highlighter DragHighlighter, squareSize int, background, dra
 	return dd
 }
 
+// Update follows the mouse. A piece is moved either by dragging it to
+// its square, or by clicking it, leaving it selected, and then clicking
+// the square. Clicking another piece selects it instead, and clicking
+// anywhere else drops the selection
 func (d *DragAndDrop) Update(x, y int) bool {
 	changed := d.Highlight.Update(x, y)
-	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) && d.visible && d.piece != nil {
-		d.dragPiece = d.piece
-		d.dragOffsetX = d.highlightX - x
-		d.dragOffsetY = d.highlightY - y
-		d.draggingOp.GeoM.Reset()
-		d.draggingOp.GeoM.Translate(float64(x+d.dragOffsetX), float64(y+d.dragOffsetY))
-		d.dragIndex = d.index
-		d.dragOver = d.index
-		d.Highlight.background = d.dragColor
-		changed = true
-		d.dragging = d.highlighter.DragBegin(d.dragOver, d.dragPiece.Type())
-		if !d.dragging {
-			d.Highlight.background = d.background
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		from, piece, selected := d.dragIndex, d.dragPiece, d.selected
+		d.selected = false
+		switch {
+		case d.visible && d.piece != nil && d.beginDrag(x, y):
+			d.reselected = selected && d.index == from
+			changed = true
+		case selected:
+			changed = true
+			d.highlighter.DragEnd(from, d.index, piece.Type(), !d.visible || d.index == from)
 		}
 	} else if d.dragging {
 		if inpututil.IsMouseButtonJustReleased(ebiten.MouseButtonLeft) {
 			d.dragging = false
 			changed = true
 			d.Highlight.background = d.background
-			d.highlighter.DragEnd(d.dragIndex, d.dragOver, d.dragPiece.Type(), d.dragOver == d.dragIndex || !d.visible)
+			if d.visible && d.dragOver == d.dragIndex && !d.reselected {
+				d.selected = true
+				d.highlighter.DragSelect(d.dragIndex, d.dragPiece.Type())
+			} else {
+				d.dropped = true
+				d.highlighter.DragEnd(d.dragIndex, d.dragOver, d.dragPiece.Type(), d.dragOver == d.dragIndex || !d.visible)
+				d.dropped = false
+			}
 		} else {
 			d.draggingOp.GeoM.Reset()
 			d.draggingOp.GeoM.Translate(float64(x+d.dragOffsetX), float64(y+d.dragOffsetY))
@@ -75,6 +88,24 @@ func (d *DragAndDrop) Update(x, y int) bool {
 	return changed
 }
 
+// beginDrag picks up the piece under the mouse, if the highlighter lets
+// it be moved
+func (d *DragAndDrop) beginDrag(x, y int) bool {
+	d.dragPiece = d.piece
+	d.dragOffsetX = d.highlightX - x
+	d.dragOffsetY = d.highlightY - y
+	d.draggingOp.GeoM.Reset()
+	d.draggingOp.GeoM.Translate(float64(x+d.dragOffsetX), float64(y+d.dragOffsetY))
+	d.dragIndex = d.index
+	d.dragOver = d.index
+	d.Highlight.background = d.dragColor
+	d.dragging = d.highlighter.DragBegin(d.dragOver, d.dragPiece.Type())
+	if !d.dragging {
+		d.Highlight.background = d.background
+	}
+	return d.dragging
+}
+
 func (d *DragAndDrop) Hide() {
 	d.CancelDrag()
 	d.Highlight.Hide()
@@ -84,6 +115,46 @@ func (d *DragAndDrop) IsDragging() bool {
 	return d.dragging
 }
 
+// Click selects the piece on a square, or moves the selected piece to
+// it, as clicking the square with the mouse does
+func (d *DragAndDrop) Click(index uint8) {
+	if d.dragging {
+		return
+	}
+	from, selected := d.dragIndex, d.selected
+	d.selected = false
+	pieceType, present := d.highlighter.GetPieceType(ItoRF(index))
+	switch {
+	case selected && index == from:
+		d.highlighter.DragEnd(from, from, d.dragPiece.Type(), true)
+	case present && d.highlighter.DragBegin(index, pieceType):
+		d.dragIndex, d.dragPiece, d.selected = index, graphics.GetPiece(pieceType), true
+		d.highlighter.DragSelect(index, pieceType)
+	case selected:
+		d.highlighter.DragEnd(from, index, d.dragPiece.Type(), false)
+	}
+}
+
+// Dropped reports, while DragEnd is called, whether the piece was
+// dropped from a drag rather than moved to a square clicked
+func (d *DragAndDrop) Dropped() bool {
+	return d.dropped
+}
+
+// IsSelected reports whether a piece has been clicked, and waits for
+// the square it moves to to be clicked
+func (d *DragAndDrop) IsSelected() bool {
+	return d.selected
+}
+
+// Deselect drops the selected piece, if there is one
+func (d *DragAndDrop) Deselect() {
+	if d.selected {
+		d.selected = false
+		d.highlighter.DragEnd(d.dragIndex, d.dragIndex, d.dragPiece.Type(), true)
+	}
+}
+
 func (d *DragAndDrop) DragIndex() uint8 {
 	return d.dragIndex
 }
@@ -14,6 +14,7 @@ import (
 
 type Highlighter interface {
 	GetPieceType(rank, file uint8) (uint8, bool)
+	IsFlipped() bool
 }
 
 type Highlight struct {
@@ -22,6 +23,7 @@ type Highlight struct {
 	background  [2]color.Color
 	visible     bool
 	index       uint8
+	flipped     bool
 	cursorX     int
 	cursorY     int
 	cursorRank  uint8
@@ -44,7 +46,8 @@ func NewHighlight(highlighter Highlighter, squareSize int, background [2]color.C
 	return h
 }
 func (h *Highlight) Update(x, y int) bool {
-	rank, file, inRange := XYtoRF(x, y, h.squareSize)
+	flipped := h.highlighter.IsFlipped()
+	rank, file, inRange := XYtoRF(x, y, h.squareSize, flipped)
 	changed := h.visible != inRange
 	if !inRange {
 		h.visible = false
@@ -52,11 +55,12 @@ func (h *Highlight) Update(x, y int) bool {
 	}
 	h.visible = true
 	index := RFtoI(rank, file)
-	if index == h.index {
+	if index == h.index && flipped == h.flipped {
 		return changed
 	}
-	hx, hy := RFtoXY(rank, file, h.squareSize)
+	hx, hy := RFtoXY(rank, file, h.squareSize, flipped)
 	h.index = index
+	h.flipped = flipped
 	h.cursorX = x
 	h.cursorY = y
 	h.cursorRank = rank
@@ -78,10 +82,14 @@ func (h *Highlight) Update(x, y int) bool {
 func (h *Highlight) UpdateByIndex(index uint8) {
 	h.index = index
 	h.cursorRank, h.cursorFile = ItoRF(index)
-	h.highlightX, h.highlightY = RFtoXY(h.cursorRank, h.cursorFile, h.squareSize)
+	h.highlightX, h.highlightY = RFtoXY(h.cursorRank, h.cursorFile, h.squareSize, h.highlighter.IsFlipped())
 	h.visible = true
 }
 
+func (h *Highlight) Index() uint8 {
+	return h.index
+}
+
 func (h *Highlight) Hide() {
 	h.visible = false
 }
@@ -0,0 +1,132 @@
+package board
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+	"us.figge.chess/internal/board/textedit"
+	. "us.figge.chess/internal/common"
+)
+
+// ToggleCursor shows or hides the square cursor moves are played with
+// from the keyboard. It starts on the king's file, at the bottom
+func (b *Board) ToggleCursor() {
+	if b.editor != nil {
+		return
+	}
+	if b.cursor.IsVisible() {
+		b.selector.Deselect()
+		b.cursor.Hide()
+	} else if b.flipped {
+		b.cursor.UpdateByIndex(RFtoI(8, 5))
+	} else {
+		b.cursor.UpdateByIndex(RFtoI(1, 5))
+	}
+	b.rehighlight = true
+}
+
+// HasCursor reports whether the square cursor is shown
+func (b *Board) HasCursor() bool {
+	return b.cursor.IsVisible()
+}
+
+// MoveCursor moves the square cursor across and down the screen,
+// stopping at the edge of the board
+func (b *Board) MoveCursor(dx, dy int) {
+	if !b.cursor.IsVisible() {
+		return
+	}
+	if b.flipped {
+		dx, dy = -dx, -dy
+	}
+	index := int(b.cursor.Index())
+	row, column := max(0, min(7, index/8+dy)), max(0, min(7, index%8+dx))
+	b.cursor.UpdateByIndex(uint8(row*8 + column))
+	b.rehighlight = true
+}
+
+// CursorSelect picks up the piece under the cursor, or puts the piece
+// picked up down on its square, as clicking the square does
+func (b *Board) CursorSelect() {
+	if b.cursor.IsVisible() {
+		b.selector.Click(b.cursor.Index())
+	}
+}
+
+// CursorCancel puts back the piece picked up, or else hides the cursor
+func (b *Board) CursorCancel() {
+	if b.selector.IsSelected() {
+		b.selector.Deselect()
+		return
+	}
+	b.cursor.Hide()
+	b.rehighlight = true
+}
+
+// PromptMove opens a line under the board to type a move into, in SAN
+// or UCI notation
+func (b *Board) PromptMove() {
+	if b.prompt != nil || b.text != nil || b.editor != nil || b.selector.IsDragging() {
+		return
+	}
+	b.prompt = &textEntry{Buffer: textedit.New(""), title: "Move", opening: true}
+}
+
+// updatePrompt edits the move being typed. Enter plays it and Escape
+// closes the prompt
+func (b *Board) updatePrompt() {
+	t := b.prompt
+	if t.opening {
+		t.opening = false
+		return
+	}
+	t.ticks++
+	shift := ebiten.IsKeyPressed(ebiten.KeyShift)
+	command := ebiten.IsKeyPressed(ebiten.KeyControl) || ebiten.IsKeyPressed(ebiten.KeyMeta)
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyEscape):
+		b.prompt = nil
+		return
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnter) || inpututil.IsKeyJustPressed(ebiten.KeyNumpadEnter):
+		b.playTyped(t.String())
+		return
+	case !editBuffer(t.Buffer, shift, command):
+		return
+	}
+	t.ticks = 0
+}
+
+// playTyped plays a typed move, closing the prompt, or shows why it
+// can't be played
+func (b *Board) playTyped(text string) {
+	b.selector.Deselect()
+	san, ok := b.engine.PlayMove(text)
+	if !ok {
+		b.ShowMessage(san)
+		return
+	}
+	b.prompt = nil
+	b.ShowMessage("")
+	move, _ := b.engine.LastMove()
+	b.animateMove(move, false)
+	b.movePlayed()
+	b.generateForeground()
+}
+
+// drawPrompt draws the move being typed across the bottom of the board
+func (b *Board) drawPrompt(screen *ebiten.Image) {
+	t := b.prompt
+	y := b.squareSize*8 - messageHeight
+	vector.DrawFilledRect(screen, 0, float32(y), float32(b.squareSize*8), messageHeight, overlayColor, false)
+	label := t.title + ": "
+	left := 4 + len(label)*charWidth
+	if start, end := t.Selection(); start < end {
+		vector.DrawFilledRect(screen, float32(left+start*charWidth), float32(y+2), float32((end-start)*charWidth), lineHeight, b.colors.Valid(), false)
+	}
+	ebitenutil.DebugPrintAt(screen, label+t.String(), 4, y+2)
+	if (t.ticks/blinkTicks)%2 == 0 {
+		x := left + t.Cursor()*charWidth
+		vector.DrawFilledRect(screen, float32(x), float32(y+2), 1, lineHeight, b.colors.PlayerWhite(), false)
+	}
+}
@@ -0,0 +1,165 @@
+package board
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+	"strconv"
+	"us.figge.chess/internal/board/graphics"
+	. "us.figge.chess/internal/common"
+	"us.figge.chess/internal/engine"
+	"us.figge.chess/internal/game/tree"
+)
+
+const (
+	moveFontSize    = 14
+	moveRowHeight   = 20
+	moveNumberWidth = 44
+	minMoveList     = 120
+)
+
+// moveList is the panel beside the board listing the moves of the
+// line the position is on, numbered with white and black side by side.
+// It fills the width of the window left by the board
+type moveList struct {
+	image   *ebiten.Image
+	x, y    int
+	rows    []moveRow
+	scroll  int
+	current *tree.Node
+	length  int
+	dirty   bool
+}
+
+// moveRow is a numbered row of the move list, either move may be
+// missing at the start or end of the line
+type moveRow struct {
+	number int
+	moves  [2]*engine.LineMove
+}
+
+func newMoveList(x int) *moveList {
+	return &moveList{x: x, dirty: true}
+}
+
+// updateMoves follows the line the position is on, keeping the current
+// move in view, scrolls with the mouse wheel and jumps to a move that
+// is clicked
+func (b *Board) updateMoves(x, y int) {
+	m := b.moves
+	line := b.engine.Line()
+	current := b.engine.Tree().Current()
+	if current != m.current || len(line) != m.length {
+		m.current, m.length = current, len(line)
+		m.setRows(line)
+		m.scrollTo(current)
+		m.dirty = true
+	}
+	y -= m.y
+	if m.image == nil || x < m.x || x >= m.x+m.image.Bounds().Dx() || y < 0 || y >= m.image.Bounds().Dy() {
+		return
+	}
+	if _, dy := ebiten.Wheel(); dy != 0 {
+		m.scroll = max(0, min(len(m.rows)-m.visibleRows(), m.scroll-int(dy)))
+		m.dirty = true
+	}
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) && !b.selector.IsDragging() {
+		if move := m.moveAt(x, y); move != nil {
+			b.engine.GotoNode(move.Node)
+			b.positionChanged()
+		}
+	}
+}
+
+func (m *moveList) setRows(line []engine.LineMove) {
+	m.rows = m.rows[:0]
+	for i := range line {
+		move := &line[i]
+		if move.Player == PlayerWhite || len(m.rows) == 0 {
+			m.rows = append(m.rows, moveRow{number: move.Number})
+		}
+		m.rows[len(m.rows)-1].moves[move.Player] = move
+	}
+}
+
+// scrollTo scrolls the least it can to show the row of a move
+func (m *moveList) scrollTo(node *tree.Node) {
+	for i, row := range m.rows {
+		for _, move := range row.moves {
+			if move != nil && move.Node == node {
+				m.scroll = max(min(m.scroll, i), i-m.visibleRows()+1)
+				return
+			}
+		}
+	}
+	m.scroll = 0
+}
+
+func (m *moveList) visibleRows() int {
+	if m.image == nil {
+		return 1
+	}
+	return max(1, m.image.Bounds().Dy()/moveRowHeight)
+}
+
+func (m *moveList) columnWidth() int {
+	return (m.image.Bounds().Dx() - moveNumberWidth) / 2
+}
+
+// moveAt returns the move shown at a point on the screen, if any
+func (m *moveList) moveAt(x, y int) *engine.LineMove {
+	if m.columnWidth() <= 0 || x-m.x < moveNumberWidth {
+		return nil
+	}
+	row := m.scroll + y/moveRowHeight
+	column := (x - m.x - moveNumberWidth) / m.columnWidth()
+	if row >= len(m.rows) || column > 1 {
+		return nil
+	}
+	return m.rows[row].moves[column]
+}
+
+// drawMoves draws the move list across the screen right of the board,
+// between the clocks when there are any and above any analysis,
+// redrawing it only when it has changed
+func (b *Board) drawMoves(screen *ebiten.Image) {
+	m := b.moves
+	w, h := screen.Bounds().Dx()-m.x, b.squareSize*8+buttonHeight-b.analysisHeight()
+	m.y = 0
+	if b.isTimed() {
+		m.y, h = clockHeight, h-2*clockHeight
+	}
+	if w <= 0 {
+		return
+	}
+	if m.image == nil || m.image.Bounds().Dx() != w || m.image.Bounds().Dy() != h {
+		m.image = ebiten.NewImage(w, h)
+		m.scrollTo(m.current)
+		m.dirty = true
+	}
+	if m.dirty {
+		m.image.Fill(b.colors.Black())
+		column := m.columnWidth()
+		for i := m.scroll; i < len(m.rows) && i < m.scroll+m.visibleRows(); i++ {
+			row := m.rows[i]
+			y := (i - m.scroll) * moveRowHeight
+			graphics.TextAt(m.image, strconv.Itoa(row.number)+".", 6, y+2, moveFontSize, b.colors.PlayerBlack())
+			for player, move := range row.moves {
+				x := moveNumberWidth + player*column
+				switch {
+				case move == nil && player == int(PlayerWhite):
+					graphics.TextAt(m.image, "...", x+4, y+2, moveFontSize, b.colors.PlayerWhite())
+				case move != nil:
+					if move.Node == m.current {
+						vector.DrawFilledRect(m.image, float32(x), float32(y), float32(column), moveRowHeight, b.colors.Valid(), false)
+					}
+					graphics.TextAt(m.image, move.Node.SAN, x+4, y+2, moveFontSize, b.colors.PlayerWhite())
+				}
+			}
+		}
+		m.dirty = false
+	}
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Translate(float64(m.x), float64(m.y))
+	screen.DrawImage(m.image, op)
+}
@@ -1,6 +1,9 @@
 package board
 
-import "image/color"
+import (
+	"image/color"
+	"time"
+)
 
 type Option func(b *Board)
 
@@ -10,6 +13,50 @@ func OptDebugEnabled(enabled bool) Option {
 	}
 }
 
+// OptPGNDir sets the directory games are saved to
+func OptPGNDir(dir string) Option {
+	return func(b *Board) {
+		b.pgnDir = dir
+	}
+}
+
+// OptMoveListWidth sets the width the move list beside the board
+// starts at, it grows and shrinks with the window
+func OptMoveListWidth(width int) Option {
+	return func(b *Board) {
+		b.moveListWidth = width
+	}
+}
+
+// OptEvalBar shows a bar between the board and the move list filling
+// with white as white's score improves
+func OptEvalBar(enabled bool) Option {
+	return func(b *Board) {
+		b.evalBar = nil
+		if enabled {
+			b.evalBar = newEvalBar()
+		}
+	}
+}
+
+// OptArrows draws the engine's suggested moves over the board while it
+// analyses: the best move, the first move of its other lines, and the
+// number of moves given that follow the best move
+func OptArrows(enabled bool, followingMoves int) Option {
+	return func(b *Board) {
+		b.arrowsEnabled = enabled
+		b.followingMoves = followingMoves
+	}
+}
+
+// OptAnimation sets how long a move takes to slide across the board,
+// zero to show moves at once
+func OptAnimation(duration time.Duration) Option {
+	return func(b *Board) {
+		b.animationDuration = duration
+	}
+}
+
 func OptSquareSize(size int) Option {
 	return func(b *Board) {
 		b.squareSize = size
@@ -56,3 +103,33 @@ func OptLastMoveRGBA(red, green, blue, alpha uint8) Option {
 		b.colors.SetLastMove(&color.RGBA{R: red, G: green, B: blue, A: alpha})
 	}
 }
+func OptBestMoveRGBA(red, green, blue, alpha uint8) Option {
+	return func(b *Board) {
+		b.colors.SetBestMove(&color.RGBA{R: red, G: green, B: blue, A: alpha})
+	}
+}
+func OptOtherMoveRGBA(red, green, blue, alpha uint8) Option {
+	return func(b *Board) {
+		b.colors.SetOtherMove(&color.RGBA{R: red, G: green, B: blue, A: alpha})
+	}
+}
+func OptHintRGBA(red, green, blue, alpha uint8) Option {
+	return func(b *Board) {
+		b.colors.SetHint(&color.RGBA{R: red, G: green, B: blue, A: alpha})
+	}
+}
+func OptThreatRGBA(red, green, blue, alpha uint8) Option {
+	return func(b *Board) {
+		b.colors.SetThreat(&color.RGBA{R: red, G: green, B: blue, A: alpha})
+	}
+}
+func OptAnnotationRGBA(colour byte, red, green, blue, alpha uint8) Option {
+	return func(b *Board) {
+		b.colors.SetAnnotation(colour, &color.RGBA{R: red, G: green, B: blue, A: alpha})
+	}
+}
+func OptCursorRGBA(red, green, blue, alpha uint8) Option {
+	return func(b *Board) {
+		b.colors.SetCursor(&color.RGBA{R: red, G: green, B: blue, A: alpha})
+	}
+}
@@ -0,0 +1,91 @@
+package board
+
+import (
+	"time"
+	"us.figge.chess/internal/board/highlighers"
+)
+
+// probeShown is how long a hint or threat stays on the board
+const probeShown = 3 * time.Second
+
+// shownProbe is a hint or threat asked for in a position, shown for a
+// while once the engine has found it
+type shownProbe struct {
+	fen    string
+	threat bool
+	step   int       // 1 shows a hint's from-square, 2 its to-square as well
+	until  time.Time // zero until the engine has found the move
+}
+
+// Hint briefly highlights the square the engine's best move is played
+// from, and on a second press the square it is played to as well
+func (b *Board) Hint() {
+	b.showProbe(false)
+}
+
+// Threat briefly draws an arrow for the move the opponent threatens,
+// the one they would play if the side to move could pass
+func (b *Board) Threat() {
+	b.showProbe(true)
+}
+
+func (b *Board) showProbe(threat bool) {
+	if b.editor != nil {
+		return
+	}
+	fen := b.engine.FEN()
+	if p := b.probe; p != nil && p.fen == fen && p.threat == threat {
+		p.step = min(p.step+1, 2)
+		if !p.until.IsZero() {
+			p.until = time.Now().Add(probeShown)
+		}
+		return
+	}
+	start := b.engine.Hint
+	if threat {
+		start = b.engine.Threat
+	}
+	b.probe = nil
+	if err := start(); err != nil {
+		b.ShowMessage(err.Error())
+		return
+	}
+	b.probe = &shownProbe{fen: fen, threat: threat, step: 1}
+}
+
+// updateProbe shows the hint or threat once the engine has found it,
+// until its time is up or the position changes
+func (b *Board) updateProbe() {
+	if p := b.probe; p != nil && (p.fen != b.engine.FEN() || b.editor != nil) {
+		b.probe = nil
+	}
+	p, shown := b.probe, false
+	result, found := b.engine.Probe()
+	if p != nil && found && result.Threat == p.threat {
+		if p.until.IsZero() {
+			p.until = time.Now().Add(probeShown)
+		}
+		shown = time.Now().Before(p.until)
+	}
+	if shown && p.threat {
+		b.threatArrow.UpdateByIndex(result.Move.From, result.Move.To, b.colors.Threat())
+	} else {
+		b.threatArrow.Hide()
+	}
+	hint := shown && !p.threat
+	b.showHint(b.hint[0], hint, result.Move.From)
+	b.showHint(b.hint[1], hint && p.step > 1, result.Move.To)
+}
+
+// showHint shows or hides a square of the hint, redrawing the
+// highlights when it changes
+func (b *Board) showHint(h *highlighers.Highlight, show bool, index uint8) {
+	switch {
+	case show && (!h.IsVisible() || h.Index() != index):
+		h.UpdateByIndex(index)
+		b.rehighlight = true
+	case !show && h.IsVisible():
+		h.Hide()
+		b.rehighlight = true
+	}
+}
@@ -0,0 +1,154 @@
+package textedit
+
+// Buffer is a line of text being typed, with a cursor and a selection.
+// The selection runs from the anchor to the cursor, and anything typed
+// replaces it
+type Buffer struct {
+	text   []rune
+	cursor int
+	anchor int
+}
+
+// Line is a line of wrapped text and the offset of its first rune
+type Line struct {
+	Start int
+	Text  string
+}
+
+// New returns a buffer holding the text, all of it selected so that
+// typing replaces it
+func New(text string) *Buffer {
+	b := &Buffer{}
+	b.SetText(text)
+	return b
+}
+
+// SetText replaces the text, selecting all of it
+func (b *Buffer) SetText(text string) {
+	b.text = []rune(text)
+	b.SelectAll()
+}
+
+func (b *Buffer) String() string {
+	return string(b.text)
+}
+
+func (b *Buffer) Cursor() int {
+	return b.cursor
+}
+
+// Selection returns the start and end offsets of the selected text,
+// which are the same when nothing is selected
+func (b *Buffer) Selection() (int, int) {
+	return min(b.anchor, b.cursor), max(b.anchor, b.cursor)
+}
+
+// Selected returns the selected text
+func (b *Buffer) Selected() string {
+	start, end := b.Selection()
+	return string(b.text[start:end])
+}
+
+func (b *Buffer) SelectAll() {
+	b.anchor, b.cursor = 0, len(b.text)
+}
+
+// Insert types text at the cursor, replacing any selection
+func (b *Buffer) Insert(text string) {
+	b.deleteSelection()
+	runes := []rune(text)
+	b.text = append(b.text[:b.cursor], append(runes, b.text[b.cursor:]...)...)
+	b.cursor += len(runes)
+	b.anchor = b.cursor
+}
+
+// Backspace deletes the selection, or the rune before the cursor
+func (b *Buffer) Backspace() {
+	if !b.deleteSelection() && b.cursor > 0 {
+		b.text = append(b.text[:b.cursor-1], b.text[b.cursor:]...)
+		b.cursor--
+		b.anchor = b.cursor
+	}
+}
+
+// Delete deletes the selection, or the rune after the cursor
+func (b *Buffer) Delete() {
+	if !b.deleteSelection() && b.cursor < len(b.text) {
+		b.text = append(b.text[:b.cursor], b.text[b.cursor+1:]...)
+	}
+}
+
+// The cursor movements extend the selection when extend is set, and
+// otherwise clear it
+
+func (b *Buffer) Left(extend bool) {
+	if start, end := b.Selection(); !extend && start != end {
+		b.moveTo(start, false)
+		return
+	}
+	b.moveTo(b.cursor-1, extend)
+}
+
+func (b *Buffer) Right(extend bool) {
+	if start, end := b.Selection(); !extend && start != end {
+		b.moveTo(end, false)
+		return
+	}
+	b.moveTo(b.cursor+1, extend)
+}
+
+func (b *Buffer) Home(extend bool) {
+	b.moveTo(0, extend)
+}
+
+func (b *Buffer) End(extend bool) {
+	b.moveTo(len(b.text), extend)
+}
+
+// Wrap splits the text into lines of at most width runes, breaking at
+// newlines and, where it can, after spaces
+func (b *Buffer) Wrap(width int) []Line {
+	width = max(1, width)
+	var lines []Line
+	start := 0
+	for start <= len(b.text) {
+		end := start
+		for end < len(b.text) && end-start < width && b.text[end] != '\n' {
+			end++
+		}
+		next := end
+		switch {
+		case end < len(b.text) && b.text[end] == '\n':
+			next = end + 1
+		case end < len(b.text):
+			for space := end; space > start; space-- {
+				if b.text[space-1] == ' ' {
+					end, next = space, space
+					break
+				}
+			}
+		case end == len(b.text):
+			next = end + 1
+		}
+		lines = append(lines, Line{Start: start, Text: string(b.text[start:end])})
+		start = next
+	}
+	return lines
+}
+
+func (b *Buffer) moveTo(cursor int, extend bool) {
+	b.cursor = max(0, min(len(b.text), cursor))
+	if !extend {
+		b.anchor = b.cursor
+	}
+}
+
+func (b *Buffer) deleteSelection() bool {
+	start, end := b.Selection()
+	if start == end {
+		return false
+	}
+	b.text = append(b.text[:start], b.text[end:]...)
+	b.cursor, b.anchor = start, start
+	return true
+}
@@ -0,0 +1,126 @@
+package textedit
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBuffer_Edit(t *testing.T) {
+	tests := map[string]struct {
+		text     string
+		edit     func(b *Buffer)
+		expected string
+		cursor   int
+		selected string
+	}{
+		"typing replaces the text": {
+			text:     "8/8/8/8/8/8/8/8 w - - 0 1",
+			edit:     func(b *Buffer) { b.Insert("abc") },
+			expected: "abc",
+			cursor:   3,
+		},
+		"type at the cursor": {
+			text: "e4 Nf3",
+			edit: func(b *Buffer) {
+				b.Home(false)
+				b.Right(false)
+				b.Right(false)
+				b.Insert(" e5")
+			},
+			expected: "e4 e5 Nf3",
+			cursor:   5,
+		},
+		"backspace": {
+			text: "abc",
+			edit: func(b *Buffer) {
+				b.Right(false)
+				b.Backspace()
+				b.Home(false)
+				b.Backspace()
+			},
+			expected: "ab",
+		},
+		"delete": {
+			text: "abc",
+			edit: func(b *Buffer) {
+				b.Home(false)
+				b.Delete()
+				b.End(false)
+				b.Delete()
+			},
+			expected: "bc",
+			cursor:   2,
+		},
+		"extend the selection": {
+			text: "abcdef",
+			edit: func(b *Buffer) {
+				b.Home(false)
+				b.Right(false)
+				b.Right(true)
+				b.Right(true)
+			},
+			expected: "abcdef",
+			cursor:   3,
+			selected: "bc",
+		},
+		"delete the selection": {
+			text: "abcdef",
+			edit: func(b *Buffer) {
+				b.End(false)
+				b.Left(true)
+				b.Left(true)
+				b.Backspace()
+			},
+			expected: "abcd",
+			cursor:   4,
+		},
+		"moving collapses the selection": {
+			text:     "abcdef",
+			edit:     func(b *Buffer) { b.Left(false) },
+			expected: "abcdef",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			b := New(test.text)
+			test.edit(b)
+			assert.Equal(tt, test.expected, b.String())
+			assert.Equal(tt, test.cursor, b.Cursor())
+			assert.Equal(tt, test.selected, b.Selected())
+		})
+	}
+}
+
+func TestBuffer_Wrap(t *testing.T) {
+	tests := map[string]struct {
+		text     string
+		width    int
+		expected []Line
+	}{
+		"empty": {
+			text:     "",
+			width:    10,
+			expected: []Line{{0, ""}},
+		},
+		"break after spaces": {
+			text:     "1. e4 e5 2. Nf3 Nc6",
+			width:    9,
+			expected: []Line{{0, "1. e4 e5 "}, {9, "2. Nf3 "}, {16, "Nc6"}},
+		},
+		"break long words": {
+			text:     "rnbqkbnr/pppppppp",
+			width:    8,
+			expected: []Line{{0, "rnbqkbnr"}, {8, "/ppppppp"}, {16, "p"}},
+		},
+		"newlines": {
+			text:     "[Event \"?\"]\n\n1. e4\n",
+			width:    20,
+			expected: []Line{{0, "[Event \"?\"]"}, {12, ""}, {13, "1. e4"}, {19, ""}},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			assert.Equal(tt, test.expected, New(test.text).Wrap(test.width))
+		})
+	}
+}
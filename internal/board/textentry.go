@@ -0,0 +1,213 @@
+package board
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+	"golang.design/x/clipboard"
+	"image/color"
+	"strings"
+	"sync"
+	"us.figge.chess/internal/board/textedit"
+	"us.figge.chess/internal/pgn"
+)
+
+const (
+	charWidth      = 6
+	lineHeight     = 16
+	textMargin     = 8
+	repeatDelay    = 30
+	repeatInterval = 3
+	blinkTicks     = 30
+)
+
+var (
+	overlayColor  = &color.RGBA{R: 0x00, G: 0x00, B: 0x00, A: 0xe0}
+	clipboardInit = sync.OnceValue(clipboard.Init)
+)
+
+// textEntry is the overlay that shows the FEN or PGN of the game as
+// text to copy, and loads a FEN or PGN typed over it
+type textEntry struct {
+	*textedit.Buffer
+	title   string
+	ticks   int
+	opening bool
+}
+
+// ShowFEN opens the text overlay holding the FEN of the position
+func (b *Board) ShowFEN() {
+	b.openText("FEN", b.engine.FEN())
+}
+
+// ShowPGN opens the text overlay holding the PGN of the game
+func (b *Board) ShowPGN() {
+	var sb strings.Builder
+	if err := pgn.Write(&sb, b.engine.Record()); err != nil {
+		b.ShowMessage(err.Error())
+		return
+	}
+	b.openText("PGN", sb.String())
+}
+
+// IsTyping reports whether the text overlay or move prompt has the
+// keyboard
+func (b *Board) IsTyping() bool {
+	return b.text != nil || b.prompt != nil
+}
+
+func (b *Board) openText(title, text string) {
+	if b.text != nil || b.prompt != nil || b.editor != nil || b.selector.IsDragging() {
+		return
+	}
+	b.text = &textEntry{Buffer: textedit.New(text), title: title, opening: true}
+	b.ShowMessage("")
+}
+
+func (b *Board) closeText() {
+	b.text = nil
+	b.ShowMessage("")
+}
+
+// updateText edits the text with the keyboard. Enter loads the text,
+// Shift+Enter starts a new line, Escape closes the overlay, Ctrl+C
+// copies the selected text, or all of it, and Ctrl+V pastes
+func (b *Board) updateText() {
+	t := b.text
+	if t.opening {
+		// the key that opened the overlay is typed the same frame
+		t.opening = false
+		return
+	}
+	t.ticks++
+	shift := ebiten.IsKeyPressed(ebiten.KeyShift)
+	command := ebiten.IsKeyPressed(ebiten.KeyControl) || ebiten.IsKeyPressed(ebiten.KeyMeta)
+	enter := inpututil.IsKeyJustPressed(ebiten.KeyEnter) || inpututil.IsKeyJustPressed(ebiten.KeyNumpadEnter)
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyEscape):
+		b.closeText()
+		return
+	case enter && shift:
+		t.Insert("\n")
+	case enter:
+		if err := b.loadText(t.String()); err != nil {
+			b.ShowMessage(err.Error())
+			return
+		}
+		b.closeText()
+		return
+	case command && inpututil.IsKeyJustPressed(ebiten.KeyA):
+		t.SelectAll()
+	case command && inpututil.IsKeyJustPressed(ebiten.KeyC):
+		text := t.Selected()
+		if text == "" {
+			text = t.String()
+		}
+		if err := clipboardInit(); err != nil {
+			b.ShowMessage("Clipboard unavailable: " + err.Error())
+			return
+		}
+		clipboard.Write(clipboard.FmtText, []byte(text))
+		b.ShowMessage("Copied")
+	case command && inpututil.IsKeyJustPressed(ebiten.KeyV):
+		if err := clipboardInit(); err != nil {
+			b.ShowMessage("Clipboard unavailable: " + err.Error())
+			return
+		}
+		t.Insert(strings.ReplaceAll(string(clipboard.Read(clipboard.FmtText)), "\r\n", "\n"))
+	case !editBuffer(t.Buffer, shift, command):
+		return
+	}
+	t.ticks = 0
+}
+
+// editBuffer edits text with the keys pressed that type, delete and
+// move the cursor, and reports whether there were any
+func editBuffer(t *textedit.Buffer, shift, command bool) bool {
+	switch {
+	case repeating(ebiten.KeyBackspace):
+		t.Backspace()
+	case repeating(ebiten.KeyDelete):
+		t.Delete()
+	case repeating(ebiten.KeyLeft):
+		t.Left(shift)
+	case repeating(ebiten.KeyRight):
+		t.Right(shift)
+	case inpututil.IsKeyJustPressed(ebiten.KeyHome):
+		t.Home(shift)
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnd):
+		t.End(shift)
+	case !command:
+		chars := ebiten.AppendInputChars(nil)
+		if len(chars) == 0 {
+			return false
+		}
+		t.Insert(string(chars))
+	default:
+		return false
+	}
+	return true
+}
+
+// loadText loads a PGN, told apart by its tags and move numbers, or
+// else a FEN, into the engine and onto the board
+func (b *Board) loadText(text string) error {
+	text = strings.TrimSpace(text)
+	if strings.ContainsAny(text, "[.") {
+		g, err := pgn.NewReader(strings.NewReader(text)).Next()
+		if err != nil {
+			return err
+		}
+		if err = b.engine.LoadGame(g); err != nil {
+			return err
+		}
+	} else if err := b.engine.SetFEN(text); err != nil {
+		return err
+	}
+	b.positionChanged()
+	return nil
+}
+
+// repeating reports whether a key has just been pressed, or has been
+// held long enough to repeat
+func repeating(key ebiten.Key) bool {
+	d := inpututil.KeyPressDuration(key)
+	return d == 1 || d >= repeatDelay && (d-repeatDelay)%repeatInterval == 0
+}
+
+// drawText draws the overlay across the board, scrolled to keep the
+// cursor in view
+func (b *Board) drawText(screen *ebiten.Image) {
+	t := b.text
+	size := float32(b.squareSize * 8)
+	vector.DrawFilledRect(screen, 0, 0, size, size, overlayColor, false)
+	top := messageHeight + textMargin
+	ebitenutil.DebugPrintAt(screen, t.title+"   Enter: load  Esc: close  Ctrl+C: copy  Ctrl+V: paste", textMargin, top)
+	top += lineHeight + textMargin
+
+	lines := t.Wrap((b.squareSize*8 - 2*textMargin) / charWidth)
+	visible := (b.squareSize*8 - top - textMargin) / lineHeight
+	cursorLine := 0
+	for i, line := range lines {
+		if line.Start <= t.Cursor() {
+			cursorLine = i
+		}
+	}
+	first := max(0, cursorLine-visible+1)
+	start, end := t.Selection()
+	for i := first; i < len(lines) && i < first+visible; i++ {
+		line := lines[i]
+		y := top + (i-first)*lineHeight
+		length := len([]rune(line.Text))
+		if from, to := max(start, line.Start), min(end, line.Start+length); from < to {
+			x := textMargin + (from-line.Start)*charWidth
+			vector.DrawFilledRect(screen, float32(x), float32(y), float32((to-from)*charWidth), lineHeight, b.colors.Valid(), false)
+		}
+		ebitenutil.DebugPrintAt(screen, line.Text, textMargin, y)
+		if i == cursorLine && (t.ticks/blinkTicks)%2 == 0 {
+			x := textMargin + (t.Cursor()-line.Start)*charWidth
+			vector.DrawFilledRect(screen, float32(x), float32(y), 1, lineHeight, b.colors.PlayerWhite(), false)
+		}
+	}
+}
@@ -104,16 +104,26 @@ func FtoN(file uint8) string {
 	return string(notation[file-1])
 }
 
-func XYtoRF(x, y, squareSize int) (uint8, uint8, bool) {
-	rank := uint8(8 - (y)/squareSize)
-	file := uint8((x)/squareSize + 1)
-	if x < 1 || y < 3 || rank < 1 || rank > 8 || file < 1 || file > 8 {
+// XYtoRF returns the square under a point on the board, which has
+// white at the bottom unless it is flipped
+func XYtoRF(x, y, squareSize int, flipped bool) (uint8, uint8, bool) {
+	if x < 1 || y < 3 || x >= squareSize*8 || y >= squareSize*8 {
 		return 0, 0, false
 	}
+	rank := uint8(8 - y/squareSize)
+	file := uint8(x/squareSize + 1)
+	if flipped {
+		rank, file = 9-rank, 9-file
+	}
 	return rank, file, true
 }
 
-func RFtoXY(rank, file uint8, squareSize int) (int, int) {
+// RFtoXY returns the top left corner of a square on the board, which
+// has white at the bottom unless it is flipped
+func RFtoXY(rank, file uint8, squareSize int, flipped bool) (int, int) {
+	if flipped {
+		rank, file = 9-rank, 9-file
+	}
 	return int(file-1) * squareSize, int(8-rank) * squareSize
 }
 
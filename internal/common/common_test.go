@@ -188,3 +188,55 @@ func TestPTtoBB(t *testing.T) {
 		})
 	}
 }
+
+func TestXYtoRF(t *testing.T) {
+	tests := map[string]struct {
+		x, y    int
+		flipped bool
+		rank    uint8
+		file    uint8
+		ok      bool
+	}{
+		"top-left":             {5, 5, false, 8, 1, true},
+		"bottom-right":         {79, 79, false, 1, 8, true},
+		"flipped top-left":     {5, 5, true, 1, 8, true},
+		"flipped bottom-right": {79, 79, true, 8, 1, true},
+		"flipped e2":           {35, 15, true, 2, 5, true},
+		"right of board":       {80, 10, false, 0, 0, false},
+		"below board":          {10, 80, true, 0, 0, false},
+		"left of board":        {-5, 10, true, 0, 0, false},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			rank, file, ok := XYtoRF(test.x, test.y, 10, test.flipped)
+			assert.Equal(tt, test.ok, ok)
+			assert.Equal(tt, test.rank, rank)
+			assert.Equal(tt, test.file, file)
+		})
+	}
+}
+
+func TestRFtoXY(t *testing.T) {
+	tests := map[string]struct {
+		rank, file uint8
+		flipped    bool
+		x, y       int
+	}{
+		"a8":         {8, 1, false, 0, 0},
+		"h1":         {1, 8, false, 70, 70},
+		"flipped a8": {8, 1, true, 70, 70},
+		"flipped h1": {1, 8, true, 0, 0},
+		"flipped e2": {2, 5, true, 30, 10},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			x, y := RFtoXY(test.rank, test.file, 10, test.flipped)
+			assert.Equal(tt, test.x, x)
+			assert.Equal(tt, test.y, y)
+			rank, file, ok := XYtoRF(x+5, y+5, 10, test.flipped)
+			assert.True(tt, ok)
+			assert.Equal(tt, test.rank, rank)
+			assert.Equal(tt, test.file, file)
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+	"us.figge.chess/internal/engine/uci"
+	"us.figge.chess/internal/engine/xboard"
+)
+
+// Protocols spoken by external engines
+const (
+	ProtocolUCI    = "uci"
+	ProtocolXBoard = "xboard"
+)
+
+// Adapter is the interface Engine uses to drive an external chess
+// engine, whichever protocol the engine speaks
+type Adapter interface {
+	Name() string
+	SetOptions(opt uci.Options) error
+	SetPosition(fen string, moves string) error
+	Go(depth int, searchmoves string, movetime int64, resultOpts ...uint) (*uci.Results, error)
+	GoClock(clock uci.Clock, resultOpts ...uint) (*uci.Results, error)
+	Analyse(lines int, stop <-chan struct{}, update func(lines []uci.ScoreResult)) error
+	Close()
+}
+
+var (
+	_ Adapter = (*uci.Supervisor)(nil)
+	_ Adapter = (*xboard.Engine)(nil)
+)
+
+// engineAdapter returns the external engine, launching it and setting
+// its options the first time it is needed
+func (e *Engine) engineAdapter() (Adapter, error) {
+	if e.adapter != nil {
+		return e.adapter, nil
+	}
+	adapter, err := e.startAdapter(e.transcript)
+	if err != nil {
+		return nil, err
+	}
+	err = adapter.SetOptions(e.engineOptions)
+	if err != nil {
+		adapter.Close()
+		return nil, fmt.Errorf("error setting engine options: %w", err)
+	}
+	e.adapter = adapter
+	return adapter, nil
+}
+
+// fullStrengthAdapter returns the external engine that searches at
+// full strength, whatever the strength of the engine playing the game,
+// launching it the first time it is needed
+func (e *Engine) fullStrengthAdapter() (Adapter, error) {
+	if e.fullAdapter != nil {
+		return e.fullAdapter, nil
+	}
+	adapter, err := e.startAdapter(e.transcript.Tagged("full"))
+	if err != nil {
+		return nil, err
+	}
+	options := e.engineOptions
+	options.MultiPV, options.Elo = 1, 0
+	err = adapter.SetOptions(options)
+	if err != nil {
+		adapter.Close()
+		return nil, fmt.Errorf("error setting engine options: %w", err)
+	}
+	e.fullAdapter = adapter
+	return adapter, nil
+}
+
+// Search asks the external engine, at full strength, for the best move
+// in the position reached by playing the moves, in UCI notation, from
+// the FEN. It searches to the depth or for the movetime, whichever
+// comes first
+func (e *Engine) Search(fen, moves string, depth int, movetime time.Duration) (*uci.Results, error) {
+	adapter, err := e.fullStrengthAdapter()
+	if err != nil {
+		return nil, err
+	}
+	err = adapter.SetPosition(fen, moves)
+	if err != nil {
+		return nil, fmt.Errorf("error setting position: %w", err)
+	}
+	return adapter.Go(depth, "", movetime.Milliseconds())
+}
+
+// startAdapter launches the external engine, recording it to the
+// transcript, and completes the handshake for its protocol. A UCI
+// engine is supervised and restarted if it dies or hangs. An XBoard
+// engine isn't: its errors end the search, and the engine is launched
+// again only for a new Engine
+func (e *Engine) startAdapter(transcript *uci.Transcript) (Adapter, error) {
+	switch e.protocol {
+	case ProtocolXBoard:
+		adapter, err := xboard.NewEngine(e.enginePath, e.engineArgs...)
+		if err != nil {
+			return nil, err
+		}
+		adapter.SetTranscript(transcript)
+		err = adapter.XBoard()
+		if err != nil {
+			adapter.Close()
+			return nil, err
+		}
+		return adapter, nil
+	case ProtocolUCI:
+		adapter := uci.NewSupervisor(e.enginePath, e.engineArgs...)
+		adapter.SetTranscript(transcript)
+		err := adapter.Start()
+		if err != nil {
+			return nil, err
+		}
+		return adapter, nil
+	}
+	return nil, fmt.Errorf("unknown engine protocol %q", e.protocol)
+}
@@ -0,0 +1,181 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+	. "us.figge.chess/internal/common"
+	"us.figge.chess/internal/engine/uci"
+	"us.figge.chess/internal/pgn"
+)
+
+const defaultAnalysisLines = 3
+
+// AnalysisLine is a line the external engine has found in the position
+// it is analysing, scored from white's point of view
+type AnalysisLine struct {
+	Depth          int
+	Score          int  // centipawns, or moves to mate if Mate is true
+	Mate           bool // whether the line forces mate
+	Nodes          int
+	NodesPerSecond int
+	Moves          []string // the principal variation in SAN
+	UCI            []string // the same moves in UCI long algebraic notation
+}
+
+// analysis is a search of a position running in the background until
+// it is stopped, with the lines the engine last reported
+type analysis struct {
+	fen     string
+	stop    chan struct{}
+	done    chan struct{}
+	stopped bool
+	mutex   sync.Mutex
+	lines   []AnalysisLine
+	err     error
+}
+
+// SetEngineAnalysis switches the external engine analysing the position
+// on the board on or off. It analyses while no computer player is to
+// move, starting again each time the position changes
+func (e *Engine) SetEngineAnalysis(on bool) {
+	e.engineAnalysis = on
+}
+
+// IsEngineAnalysing reports whether engine analysis is switched on
+func (e *Engine) IsEngineAnalysing() bool {
+	return e.engineAnalysis
+}
+
+// AnalysisLines returns how many lines engine analysis asks for
+func (e *Engine) AnalysisLines() int {
+	return max(1, e.analysisLines)
+}
+
+// Analysis returns the lines the external engine has found so far in
+// the position on the board, best first, and whether it is analysing
+// the position
+func (e *Engine) Analysis() ([]AnalysisLine, bool) {
+	a := e.analysis
+	if a == nil || a.stopped || a.fen != e.FEN() {
+		return nil, false
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.lines, true
+}
+
+// updateAnalysis keeps the external engine, at full strength rather
+// than the opponent's, analysing the position on the board while analysis is on and no player needs the engine. The
+// search of a position that has gone is stopped, and the search of the
+// one that replaced it started once the engine has stopped
+func (e *Engine) updateAnalysis() error {
+	fen := e.FEN()
+	wanted := e.engineAnalysis && e.thinking == nil && !e.computerToMove()
+	if a := e.analysis; a != nil {
+		select {
+		case <-a.done:
+			e.analysis = nil
+			if a.err != nil {
+				e.engineAnalysis = false
+				return fmt.Errorf("analysis: %w", a.err)
+			}
+		default:
+			if !wanted || a.fen != fen {
+				a.halt()
+			}
+			return nil
+		}
+	}
+	if !wanted {
+		return nil
+	}
+	adapter, err := e.fullStrengthAdapter()
+	if err != nil {
+		e.engineAnalysis = false
+		return fmt.Errorf("analysis: %w", err)
+	}
+	e.analysis = newAnalysis(adapter, e.position.Clone(), e.history(), e.analysisLines)
+	return nil
+}
+
+// newAnalysis starts the engine searching the position, reached by
+// the history, in the background for the number of lines
+func newAnalysis(adapter Adapter, position *Position, history History, lines int) *analysis {
+	a := &analysis{
+		fen:  position.GenerateFen(),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(a.done)
+		err := adapter.SetPosition(history.FEN, history.Moves)
+		if err == nil {
+			err = adapter.Analyse(lines, a.stop, func(results []uci.ScoreResult) {
+				lines := position.analysisLines(results)
+				a.mutex.Lock()
+				defer a.mutex.Unlock()
+				a.lines = lines
+			})
+		}
+		a.err = err
+	}()
+	return a
+}
+
+// halt asks the engine to stop searching, if it hasn't been already
+func (a *analysis) halt() {
+	if !a.stopped {
+		a.stopped = true
+		close(a.stop)
+	}
+}
+
+// stopAnalysis stops any search running and waits for the engine to
+// finish with it
+func (e *Engine) stopAnalysis() {
+	if e.analysis != nil {
+		e.analysis.halt()
+		<-e.analysis.done
+		e.analysis = nil
+	}
+}
+
+// Evaluation returns the latest score of the position on the board,
+// from white's point of view: the best line of the engine's analysis,
+// or else the evaluation recorded with the move that reached it
+func (e *Engine) Evaluation() (score int, mate bool, ok bool) {
+	if lines, ok := e.Analysis(); ok && len(lines) > 0 {
+		return lines[0].Score, lines[0].Mate, true
+	}
+	return pgn.ParseEval(e.tree.Current().Eval)
+}
+
+// analysisLines turns the engine's results into lines in SAN scored
+// from white's point of view. A line is cut short at any move that
+// isn't legal, as from an engine that has moved on to another position
+func (p *Position) analysisLines(results []uci.ScoreResult) []AnalysisLine {
+	lines := make([]AnalysisLine, 0, len(results))
+	for _, result := range results {
+		line := AnalysisLine{
+			Depth:          result.Depth,
+			Score:          result.Score,
+			Mate:           result.Mate,
+			Nodes:          result.Nodes,
+			NodesPerSecond: result.NodesPerSecond,
+		}
+		if p.Turn() == PlayerBlack {
+			line.Score = -line.Score
+		}
+		position := p.Clone()
+		for _, text := range result.BestMoves {
+			move, ok := position.ParseMove(text)
+			if !ok {
+				break
+			}
+			line.Moves = append(line.Moves, position.Play(move))
+			line.UCI = append(line.UCI, text)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,56 @@
+package engine
+
+import (
+	"slices"
+	. "us.figge.chess/internal/common"
+	"us.figge.chess/internal/pgn"
+)
+
+// Annotations returns the arrows and circles drawn in the position
+// shown
+func (e *Engine) Annotations() pgn.Annotations {
+	return e.tree.Current().Annotations
+}
+
+// ToggleArrow draws an arrow in the colour between two squares of the
+// position shown. An arrow already drawn there is removed when it has
+// the same colour and recoloured when it doesn't
+func (e *Engine) ToggleArrow(from, to uint8, colour byte) {
+	if from == to {
+		return
+	}
+	n := e.tree.Current()
+	n.Arrows = toggleAnnotation(n.Arrows, squareName(from)+squareName(to), colour)
+}
+
+// ToggleCircle circles a square of the position shown in the colour,
+// the same way ToggleArrow draws arrows
+func (e *Engine) ToggleCircle(square uint8, colour byte) {
+	n := e.tree.Current()
+	n.Circles = toggleAnnotation(n.Circles, squareName(square), colour)
+}
+
+// ClearAnnotations removes the arrows and circles from the position
+// shown
+func (e *Engine) ClearAnnotations() {
+	e.tree.Current().Annotations = pgn.Annotations{}
+}
+
+// toggleAnnotation returns the annotations with one toggled, leaving
+// the slice given as it was
+func toggleAnnotation(annotations []string, squares string, colour byte) []string {
+	annotations = slices.Clone(annotations)
+	i := slices.IndexFunc(annotations, func(a string) bool { return a[1:] == squares })
+	switch {
+	case i < 0:
+		return append(annotations, string(colour)+squares)
+	case annotations[i][0] == colour:
+		return slices.Delete(annotations, i, i+1)
+	}
+	annotations[i] = string(colour) + squares
+	return annotations
+}
+
+func squareName(index uint8) string {
+	return RFtoN(ItoRF(index))
+}
@@ -0,0 +1,203 @@
+package engine
+
+import (
+	. "us.figge.chess/internal/common"
+)
+
+// Editor sets up a position by hand. The position may be invalid while
+// it is being edited, Validate checks it before play starts from it.
+// Castling rights and the en passant square are kept to those the
+// pieces allow, so moving a king or rook gives up its castling rights
+type Editor struct {
+	position *Position
+}
+
+// NewEditor starts editing an empty board with white to move
+func NewEditor() *Editor {
+	ed := &Editor{}
+	ed.Clear()
+	return ed
+}
+
+// Editor starts editing the position on the board
+func (e *Engine) Editor() *Editor {
+	return &Editor{position: e.position.Clone()}
+}
+
+// Clear removes every piece, leaving white to move on move 1
+func (ed *Editor) Clear() {
+	ed.position = &Position{halfMoves: make([]uint64, 0), fullMoves: 1}
+}
+
+// SetFEN replaces the position being edited with a valid FEN, or the
+// standard starting position when the FEN is empty
+func (ed *Editor) SetFEN(fen string) error {
+	if fen == "" {
+		fen = startPositionFEN
+	}
+	position, err := ParseFEN(fen)
+	if err != nil {
+		return err
+	}
+	ed.position = position
+	return nil
+}
+
+// FEN returns the position being edited, whether valid or not
+func (ed *Editor) FEN() string {
+	return ed.position.GenerateFen()
+}
+
+// Validate reports why the position being edited can't be played
+// from, as a *FENError, or nil when it can
+func (ed *Editor) Validate() error {
+	_, err := ParseFEN(ed.FEN())
+	return err
+}
+
+// Boards returns the bitboards of the position being edited, as
+// Engine.GetBoards does for the game
+func (ed *Editor) Boards() []uint64 {
+	return append([]uint64(nil), ed.position.bitboards[:BitEnPassant]...)
+}
+
+// PieceAt returns the piece on the square index, if any
+func (ed *Editor) PieceAt(index uint8) (uint8, bool) {
+	return ed.position.identifyPiece(ItoB(index))
+}
+
+// Put places a piece on the square index, replacing any piece there
+func (ed *Editor) Put(index, pieceType uint8) {
+	rank, file := ItoRF(index)
+	ed.position.ClearSquare(rank, file)
+	ed.position.SetPiece(pieceType, rank, file)
+	ed.restrict()
+}
+
+// Remove takes any piece off the square index
+func (ed *Editor) Remove(index uint8) {
+	rank, file := ItoRF(index)
+	ed.position.ClearSquare(rank, file)
+	ed.restrict()
+}
+
+// Move moves the piece on one square to another, replacing any piece
+// there
+func (ed *Editor) Move(from, to uint8) {
+	pieceType, ok := ed.PieceAt(from)
+	if !ok || from == to {
+		return
+	}
+	rank, file := ItoRF(from)
+	ed.position.ClearSquare(rank, file)
+	ed.Put(to, pieceType)
+}
+
+func (ed *Editor) Turn() uint8 {
+	return ed.position.Turn()
+}
+
+// SetTurn sets the side to move, clearing the en passant square as
+// the pawn that could be captured belongs to the other side
+func (ed *Editor) SetTurn(turn uint8) {
+	ed.position.SetTurn(turn & PlayerMask)
+	ed.position.ClearEnPassant()
+}
+
+func (ed *Editor) CastleRights() uint8 {
+	return ed.position.CastleRights()
+}
+
+// ToggleCastling gives up a castling right, or grants it when the king
+// and rook are on their starting squares, returning whether it changed
+func (ed *Editor) ToggleCastling(right uint8) bool {
+	rights := ed.position.CastleRights()
+	if rights&right == 0 && !ed.position.canCastle(right) {
+		return false
+	}
+	ed.position.SetCastleRights(rights ^ right)
+	return true
+}
+
+// EnPassant returns the index of the en passant square, if there is one
+func (ed *Editor) EnPassant() (uint8, bool) {
+	ep := ed.position.EnPassant()
+	if ep == 0 {
+		return 0, false
+	}
+	return BtoI(ep), true
+}
+
+// EnPassantSquares returns the indexes of the squares the side to move
+// could capture en passant on, were a pawn to have just moved past them
+func (ed *Editor) EnPassantSquares() []uint8 {
+	target := uint8(6)
+	if ed.position.Turn() == PlayerBlack {
+		target = 3
+	}
+	var squares []uint8
+	for file := uint8(1); file <= 8; file++ {
+		if _, message := ed.position.Clone().readFenEnPassant(RFtoN(target, file)); message == "" {
+			squares = append(squares, RFtoI(target, file))
+		}
+	}
+	return squares
+}
+
+// CycleEnPassant moves the en passant square on to the next square it
+// could be on, or clears it after the last one. Setting it resets the
+// halfmove clock, as a pawn has just moved
+func (ed *Editor) CycleEnPassant() {
+	squares := ed.EnPassantSquares()
+	current, ok := ed.EnPassant()
+	ed.position.ClearEnPassant()
+	for _, index := range squares {
+		if !ok || index > current {
+			rank, file := ItoRF(index)
+			ed.position.SetEnPassant(rank, file)
+			ed.position.halfMoves = ed.position.halfMoves[:0]
+			return
+		}
+	}
+}
+
+func (ed *Editor) HalfMove() int {
+	return len(ed.position.halfMoves)
+}
+
+// SetHalfMove sets the halfmove clock, clearing the en passant square
+// when it is no longer zero
+func (ed *Editor) SetHalfMove(count int) {
+	count = max(0, count)
+	if count > 0 {
+		ed.position.ClearEnPassant()
+	}
+	ed.position.halfMoves = make([]uint64, count)
+}
+
+func (ed *Editor) FullMove() int {
+	return ed.position.fullMoves
+}
+
+// SetFullMove sets the fullmove number, which starts at 1
+func (ed *Editor) SetFullMove(number int) {
+	ed.position.fullMoves = max(1, number)
+}
+
+// restrict gives up the castling rights and en passant square the
+// pieces no longer allow
+func (ed *Editor) restrict() {
+	rights := ed.position.CastleRights()
+	for _, castling := range castlings {
+		if !ed.position.canCastle(castling.right) {
+			rights &^= castling.right
+		}
+	}
+	ed.position.SetCastleRights(rights)
+	if ep, ok := ed.EnPassant(); ok {
+		rank, file := ItoRF(ep)
+		if _, message := ed.position.Clone().readFenEnPassant(RFtoN(rank, file)); message != "" {
+			ed.position.ClearEnPassant()
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	. "us.figge.chess/internal/common"
+)
+
+func TestEditor(t *testing.T) {
+	tests := map[string]struct {
+		fen     string
+		edit    func(tt *testing.T, ed *Editor)
+		next    string
+		invalid string
+	}{
+		"clear": {
+			edit:    func(tt *testing.T, ed *Editor) { ed.Clear() },
+			next:    "8/8/8/8/8/8/8/8 w - - 0 1",
+			invalid: "white has 0 kings",
+		},
+		"put pieces": {
+			fen: "4k3/8/8/8/8/8/8/4K3 w - - 0 1",
+			edit: func(tt *testing.T, ed *Editor) {
+				ed.Put(squareIndex("a1"), PieceRook|PlayerWhite)
+				ed.Put(squareIndex("e8"), PieceQueen|PlayerBlack)
+				ed.Put(squareIndex("d8"), PieceKing|PlayerBlack)
+			},
+			next: "3kq3/8/8/8/8/8/8/R3K3 w - - 0 1",
+		},
+		"remove a king": {
+			edit:    func(tt *testing.T, ed *Editor) { ed.Remove(squareIndex("e8")) },
+			next:    "rnbq1bnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQ - 0 1",
+			invalid: "black has 0 kings",
+		},
+		"moving a rook gives up castling": {
+			edit: func(tt *testing.T, ed *Editor) { ed.Move(squareIndex("h1"), squareIndex("h4")) },
+			next: "rnbqkbnr/pppppppp/8/8/7R/8/PPPPPPPP/RNBQKBN1 w Qkq - 0 1",
+		},
+		"castling needs the king and rook": {
+			fen: "4k3/8/8/8/8/8/8/R3K3 w - - 0 1",
+			edit: func(tt *testing.T, ed *Editor) {
+				assert.False(tt, ed.ToggleCastling(CastleRightsWhiteKing))
+				assert.True(tt, ed.ToggleCastling(CastleRightsWhiteQueen))
+			},
+			next: "4k3/8/8/8/8/8/8/R3K3 w Q - 0 1",
+		},
+		"cycle en passant": {
+			fen: "4k3/8/8/2pPp3/8/8/8/4K3 w - - 5 30",
+			edit: func(tt *testing.T, ed *Editor) {
+				assert.Equal(tt, []uint8{squareIndex("c6"), squareIndex("e6")}, ed.EnPassantSquares())
+				ed.CycleEnPassant()
+				ed.CycleEnPassant()
+			},
+			next: "4k3/8/8/2pPp3/8/8/8/4K3 w - e6 0 30",
+		},
+		"cycle en passant off": {
+			fen:  "4k3/8/8/3Pp3/8/8/8/4K3 w - e6 0 30",
+			edit: func(tt *testing.T, ed *Editor) { ed.CycleEnPassant() },
+			next: "4k3/8/8/3Pp3/8/8/8/4K3 w - - 0 30",
+		},
+		"capturing the pawn clears en passant": {
+			fen:  "4k3/8/8/3Pp3/8/8/8/4K3 w - e6 0 30",
+			edit: func(tt *testing.T, ed *Editor) { ed.Remove(squareIndex("e5")) },
+			next: "4k3/8/8/3P4/8/8/8/4K3 w - - 0 30",
+		},
+		"halfmove clock clears en passant": {
+			fen: "4k3/8/8/3Pp3/8/8/8/4K3 w - e6 0 30",
+			edit: func(tt *testing.T, ed *Editor) {
+				ed.SetHalfMove(3)
+				ed.SetFullMove(0)
+			},
+			next: "4k3/8/8/3Pp3/8/8/8/4K3 w - - 3 1",
+		},
+		"side to move": {
+			fen:     "4k3/8/8/3Pp3/8/8/8/4K2r w - e6 0 30",
+			edit:    func(tt *testing.T, ed *Editor) { ed.SetTurn(PlayerBlack) },
+			next:    "4k3/8/8/3Pp3/8/8/8/4K2r b - - 0 30",
+			invalid: "the side not to move is in check",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			ed := NewEditor()
+			require.NoError(tt, ed.SetFEN(test.fen))
+			test.edit(tt, ed)
+			assert.Equal(tt, test.next, ed.FEN())
+			err := ed.Validate()
+			if test.invalid == "" {
+				assert.NoError(tt, err)
+				return
+			}
+			var fenErr *FENError
+			require.ErrorAs(tt, err, &fenErr)
+			assert.Equal(tt, test.invalid, fenErr.Message)
+		})
+	}
+}
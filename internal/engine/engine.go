@@ -1,64 +1,539 @@
 package engine
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"strings"
 	"time"
 	. "us.figge.chess/internal/common"
 	"us.figge.chess/internal/engine/uci"
+	"us.figge.chess/internal/engine/xboard"
+	"us.figge.chess/internal/game/clock"
+	"us.figge.chess/internal/game/tree"
+	"us.figge.chess/internal/pgn"
+)
+
+const (
+	defaultEnginePath = "/Users/jason/src/shell/commands/stockfish"
+	retryDelay        = 5 * time.Second
+)
+
+var (
+	// ErrOutOfTime is returned by Update when the flag of the player to
+	// move falls
+	ErrOutOfTime = errors.New("out of time")
+	// ErrGameOver is returned by Update when an engine resigns or
+	// claims a result
+	ErrGameOver = errors.New("game over")
 )
 
 type Engine struct {
-	position  *Position
-	stockfish *uci.Engine
-	fen       string
-	moves     string
-	cpuPlayer bool
+	position       *Position
+	players        [2]Player
+	playerKinds    [2]string
+	analysing      bool
+	adapter        Adapter
+	fullAdapter    Adapter
+	protocol       string
+	enginePath     string
+	engineArgs     []string
+	engineOptions  uci.Options
+	depth          int
+	movetime       time.Duration
+	transcript     *uci.Transcript // shared by the engines, so their lines don't interleave
+	fen            string
+	tree           *tree.Tree
+	path           []Move
+	tags           []pgn.Tag
+	comment        string
+	result         string
+	termination    string
+	clock          *clock.Clock
+	started        time.Time
+	thinking       chan choice
+	engineAnalysis bool
+	analysis       *analysis
+	analysisLines  int
+	probe          *probe
+	nextProbe      *probe
+	probeAdapter   Adapter
+	generation     int
+	retryAt        time.Time
 }
 
-func NewEngine() *Engine {
-	e := &Engine{
-		position: NewPosition(),
-	}
-	e.cpuPlayer = true
+// choice is the move chosen by a player thinking in the background
+type choice struct {
+	move       Move
+	err        error
+	generation int
+}
 
-	var err error
-	path := "/Users/jason/src/shell/commands/stockfish"
-	e.stockfish, err = uci.NewEngine(path)
-	if err != nil {
-		log.Fatalf("Error launching engine: %v\n", err)
-	}
-	err = e.stockfish.UCI()
-	if err != nil {
-		log.Fatalln("Error setting UCI mode:", err)
+// PlayedMove is a move that has been played, along with its SAN
+type PlayedMove struct {
+	Move
+	SAN string
+}
+
+func NewEngine(options ...Option) *Engine {
+	e := &Engine{
+		position:    NewPosition(),
+		playerKinds: [2]string{KindHuman, KindEngine},
+		protocol:    ProtocolUCI,
+		enginePath:  defaultEnginePath,
+		engineOptions: uci.Options{
+			MultiPV: 1,
+			Hash:    1024,
+			Ponder:  false,
+			OwnBook: true,
+			Threads: 6,
+			Elo:     800,
+		},
+		depth:         10,
+		movetime:      time.Second,
+		analysisLines: defaultAnalysisLines,
 	}
-	engineOptions := uci.Options{
-		MultiPV: 1,
-		Hash:    1024,
-		Ponder:  false,
-		OwnBook: true,
-		Threads: 6,
-		Elo:     800,
+	for _, option := range options {
+		option(e)
 	}
-	err = e.stockfish.SetOptions(engineOptions)
-	if err != nil {
-		log.Fatalln("Error setting engine options:", err)
+
+	_ = e.SetFEN("")
+	for i, kind := range e.playerKinds {
+		player, err := e.newPlayer(kind)
+		if err != nil {
+			log.Fatalf("Error creating %s player: %v\n", playerName(uint8(i)), err)
+		}
+		e.players[i] = player
 	}
 	return e
 }
 
-func (e *Engine) SetFEN(fen string) {
+// SetFEN starts a new game from the position, or from the standard
+// starting position when the FEN is empty. An invalid FEN returns a
+// *FENError and leaves the game as it was
+func (e *Engine) SetFEN(fen string) error {
 	fen = strings.TrimSpace(fen)
 	if fen == "" {
-		fen = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+		fen = startPositionFEN
 	}
-	e.fen = fen
-	e.position.SetupBoard(fen)
-	err := e.stockfish.SetFEN(fen)
+	position, err := ParseFEN(fen)
 	if err != nil {
-		log.Fatalf("Error setting FEN [%s]: %v\n", fen, err)
+		return err
+	}
+	e.position = position
+	e.fen = fen
+	e.tree = tree.New()
+	e.path = nil
+	e.tags = nil
+	e.comment = ""
+	e.result = ""
+	e.termination = ""
+	e.started = time.Now()
+	if e.clock != nil {
+		e.clock.Reset()
+	}
+	e.stopThinking()
+	return nil
+}
+
+// stopThinking forgets any move a player is choosing, as it would
+// be for a position that is no longer on the board. A player still
+// thinking is left to finish, and its move thrown away, before the
+// next is started so the external engine is asked one thing at a time
+func (e *Engine) stopThinking() {
+	e.generation++
+	e.retryAt = time.Time{}
+}
+
+// Tree returns the moves of the game and their variations
+func (e *Engine) Tree() *tree.Tree {
+	return e.tree
+}
+
+// Ply returns how many moves were played to reach the position on the
+// board, and how many moves the line it is on has in all
+func (e *Engine) Ply() (int, int) {
+	n := e.tree.Current()
+	ply := n.Ply()
+	end := ply
+	for ; len(n.Children()) > 0; n = n.Children()[0] {
+		end++
+	}
+	return ply, end
+}
+
+// LineMove is a move of the line through the position on the board,
+// with its move number and the player that made it
+type LineMove struct {
+	Node   *tree.Node
+	Number int
+	Player uint8
+}
+
+// Line returns the moves of the line through the position on the
+// board: those played to reach it and the mainline of those after it
+func (e *Engine) Line() []LineMove {
+	start, _ := ParseFEN(e.fen)
+	number, player := start.fullMoves, start.Turn()
+	n := e.tree.Current()
+	nodes := n.Path()
+	for len(n.Children()) > 0 {
+		n = n.Children()[0]
+		nodes = append(nodes, n)
+	}
+	line := make([]LineMove, 0, len(nodes))
+	for _, node := range nodes {
+		line = append(line, LineMove{Node: node, Number: number, Player: player})
+		if player == PlayerBlack {
+			number++
+		}
+		player = 1 - player
+	}
+	return line
+}
+
+// GotoPly shows the position after the given number of moves of the
+// line the position on the board is on. The players don't move until
+// the end of the line is shown
+func (e *Engine) GotoPly(ply int) {
+	n := e.tree.Current()
+	for n.Ply() > ply && n.Parent() != nil {
+		n = n.Parent()
+	}
+	for n.Ply() < ply && len(n.Children()) > 0 {
+		n = n.Children()[0]
+	}
+	e.GotoNode(n)
+}
+
+// GotoNode shows the position reached by a move of the game tree
+func (e *Engine) GotoNode(n *tree.Node) {
+	e.tree.Goto(n)
+	_ = e.position.SetupBoard(e.fen)
+	e.path = e.path[:0]
+	for _, node := range n.Path() {
+		move, _ := e.position.ParseMove(node.Move)
+		e.position.apply(move)
+		e.path = append(e.path, move)
+	}
+	e.stopThinking()
+}
+
+// Takeback steps back to the last position a human was to move in,
+// taking back the moves replied to it. The moves stay in the game to
+// Redo, until a different move is played. It returns false at the
+// start of the game
+func (e *Engine) Takeback() bool {
+	n, turn := e.tree.Current(), e.Turn()
+	if n.Parent() == nil {
+		return false
+	}
+	for n.Parent() != nil {
+		n, turn = n.Parent(), 1-turn
+		if e.isStop(turn) {
+			break
+		}
+	}
+	e.GotoNode(n)
+	return true
+}
+
+// Redo plays forward the moves taken back, along the line the position
+// is on, to the next position a human is to move in. It returns false
+// at the end of the line
+func (e *Engine) Redo() bool {
+	n, turn := e.tree.Current(), e.Turn()
+	if len(n.Children()) == 0 {
+		return false
+	}
+	for len(n.Children()) > 0 {
+		n, turn = n.Children()[0], 1-turn
+		if e.isStop(turn) {
+			break
+		}
+	}
+	e.GotoNode(n)
+	return true
+}
+
+// PromoteVariation moves the variation the position on the board is on
+// one place up among its siblings, making it the mainline when it is
+// first. It returns false on the mainline. The result of a loaded game
+// is dropped once its mainline changes
+func (e *Engine) PromoteVariation() bool {
+	if !e.tree.Current().Promote() {
+		return false
+	}
+	if e.tree.Current().IsMainline() {
+		e.result = ""
+		e.termination = ""
+	}
+	return true
+}
+
+// DeleteFromHere removes the move the position on the board was
+// reached by, and every move after it, and shows the position before
+// it. At the start of the game every move is removed. It returns false
+// when there is nothing to remove. The result of a loaded game is
+// dropped once its mainline changes
+func (e *Engine) DeleteFromHere() bool {
+	n := e.tree.Current()
+	if n.Parent() == nil && len(n.Children()) == 0 {
+		return false
+	}
+	if n.IsMainline() {
+		e.result = ""
+		e.termination = ""
+	}
+	e.tree.Delete(n)
+	e.GotoNode(e.tree.Current())
+	return true
+}
+
+// isStop reports whether Takeback and Redo stop at a position with
+// the player to move, a human or, with no human playing, any player
+func (e *Engine) isStop(turn uint8) bool {
+	white, black := e.Player(PlayerWhite).IsHuman(), e.Player(PlayerBlack).IsHuman()
+	return e.Player(turn).IsHuman() || !white && !black
+}
+
+// history returns how the position on the board was reached, for the
+// external engine
+func (e *Engine) history() History {
+	h := History{}
+	if e.fen != startPositionFEN {
+		h.FEN = e.fen
+	}
+	moves := make([]string, len(e.path))
+	for i, move := range e.path {
+		moves[i] = move.String()
+	}
+	h.Moves = strings.Join(moves, " ")
+	return h
+}
+
+// LastMove returns the move that reached the position on the board
+func (e *Engine) LastMove() (Move, bool) {
+	if len(e.path) == 0 {
+		return Move{}, false
 	}
+	return e.path[len(e.path)-1], true
+}
+
+func (e *Engine) Close() {
+	e.stopAnalysis()
+	e.stopProbe()
+	if e.adapter != nil {
+		e.adapter.Close()
+	}
+	if e.fullAdapter != nil {
+		e.fullAdapter.Close()
+	}
+}
+
+// Player returns the player for white or black, a human for either
+// side while analysing
+func (e *Engine) Player(player uint8) Player {
+	if e.analysing {
+		return analyst
+	}
+	return e.players[player&PlayerMask]
+}
+
+// PlayAs starts a new game with a lone human player on the side given,
+// swapping the players over when they are the other way round
+func (e *Engine) PlayAs(player uint8) {
+	player &= PlayerMask
+	if !e.players[player].IsHuman() && e.players[1-player].IsHuman() {
+		e.players[0], e.players[1] = e.players[1], e.players[0]
+		e.playerKinds[0], e.playerKinds[1] = e.playerKinds[1], e.playerKinds[0]
+	}
+	e.analysing = false
+	_ = e.SetFEN("")
+}
+
+// SetAnalysis switches between playing the game, where each side
+// moves as its player chooses, and analysing it, where both sides
+// are moved through the GUI
+func (e *Engine) SetAnalysis(analysing bool) {
+	e.analysing = analysing
+	e.stopThinking()
+}
+
+// IsAnalysing reports whether both sides are moved through the GUI
+func (e *Engine) IsAnalysing() bool {
+	return e.analysing
+}
+
+// IsHumanTurn reports whether the player to move moves through the GUI
+func (e *Engine) IsHumanTurn() bool {
+	return e.Player(e.Turn()).IsHuman()
+}
+
+// IsGameOver reports whether the player to move has no legal moves,
+// the game is drawn by rule or it has ended on the clock
+func (e *Engine) IsGameOver() bool {
+	return e.termination != "" || len(e.position.LegalMoves()) == 0 || e.position.drawReason() != ""
+}
+
+// DrawReason returns the rule the current position is drawn by, such
+// as the fifty-move rule, or "" when none applies
+func (e *Engine) DrawReason() string {
+	return e.position.drawReason()
+}
+
+// Update is called every frame. When a computer player is to move it
+// is started thinking in the background, and once it has chosen its
+// move the move is played and returned
+func (e *Engine) Update() (*PlayedMove, error) {
+	if err := e.updateClock(); err != nil {
+		return nil, err
+	}
+	if err := e.updateAnalysis(); err != nil {
+		return nil, err
+	}
+	if err := e.updateProbe(); err != nil {
+		return nil, err
+	}
+	if e.thinking == nil {
+		// the player waits for any analysis to stop with the engine
+		if !e.computerToMove() || time.Now().Before(e.retryAt) || e.analysis != nil {
+			return nil, nil
+		}
+		player := e.Player(e.Turn())
+		thinking := make(chan choice, 1)
+		go func(position *Position, history History, clock Clock, generation int) {
+			move, err := player.ChooseMove(position, history, clock)
+			thinking <- choice{move: move, err: err, generation: generation}
+		}(e.position.Clone(), e.history(), e.Clock(), e.generation)
+		e.thinking = thinking
+		return nil, nil
+	}
+	select {
+	case c := <-e.thinking:
+		e.thinking = nil
+		if c.generation != e.generation {
+			return nil, nil
+		}
+		var over *xboard.GameOverError
+		if errors.As(c.err, &over) {
+			// an engine resigning or claiming a result ends the game
+			e.result, e.termination = over.Result, "normal"
+			return nil, fmt.Errorf("%w: %s", ErrGameOver, over.Reason)
+		}
+		if c.err != nil {
+			e.retryAt = time.Now().Add(retryDelay)
+			return nil, fmt.Errorf("%s player: %w", playerName(e.Turn()), c.err)
+		}
+		if _, ok := e.position.FindMove(c.move.From, c.move.To, c.move.Promotion); !ok {
+			e.retryAt = time.Now().Add(retryDelay)
+			return nil, fmt.Errorf("%s player chose an illegal move: %s", playerName(e.Turn()), c.move)
+		}
+		played := e.play(c.move)
+		if evaluator, ok := e.Player(played.Piece & PlayerMask).(Evaluator); ok {
+			e.recordEval(played.Piece&PlayerMask, evaluator)
+		}
+		return played, nil
+	default:
+		return nil, nil
+	}
+}
+
+// computerToMove reports whether a computer player is to move in the
+// game being played from the end of its line
+func (e *Engine) computerToMove() bool {
+	return !e.IsHumanTurn() && len(e.tree.Current().Children()) == 0 && !e.IsGameOver()
+}
+
+// Clock returns the time left on each side's clock, with the increment,
+// moves to the time control and stage of the player to move. A game
+// without a clock is untimed
+func (e *Engine) Clock() Clock {
+	if e.clock == nil {
+		return Clock{}
+	}
+	stage := e.clock.Stage(e.Turn())
+	return Clock{
+		WhiteTime:      e.clock.Remaining(PlayerWhite),
+		BlackTime:      e.clock.Remaining(PlayerBlack),
+		WhiteIncrement: e.clock.Increment(PlayerWhite),
+		BlackIncrement: e.clock.Increment(PlayerBlack),
+		MovesToGo:      e.clock.MovesToGo(e.Turn()),
+		StageMoves:     stage.Moves,
+		StageTime:      stage.Time,
+	}
+}
+
+// updateClock runs the clock of the player to move while the game is
+// played on from the end of its line, and stops it while the game is
+// stepped through, analysed or over. A player whose flag falls loses,
+// or draws when the other side hasn't the material to mate
+func (e *Engine) updateClock() error {
+	if e.clock == nil || e.termination != "" {
+		return nil
+	}
+	live := !e.analysing && len(e.tree.Current().Children()) == 0 && len(e.position.LegalMoves()) > 0 &&
+		e.position.drawReason() == ""
+	player, running := e.clock.Running()
+	switch {
+	case !live:
+		e.clock.Stop()
+		return nil
+	case !running || player != e.Turn():
+		e.clock.Start(e.Turn())
+	}
+	player, flagged := e.clock.Flagged()
+	if !flagged {
+		return nil
+	}
+	e.clock.Stop()
+	e.termination = "time forfeit"
+	switch {
+	case !e.position.canMate(1 - player):
+		e.result = pgn.ResultDraw
+	case player == PlayerWhite:
+		e.result = pgn.ResultBlackWins
+	default:
+		e.result = pgn.ResultWhiteWins
+	}
+	e.stopThinking()
+	return fmt.Errorf("%s is %w", playerName(player), ErrOutOfTime)
+}
+
+// clockRunning returns the player whose clock is running, if the game
+// has a clock and either is
+func (e *Engine) clockRunning() (uint8, bool) {
+	if e.clock == nil {
+		return 0, false
+	}
+	return e.clock.Running()
+}
+
+// play plays the move. A move played from an earlier position starts a
+// variation, leaving the moves already played there as the mainline
+// until the variation is promoted
+func (e *Engine) play(move Move) *PlayedMove {
+	mover := e.Turn()
+	san := e.position.Play(move)
+	extended := e.tree.Current().Child(move.String()) == nil && e.tree.Current().IsMainline()
+	node := e.tree.Play(move.String(), san)
+	if extended && node.IsMainline() {
+		e.result = ""
+		e.termination = ""
+	}
+	if player, running := e.clockRunning(); running && player == mover {
+		e.clock.Press()
+		node.Clock = e.clock.Remaining(mover)
+	}
+	e.path = append(e.path, move)
+	return &PlayedMove{Move: move, SAN: san}
+}
+
+func playerName(player uint8) string {
+	if player == PlayerBlack {
+		return "Black"
+	}
+	return "White"
 }
 
 func (e *Engine) GetBoards() []uint64 {
@@ -81,38 +556,53 @@ func (e *Engine) GetPieceType(rank, file uint8) (uint8, bool) {
 	return e.position.identifyPiece(RFtoB(rank, file))
 }
 
+// FEN returns the position on the board
+func (e *Engine) FEN() string {
+	return e.position.GenerateFen()
+}
+
 func (e *Engine) Turn() uint8 {
 	return e.position.Turn()
 }
 func (e *Engine) Fullmove() int {
 	return e.position.fullMoves
 }
+
+// MovePiece plays a move made through the GUI, if it is a human's
+// turn and the move is legal, and returns the move in SAN
 func (e *Engine) MovePiece(from, to, pieceType uint8) (string, bool) {
-	return e.position.MovePiece(from, to, pieceType)
+	if !e.IsHumanTurn() {
+		return "Not a human's turn", false
+	}
+	if e.termination != "" || e.position.drawReason() != "" {
+		return "The game is over", false
+	}
+	move, ok := e.position.FindMove(from, to, PieceQueen)
+	if !ok || move.Piece != pieceType {
+		return "Illegal move", false
+	}
+	return e.play(move).SAN, true
 }
-func (e *Engine) FetchMove(lastFrom, lastTo uint8) (string, bool) {
-	e.moves += " " + RFtoN(ItoRF(lastFrom)) + RFtoN(ItoRF(lastTo))
-	err := e.stockfish.SetMoves(e.moves)
-	if err != nil {
-		log.Printf("Error setting move [%s]: %v\n", e.moves, err)
+
+// PlayMove plays a move typed through the GUI, in SAN or UCI long
+// algebraic notation, if it is a human's turn and the move is legal,
+// and returns the move in SAN
+func (e *Engine) PlayMove(text string) (string, bool) {
+	text = strings.TrimSpace(text)
+	if !e.IsHumanTurn() {
+		return "Not a human's turn", false
 	}
-	var results *uci.Results
-	results, err = e.stockfish.Go(10, "", int64(time.Second))
-	if err != nil {
-		log.Printf("Error getting moves: %v\n", err)
-	}
-	rank, file, _ := NtoRF(results.BestMove[:2])
-	from := RFtoI(rank, file)
-	rank, file, _ = NtoRF(results.BestMove[2:4])
-	to := RFtoI(rank, file)
-	pieceType, _ := e.position.identifyPiece(ItoB(from))
-	msg, ok := e.position.MovePiece(from, to, pieceType)
+	if e.termination != "" || e.position.drawReason() != "" {
+		return "The game is over", false
+	}
+	move, ok := e.position.ParseMove(text)
 	if !ok {
-		log.Printf("Error moving piece from %d to %d\n", from, to)
-		return "", false
+		move, ok = e.position.ParseSAN(text)
 	}
-	e.moves += " " + results.BestMove
-	return msg, true
+	if !ok {
+		return "Illegal move: " + text, false
+	}
+	return e.play(move).SAN, true
 }
 
 func (e *Engine) showPieces(pieceType uint8) {
@@ -144,6 +634,13 @@ func (e *Engine) showPieces(pieceType uint8) {
 	e.position.debugPrintBitBoard(e.position.bitboards[pb], 0)
 }
 
+// GetMoves returns the square indexes the piece can legally move to
 func (e *Engine) GetMoves(rank uint8, file uint8, pieceType uint8) []uint8 {
-	return []uint8{44, 36, 28}
+	var targets []uint8
+	for _, move := range e.position.LegalMovesFrom(RFtoI(rank, file)) {
+		if move.Piece == pieceType && move.Promotion != PieceRook && move.Promotion != PieceBishop && move.Promotion != PieceKnight {
+			targets = append(targets, move.To)
+		}
+	}
+	return targets
 }
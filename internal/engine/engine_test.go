@@ -0,0 +1,644 @@
+package engine
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"strings"
+	"testing"
+	"time"
+	. "us.figge.chess/internal/common"
+	"us.figge.chess/internal/engine/uci"
+	"us.figge.chess/internal/engine/uci/ucitest"
+	"us.figge.chess/internal/game/clock"
+	"us.figge.chess/internal/pgn"
+)
+
+func TestMain(m *testing.M) {
+	ucitest.Main()
+	os.Exit(m.Run())
+}
+
+// TestEngine_MoveFlow plays moves through the same calls the board makes
+// when a piece is dropped: the human move followed by the engine reply
+func TestEngine_MoveFlow(t *testing.T) {
+	fake := ucitest.New(t, `
+> go*
+< info depth 10 score cp -20 pv e7e5 g1f3
+< bestmove e7e5 ponder g1f3
+> go*
+< info depth 10 score cp -25 pv b8c6
+< bestmove b8c6
+`)
+	e := NewEngine(OptEnginePath(fake.Path()))
+	defer e.Close()
+	require.NoError(t, e.SetFEN(""))
+
+	moves := []struct {
+		from, to     string
+		human, reply string
+		fen          string
+	}{
+		{"e2", "e4", "e4", "e5", "rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e6 0 2"},
+		{"g1", "f3", "Nf3", "Nc6", "r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3"},
+	}
+	for _, move := range moves {
+		from, to := squareIndex(move.from), squareIndex(move.to)
+		pieceType, ok := e.GetPieceType(ItoRF(from))
+		require.True(t, ok)
+		msg, ok := e.MovePiece(from, to, pieceType)
+		require.True(t, ok)
+		assert.Equal(t, move.human, msg)
+		reply, err := awaitMove(t, e)
+		require.NoError(t, err)
+		assert.Equal(t, move.reply, reply.SAN)
+		assert.Equal(t, move.fen, e.position.GenerateFen())
+	}
+	assert.Equal(t, PlayerWhite, e.Turn())
+	e.Close()
+	assert.Contains(t, fake.Commands(), "position startpos moves e2e4 e7e5 g1f3", "the engine is sent the moves of the game")
+}
+
+func TestEngine_XBoardAdapter(t *testing.T) {
+	fake := ucitest.New(t, `
+> protover 2
+< feature myname="Fake Crafty" setboard=1 usermove=1 done=1
+> go
+< 10 -20 100 50000 c7c5
+< move c7c5
+> go
+< move b8c6
+`)
+	e := NewEngine(OptEnginePath(fake.Path()), OptProtocol(ProtocolXBoard))
+	defer e.Close()
+	require.NoError(t, e.SetFEN(""))
+
+	_, ok := e.MovePiece(squareIndex("e2"), squareIndex("e4"), PiecePawn|PlayerWhite)
+	require.True(t, ok)
+	reply, err := awaitMove(t, e)
+	require.NoError(t, err)
+	assert.Equal(t, "c5", reply.SAN)
+	assert.Equal(t, "Fake Crafty", e.Player(PlayerBlack).Name())
+	_, ok = e.MovePiece(squareIndex("g1"), squareIndex("f3"), PieceKnight|PlayerWhite)
+	require.True(t, ok)
+	reply, err = awaitMove(t, e)
+	require.NoError(t, err)
+	assert.Equal(t, "Nc6", reply.SAN)
+	e.Close()
+
+	// the engine keeps its own game, so after the first move it is
+	// only sent the moves played since
+	commands := strings.Join(fake.Commands(), "\n")
+	assert.Contains(t, commands, "new\nforce\nusermove e2e4\n")
+	assert.Contains(t, commands, "go\nforce\nusermove g1f3\n")
+	assert.Equal(t, 2, strings.Count(commands, "new\n"), "one new for the handshake, one for the game")
+	assert.NotContains(t, commands, "\nsetboard ")
+}
+
+func TestEngine_EngineResigns(t *testing.T) {
+	fake := ucitest.New(t, `
+> protover 2
+< feature myname="Fake Crafty" setboard=1 usermove=1 done=1
+> go
+< resign
+`)
+	e := NewEngine(OptEnginePath(fake.Path()), OptProtocol(ProtocolXBoard))
+	defer e.Close()
+	require.NoError(t, e.SetFEN(""))
+
+	_, ok := e.MovePiece(squareIndex("e2"), squareIndex("e4"), PiecePawn|PlayerWhite)
+	require.True(t, ok)
+	_, err := awaitMove(t, e)
+	require.ErrorIs(t, err, ErrGameOver)
+	assert.EqualError(t, err, "game over: Black resigns")
+	assert.True(t, e.IsGameOver())
+	assert.Equal(t, pgn.ResultWhiteWins, e.Result())
+	termination, _ := e.Record().Tag("Termination")
+	assert.Equal(t, "normal", termination)
+	played, err := e.Update()
+	require.NoError(t, err)
+	assert.Nil(t, played)
+	assert.Nil(t, e.thinking, "the engine isn't asked to move again")
+}
+
+func TestEngine_UnknownProtocol(t *testing.T) {
+	e := NewEngine(OptProtocol("cecp"), OptPlayers(KindHuman, KindHuman))
+	defer e.Close()
+	_, err := e.Search(startPositionFEN, "", 1, 0)
+	assert.ErrorContains(t, err, `unknown engine protocol "cecp"`)
+}
+
+func TestEngine_EngineFailure(t *testing.T) {
+	tests := map[string]struct {
+		script string
+	}{
+		"engine crashes": {
+			script: `
+> go*
+! exit 1
+`,
+		},
+		"no move": {
+			script: `
+> go*
+< bestmove (none)
+`,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			fake := ucitest.New(tt, test.script)
+			e := NewEngine(OptEnginePath(fake.Path()))
+			defer e.Close()
+			require.NoError(tt, e.SetFEN(""))
+			e.adapter.(*uci.Supervisor).SetMaxRestarts(0)
+
+			_, ok := e.MovePiece(squareIndex("d2"), squareIndex("d4"), PiecePawn|PlayerWhite)
+			require.True(tt, ok)
+			_, err := awaitMove(tt, e)
+			assert.Error(tt, err)
+			played, err := e.Update()
+			assert.Nil(tt, played, "should back off before asking again")
+			assert.NoError(tt, err)
+			assert.Equal(tt, PlayerBlack, e.Turn())
+		})
+	}
+}
+
+func TestEngine_Players(t *testing.T) {
+	tests := map[string]struct {
+		white, black string
+		moves        []string
+		fen          string
+	}{
+		"scripted vs scripted": {
+			white: KindScript + ":f2f3 g2g4",
+			black: KindScript + ":e7e5 d8h4",
+			moves: []string{"f3", "e5", "g4", "Qh4#"},
+			fen:   "rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3",
+		},
+		"scripted vs random": {
+			white: KindScript + ":e2e4",
+			black: KindRandom,
+			moves: []string{"e4", ""},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			e := NewEngine(OptPlayers(test.white, test.black))
+			defer e.Close()
+			require.NoError(tt, e.SetFEN(""))
+			assert.False(tt, e.IsHumanTurn())
+			for _, san := range test.moves {
+				played, err := awaitMove(tt, e)
+				require.NoError(tt, err)
+				if san != "" {
+					assert.Equal(tt, san, played.SAN)
+				}
+			}
+			if test.fen != "" {
+				assert.Equal(tt, test.fen, e.position.GenerateFen())
+				assert.True(tt, e.IsGameOver())
+			}
+		})
+	}
+}
+
+func TestEngine_HumanTurn(t *testing.T) {
+	e := NewEngine(OptPlayers(KindRandom, KindHuman))
+	defer e.Close()
+	require.NoError(t, e.SetFEN(""))
+
+	_, ok := e.MovePiece(squareIndex("e2"), squareIndex("e4"), PiecePawn|PlayerWhite)
+	assert.False(t, ok, "white is not human")
+	_, err := awaitMove(t, e)
+	require.NoError(t, err)
+	assert.True(t, e.IsHumanTurn())
+	played, err := e.Update()
+	assert.Nil(t, played)
+	assert.NoError(t, err)
+}
+
+func TestEngine_Takeback(t *testing.T) {
+	fake := ucitest.New(t, `
+> go*
+< bestmove e7e5
+> go*
+< bestmove g8f6
+`)
+	e := NewEngine(OptEnginePath(fake.Path()))
+	defer e.Close()
+	require.NoError(t, e.SetFEN(""))
+	assert.False(t, e.Takeback(), "nothing to take back")
+
+	_, ok := e.MovePiece(squareIndex("e2"), squareIndex("e4"), PiecePawn|PlayerWhite)
+	require.True(t, ok)
+	played, err := awaitMove(t, e)
+	require.NoError(t, err)
+	require.Equal(t, "e5", played.SAN)
+
+	require.True(t, e.Takeback())
+	ply, end := e.Ply()
+	assert.Equal(t, []int{0, 2}, []int{ply, end}, "the reply is taken back with the move")
+	assert.Equal(t, startPositionFEN, e.FEN())
+	require.True(t, e.Redo())
+	ply, _ = e.Ply()
+	assert.Equal(t, 2, ply)
+	assert.False(t, e.Redo())
+
+	// stepping to the engine's turn leaves it waiting for the human
+	e.GotoPly(1)
+	played, err = e.Update()
+	require.NoError(t, err)
+	assert.Nil(t, played)
+	assert.Nil(t, e.thinking)
+
+	require.True(t, e.Takeback())
+	_, ok = e.MovePiece(squareIndex("d2"), squareIndex("d4"), PiecePawn|PlayerWhite)
+	require.True(t, ok)
+	played, err = awaitMove(t, e)
+	require.NoError(t, err)
+	assert.Equal(t, "Nf6", played.SAN)
+	moves := e.Tree().Moves()
+	require.Len(t, moves, 2)
+	assert.Equal(t, "e4", moves[0].SAN, "the moves taken back stay the mainline")
+	require.Len(t, moves[0].Variations, 1)
+	assert.Equal(t, []string{"d4", "Nf6"}, []string{moves[0].Variations[0][0].SAN, moves[0].Variations[0][1].SAN})
+
+	require.True(t, e.PromoteVariation())
+	moves = e.Tree().Moves()
+	assert.Equal(t, "d4", moves[0].SAN)
+	assert.Equal(t, "e4", moves[0].Variations[0][0].SAN)
+	assert.False(t, e.PromoteVariation(), "already the mainline")
+
+	// deleting the reply goes back to the move before it, with nothing
+	// left to redo
+	require.True(t, e.DeleteFromHere())
+	ply, end = e.Ply()
+	assert.Equal(t, []int{1, 1}, []int{ply, end})
+	assert.Equal(t, "rnbqkbnr/pppppppp/8/8/3P4/8/PPP1PPPP/RNBQKBNR b KQkq d3 0 1", e.FEN())
+	assert.False(t, e.Redo())
+	assert.Equal(t, "d2d4", e.history().Moves)
+	e.GotoPly(0)
+	require.True(t, e.DeleteFromHere(), "the start deletes every move")
+	assert.Empty(t, e.Tree().Moves())
+	assert.False(t, e.DeleteFromHere())
+
+	e.Close()
+	assert.Contains(t, fake.Commands(), "position startpos moves d2d4")
+}
+
+// awaitMove calls Update, as the board does every frame, until a
+// move is played or an error is returned
+func awaitMove(t *testing.T, e *Engine) (*PlayedMove, error) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		played, err := e.Update()
+		if played != nil || err != nil {
+			return played, err
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("timed out waiting for a move")
+	return nil, nil
+}
+
+func squareIndex(n string) uint8 {
+	rank, file, _ := NtoRF(n)
+	return RFtoI(rank, file)
+}
+
+func TestEngine_Search(t *testing.T) {
+	fake := ucitest.New(t, `
+> go depth 5 movetime 250
+< info depth 5 score cp 30 pv g1f3
+< bestmove g1f3
+`)
+	e := NewEngine(OptEnginePath(fake.Path()), OptPlayers(KindHuman, KindHuman))
+	defer e.Close()
+	assert.Nil(t, e.fullAdapter, "the engine starts when it is first needed")
+
+	results, err := e.Search(startPositionFEN, "", 5, 250*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, "g1f3", results.BestMove)
+	assert.Nil(t, e.adapter, "the game's engine isn't used")
+	e.Close()
+	assert.Contains(t, fake.Commands(), "position fen "+startPositionFEN)
+}
+
+func TestEngine_PlayAs(t *testing.T) {
+	e := NewEngine(OptPlayers(KindHuman, KindScript+":e2e4"))
+	defer e.Close()
+
+	e.PlayAs(PlayerBlack)
+	assert.True(t, e.Player(PlayerBlack).IsHuman())
+	assert.False(t, e.IsHumanTurn())
+	played, err := awaitMove(t, e)
+	require.NoError(t, err)
+	assert.Equal(t, "e4", played.SAN)
+	assert.True(t, e.IsHumanTurn())
+
+	e.PlayAs(PlayerWhite)
+	assert.True(t, e.Player(PlayerWhite).IsHuman())
+	assert.Equal(t, startPositionFEN, e.FEN())
+	assert.True(t, e.IsHumanTurn())
+}
+
+func TestEngine_Analysis(t *testing.T) {
+	e := NewEngine(OptPlayers(KindHuman, KindScript+":e7e5"))
+	defer e.Close()
+	ed := e.Editor()
+	ed.Move(squareIndex("e2"), squareIndex("e4"))
+	ed.SetTurn(PlayerBlack)
+	require.NoError(t, ed.Validate())
+	require.NoError(t, e.SetFEN(ed.FEN()))
+
+	e.SetAnalysis(true)
+	assert.True(t, e.IsHumanTurn(), "black is moved through the GUI while analysing")
+	played, err := e.Update()
+	require.NoError(t, err)
+	assert.Nil(t, played)
+	_, ok := e.MovePiece(squareIndex("c7"), squareIndex("c5"), PiecePawn|PlayerBlack)
+	assert.True(t, ok)
+
+	e.SetAnalysis(false)
+	assert.True(t, e.IsHumanTurn())
+	_, ok = e.MovePiece(squareIndex("g1"), squareIndex("f3"), PieceKnight|PlayerWhite)
+	require.True(t, ok)
+	assert.False(t, e.IsHumanTurn())
+	played, err = awaitMove(t, e)
+	require.NoError(t, err)
+	assert.Equal(t, "e5", played.SAN)
+}
+
+func TestEngine_PlayMove(t *testing.T) {
+	tests := map[string]struct {
+		moves []string
+		san   string
+		ok    bool
+	}{
+		"san":           {[]string{"Nf3"}, "Nf3", true},
+		"uci":           {[]string{"g1f3"}, "Nf3", true},
+		"capture":       {[]string{"e4", "d5", "exd5"}, "exd5", true},
+		"castling":      {[]string{"e4", "e5", "Nf3", "Nc6", "Bc4", "Bc5", "O-O"}, "O-O", true},
+		"uci promotion": {[]string{"h4", "g5", "hxg5", "h6", "gxh6", "Nf6", "h7", "Ng8", "h7g8n"}, "hxg8=N", true},
+		"illegal":       {[]string{"Nf4"}, "Illegal move: Nf4", false},
+		"nonsense":      {[]string{"hello"}, "Illegal move: hello", false},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			e := NewEngine(OptPlayers(KindHuman, KindHuman))
+			defer e.Close()
+			var san string
+			var ok bool
+			for _, move := range test.moves {
+				san, ok = e.PlayMove(move)
+			}
+			assert.Equal(tt, test.ok, ok)
+			assert.Equal(tt, test.san, san)
+		})
+	}
+
+	e := NewEngine(OptPlayers(KindHuman, KindRandom))
+	defer e.Close()
+	_, ok := e.PlayMove("e4")
+	require.True(t, ok)
+	san, ok := e.PlayMove("e5")
+	assert.False(t, ok)
+	assert.Equal(t, "Not a human's turn", san)
+}
+
+// manualTime is a clock source moved on by hand
+type manualTime struct {
+	now time.Time
+}
+
+func (m *manualTime) Now() time.Time {
+	return m.now
+}
+
+func newClockOption(t *testing.T, control string) (Option, *manualTime) {
+	t.Helper()
+	c, err := clock.Parse(control)
+	require.NoError(t, err)
+	source := &manualTime{now: time.Now()}
+	return OptClock(c, clock.OptSource(source.Now)), source
+}
+
+func TestEngine_Clock(t *testing.T) {
+	fake := ucitest.New(t, `
+> go wtime 52000 btime 60000 winc 2000 binc 2000
+< info depth 10 score cp -20 pv e7e5
+< bestmove e7e5
+`)
+	option, source := newClockOption(t, "1+2")
+	e := NewEngine(OptEnginePath(fake.Path()), option)
+	defer e.Close()
+	require.NoError(t, e.SetFEN(""))
+
+	_, err := e.Update()
+	require.NoError(t, err)
+	source.now = source.now.Add(10 * time.Second)
+	assert.Equal(t, 50*time.Second, e.Clock().WhiteTime)
+	_, ok := e.MovePiece(squareIndex("e2"), squareIndex("e4"), PiecePawn|PlayerWhite)
+	require.True(t, ok)
+	reply, err := awaitMove(t, e)
+	require.NoError(t, err)
+	assert.Equal(t, "e5", reply.SAN)
+	assert.Equal(t, Clock{
+		WhiteTime:      52 * time.Second,
+		BlackTime:      62 * time.Second,
+		WhiteIncrement: 2 * time.Second,
+		BlackIncrement: 2 * time.Second,
+		StageTime:      time.Minute,
+	}, e.Clock())
+
+	moves := e.Record().Moves
+	require.Len(t, moves, 2)
+	assert.Equal(t, 52*time.Second, moves[0].Clock)
+	assert.Equal(t, 62*time.Second, moves[1].Clock)
+	e.Close()
+	assert.Contains(t, fake.Commands(), "go wtime 52000 btime 60000 winc 2000 binc 2000")
+}
+
+func TestEngine_Flag(t *testing.T) {
+	tests := map[string]struct {
+		fen    string
+		result string
+	}{
+		"white flags":                {"", pgn.ResultBlackWins},
+		"black flags":                {"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1", pgn.ResultWhiteWins},
+		"lone king can't mate":       {"4k3/8/8/8/8/8/8/3QK3 w - - 0 1", pgn.ResultDraw},
+		"knight can't mate a queen":  {"3qk3/8/8/8/8/8/8/4K1N1 b - - 0 1", pgn.ResultDraw},
+		"knight can mate a pawn":     {"4k3/4p3/8/8/8/8/8/3NK3 b - - 0 1", pgn.ResultWhiteWins},
+		"bishop can mate a knight":   {"4kn2/8/8/8/8/8/8/2B1K3 b - - 0 1", pgn.ResultWhiteWins},
+		"one colour can mate a rook": {"r3k3/8/8/8/8/4B3/8/2B1K3 b - - 0 1", pgn.ResultWhiteWins},
+		"bishop can mate a rook":     {"1r2k3/8/8/8/8/8/8/2B1K3 b - - 0 1", pgn.ResultWhiteWins},
+		"bishop can mate a queen":    {"1q2k3/8/8/8/8/8/8/2B1K3 b - - 0 1", pgn.ResultWhiteWins},
+		"two bishops can mate":       {"4k3/8/8/8/8/8/8/2B1KB2 b - - 0 1", pgn.ResultWhiteWins},
+		"a pawn can mate":            {"4k3/8/8/8/8/8/P7/4K3 b - - 0 1", pgn.ResultWhiteWins},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			option, source := newClockOption(tt, "1")
+			e := NewEngine(OptPlayers(KindHuman, KindHuman), option)
+			defer e.Close()
+			require.NoError(tt, e.SetFEN(test.fen))
+
+			_, err := e.Update()
+			require.NoError(tt, err)
+			source.now = source.now.Add(time.Minute)
+			_, err = e.Update()
+			assert.ErrorIs(tt, err, ErrOutOfTime)
+			assert.Equal(tt, test.result, e.Result())
+			assert.True(tt, e.IsGameOver())
+			termination, _ := e.Record().Tag("Termination")
+			assert.Equal(tt, "time forfeit", termination)
+			_, err = e.Update()
+			assert.NoError(tt, err, "the flag falls once")
+
+			require.NoError(tt, e.SetFEN(test.fen))
+			assert.False(tt, e.IsGameOver())
+			assert.Equal(tt, time.Minute, e.Clock().WhiteTime)
+		})
+	}
+}
+
+func TestEngine_EngineAnalysis(t *testing.T) {
+	fake := ucitest.New(t, `
+> go infinite
+< info depth 12 multipv 1 score cp 30 nodes 5000 nps 100000 time 50 pv e2e4 e7e5 g1f3
+< info depth 12 multipv 2 score cp 20 nodes 5000 nps 100000 time 50 pv d2d4 d7d5
+> stop
+< bestmove e2e4
+> go infinite
+< info depth 8 multipv 1 score mate 4 nodes 900 nps 90000 time 10 pv e7e5 g1f3
+> stop
+< bestmove e7e5
+`)
+	e := NewEngine(OptEnginePath(fake.Path()), OptPlayers(KindHuman, KindHuman), OptAnalysisLines(2))
+	defer e.Close()
+	e.SetEngineAnalysis(true)
+
+	assert.Equal(t, []AnalysisLine{
+		{Depth: 12, Score: 30, Nodes: 5000, NodesPerSecond: 100000, Moves: []string{"e4", "e5", "Nf3"}, UCI: []string{"e2e4", "e7e5", "g1f3"}},
+		{Depth: 12, Score: 20, Nodes: 5000, NodesPerSecond: 100000, Moves: []string{"d4", "d5"}, UCI: []string{"d2d4", "d7d5"}},
+	}, awaitAnalysis(t, e, 2))
+	assert.Nil(t, e.adapter, "the opponent's engine isn't used")
+	score, mate, ok := e.Evaluation()
+	assert.Equal(t, 30, score)
+	assert.False(t, mate)
+	assert.True(t, ok)
+
+	// Playing a move drops the lines at once and analyses the new position
+	_, ok = e.PlayMove("e4")
+	require.True(t, ok)
+	_, ok = e.Analysis()
+	assert.False(t, ok)
+	assert.Equal(t, []AnalysisLine{
+		{Depth: 8, Score: -4, Mate: true, Nodes: 900, NodesPerSecond: 90000, Moves: []string{"e5", "Nf3"}, UCI: []string{"e7e5", "g1f3"}},
+	}, awaitAnalysis(t, e, 1))
+	score, mate, ok = e.Evaluation()
+	assert.Equal(t, -4, score)
+	assert.True(t, mate)
+	assert.True(t, ok)
+
+	// Without analysis the evaluation is the one recorded with the move
+	e.SetEngineAnalysis(false)
+	_, err := e.Update()
+	require.NoError(t, err)
+	_, ok = e.Analysis()
+	assert.False(t, ok)
+	_, _, ok = e.Evaluation()
+	assert.False(t, ok)
+	e.Tree().Current().Eval = "-0.35"
+	score, mate, ok = e.Evaluation()
+	assert.Equal(t, -35, score)
+	assert.False(t, mate)
+	assert.True(t, ok)
+
+	e.Close()
+	commands := fake.Commands()
+	assert.Contains(t, commands, "setoption name MultiPV value 2")
+	assert.NotContains(t, commands, "setoption name UCI_LimitStrength value true")
+	assert.Contains(t, commands, "position startpos moves e2e4")
+	assert.Equal(t, 2, strings.Count(strings.Join(commands, "\n"), "go infinite"))
+}
+
+// awaitAnalysis calls Update, as the board does every frame, until the
+// engine has found the number of lines in the position
+func awaitAnalysis(t *testing.T, e *Engine, lines int) []AnalysisLine {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		_, err := e.Update()
+		require.NoError(t, err)
+		if analysis, ok := e.Analysis(); ok && len(analysis) >= lines {
+			return analysis
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("timed out waiting for analysis")
+	return nil
+}
+
+func TestEngine_Probe(t *testing.T) {
+	fake := ucitest.New(t, `
+> go*
+< info depth 12 score cp 30 pv e2e4 e7e5
+< bestmove e2e4
+> go*
+< info depth 12 score cp 20 pv e7e5
+< bestmove e7e5
+`)
+	var transcript strings.Builder
+	e := NewEngine(OptEnginePath(fake.Path()), OptPlayers(KindHuman, KindHuman), OptTranscript(&transcript))
+	defer e.Close()
+
+	require.NoError(t, e.Hint())
+	hint := awaitProbe(t, e)
+	assert.Equal(t, Probe{Move: Move{From: squareIndex("e2"), To: squareIndex("e4"), Piece: PiecePawn | PlayerWhite, Promotion: PiecePawn}, SAN: "e4"}, hint)
+	require.NoError(t, e.Hint(), "asking again for the same hint doesn't search again")
+
+	require.NoError(t, e.Threat())
+	threat := awaitProbe(t, e)
+	assert.True(t, threat.Threat)
+	assert.Equal(t, "e5", threat.SAN)
+	assert.Nil(t, e.adapter, "the game's engine isn't disturbed")
+	e.Close()
+	commands := fake.Commands()
+	assert.Contains(t, commands, "position fen rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR b KQkq - 0 1")
+	assert.Contains(t, commands, "setoption name Hash value 16")
+	assert.Contains(t, commands, "setoption name Threads value 1")
+	lines, err := uci.ReadTranscript(strings.NewReader(transcript.String()))
+	require.NoError(t, err)
+	require.NotEmpty(t, lines)
+	for _, line := range lines {
+		assert.Equal(t, "probe", line.Role, line.Text)
+	}
+}
+
+func TestEngine_ThreatInCheck(t *testing.T) {
+	e := NewEngine(OptPlayers(KindHuman, KindHuman))
+	defer e.Close()
+	require.NoError(t, e.SetFEN("4k3/8/8/8/8/8/4q3/4K3 w - - 0 1"))
+	assert.ErrorIs(t, e.Threat(), ErrInCheck)
+	_, ok := e.Probe()
+	assert.False(t, ok)
+}
+
+func awaitProbe(t *testing.T, e *Engine) Probe {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		_, err := e.Update()
+		require.NoError(t, err)
+		if result, ok := e.Probe(); ok {
+			return result
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("timed out waiting for the probe")
+	return Probe{}
+}
@@ -0,0 +1,276 @@
+package engine
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	. "us.figge.chess/internal/common"
+)
+
+// Fields of a FEN, as named in a FENError
+const (
+	FieldPlacement = "piece placement"
+	FieldTurn      = "side to move"
+	FieldCastling  = "castling"
+	FieldEnPassant = "en passant"
+	FieldHalfMove  = "halfmove clock"
+	FieldFullMove  = "fullmove number"
+)
+
+// FENError is a FEN that can't be set up, naming the field at fault
+// and the offset into the FEN where the problem was found
+type FENError struct {
+	FEN     string
+	Field   string
+	Offset  int
+	Message string
+}
+
+func (e *FENError) Error() string {
+	return fmt.Sprintf("invalid %s in FEN at offset %d: %s", e.Field, e.Offset, e.Message)
+}
+
+// castlings are the castling rights in FEN order, with the squares
+// the king and rook start on
+var castlings = []struct {
+	c          byte
+	right      uint8
+	player     uint8
+	king, rook string
+}{
+	{'K', CastleRightsWhiteKing, PlayerWhite, "e1", "h1"},
+	{'Q', CastleRightsWhiteQueen, PlayerWhite, "e1", "a1"},
+	{'k', CastleRightsBlackKing, PlayerBlack, "e8", "h8"},
+	{'q', CastleRightsBlackQueen, PlayerBlack, "e8", "a8"},
+}
+
+// fenField is a field of a FEN and its offset into the FEN
+type fenField struct {
+	text   string
+	offset int
+}
+
+// ParseFEN returns the position described by a FEN, checking the
+// position could arise in a game: one king each, no more pieces than
+// promotions allow, no pawns on the back ranks, the side not to move
+// not in check, castling rights that match the kings and rooks, and
+// an en passant square behind a pawn that has just moved two squares.
+// The move counters may be left off, defaulting to 0 and 1
+func ParseFEN(fen string) (*Position, error) {
+	var fields []fenField
+	for offset := 0; offset < len(fen); {
+		start := offset + strings.IndexFunc(fen[offset:], func(r rune) bool { return r != ' ' })
+		if start < offset {
+			break
+		}
+		end := strings.IndexByte(fen[start:], ' ')
+		if end < 0 {
+			end = len(fen) - start
+		}
+		fields = append(fields, fenField{text: fen[start : start+end], offset: start})
+		offset = start + end
+	}
+	if len(fields) < 4 || len(fields) > 6 {
+		return nil, &FENError{FEN: fen, Field: FieldPlacement, Message: fmt.Sprintf("expected 4 to 6 fields, found %d", len(fields))}
+	}
+	for len(fields) < 6 {
+		fields = append(fields, fenField{offset: len(fen)})
+	}
+
+	p := &Position{halfMoves: make([]uint64, 0), fullMoves: 1}
+	readers := []struct {
+		field string
+		read  func(string) (int, string)
+	}{
+		{FieldPlacement, p.readFenPlacement},
+		{FieldTurn, p.readFenTurn},
+		{FieldCastling, p.readFenCastling},
+		{FieldEnPassant, p.readFenEnPassant},
+		{FieldHalfMove, p.readFenHalfMove},
+		{FieldFullMove, p.readFenFullMove},
+	}
+	for i, reader := range readers {
+		if offset, message := reader.read(fields[i].text); message != "" {
+			return nil, &FENError{FEN: fen, Field: reader.field, Offset: fields[i].offset + offset, Message: message}
+		}
+	}
+	if p.isKingAttacked(1 - p.Turn()) {
+		return nil, &FENError{FEN: fen, Field: FieldTurn, Offset: fields[1].offset, Message: "the side not to move is in check"}
+	}
+	return p, nil
+}
+
+// The readFen functions set up a field of the position, returning a
+// message and the offset into the field when it is invalid
+
+func (p *Position) readFenPlacement(placement string) (int, string) {
+	ranks := strings.Split(placement, "/")
+	if len(ranks) != 8 {
+		return 0, fmt.Sprintf("expected 8 ranks, found %d", len(ranks))
+	}
+	offset := 0
+	for r, text := range ranks {
+		rank := uint8(8 - r)
+		file := uint8(1)
+		for i := 0; i < len(text); i++ {
+			c := text[i]
+			switch {
+			case c >= '1' && c <= '8':
+				if i > 0 && text[i-1] >= '1' && text[i-1] <= '8' {
+					return offset + i, "consecutive empty square counts"
+				}
+				file += c - '0'
+			default:
+				pieceType, ok := fenPieceMap[c]
+				switch {
+				case !ok:
+					return offset + i, fmt.Sprintf("unexpected character %q", c)
+				case file > 8:
+					return offset + i, fmt.Sprintf("rank %d has more than 8 squares", rank)
+				case pieceType&PieceMask == PiecePawn && (rank == 1 || rank == 8):
+					return offset + i, fmt.Sprintf("pawn on rank %d", rank)
+				}
+				p.SetPiece(pieceType, rank, file)
+				file++
+			}
+		}
+		if file != 9 {
+			return offset, fmt.Sprintf("rank %d has %d squares", rank, file-1)
+		}
+		offset += len(text) + 1
+	}
+	for player, name := range []string{"white", "black"} {
+		count := func(board uint8) int {
+			return bits.OnesCount64(p.bitboards[board] & p.bitboards[player])
+		}
+		if kings := count(BitKings); kings != 1 {
+			return 0, fmt.Sprintf("%s has %d kings", name, kings)
+		}
+		if pieces := bits.OnesCount64(p.bitboards[player]); pieces > 16 {
+			return 0, fmt.Sprintf("%s has %d pieces", name, pieces)
+		}
+		pawns := count(BitPawns)
+		promoted := max(0, count(BitQueens)-1) + max(0, count(BitRooks)-2) +
+			max(0, count(BitBishops)-2) + max(0, count(BitKnights)-2)
+		if pawns+promoted > 8 {
+			return 0, fmt.Sprintf("%s has %d pawns and %d promoted pieces", name, pawns, promoted)
+		}
+	}
+	return 0, ""
+}
+
+func (p *Position) readFenTurn(turn string) (int, string) {
+	switch turn {
+	case "w":
+		p.SetTurn(PlayerWhite)
+	case "b":
+		p.SetTurn(PlayerBlack)
+	default:
+		return 0, fmt.Sprintf("expected w or b, found %q", turn)
+	}
+	return 0, ""
+}
+
+func (p *Position) readFenCastling(castling string) (int, string) {
+	if castling == "-" {
+		p.SetCastleRights(0)
+		return 0, ""
+	}
+	castleRights := uint8(0)
+	next := 0
+	for i := 0; i < len(castling); i++ {
+		found := false
+		for j := next; j < len(castlings) && !found; j++ {
+			if castling[i] != castlings[j].c {
+				continue
+			}
+			if !p.canCastle(castlings[j].right) {
+				return i, fmt.Sprintf("%c needs the king on %s and a rook on %s", castlings[j].c, castlings[j].king, castlings[j].rook)
+			}
+			castleRights |= castlings[j].right
+			next, found = j+1, true
+		}
+		if !found {
+			return i, fmt.Sprintf("expected - or KQkq in order, found %q", castling)
+		}
+	}
+	p.SetCastleRights(castleRights)
+	return 0, ""
+}
+
+func (p *Position) readFenEnPassant(enPassant string) (int, string) {
+	if enPassant == "-" {
+		p.ClearEnPassant()
+		return 0, ""
+	}
+	rank, file, ok := NtoRF(enPassant)
+	if !ok || len(enPassant) != 2 {
+		return 0, fmt.Sprintf("expected - or a square, found %q", enPassant)
+	}
+	// the pawn that moved two squares is in front of the en passant
+	// square, the square it moved from is behind it
+	opponent, target, pawn, from := PlayerBlack, uint8(6), uint8(5), uint8(7)
+	if p.Turn() == PlayerBlack {
+		opponent, target, pawn, from = PlayerWhite, 3, 4, 2
+	}
+	if rank != target {
+		return 0, fmt.Sprintf("%s is not on rank %d", enPassant, target)
+	}
+	if !p.hasPiece(RFtoN(pawn, file), PiecePawn|opponent) {
+		return 0, fmt.Sprintf("no pawn has just moved two squares past %s", enPassant)
+	}
+	if _, occupied := p.identifyPiece(RFtoB(target, file)); occupied {
+		return 0, fmt.Sprintf("%s is occupied", enPassant)
+	}
+	if _, occupied := p.identifyPiece(RFtoB(from, file)); occupied {
+		return 0, fmt.Sprintf("%s is occupied", RFtoN(from, file))
+	}
+	p.SetEnPassant(rank, file)
+	return 0, ""
+}
+
+func (p *Position) readFenHalfMove(halfMove string) (int, string) {
+	if halfMove == "" {
+		return 0, ""
+	}
+	count, err := strconv.Atoi(halfMove)
+	if err != nil || count < 0 {
+		return 0, fmt.Sprintf("expected a count of moves, found %q", halfMove)
+	}
+	if count > 0 && p.EnPassant() != 0 {
+		return 0, "must be 0 straight after a pawn moves two squares"
+	}
+	p.halfMoves = make([]uint64, count)
+	return 0, ""
+}
+
+func (p *Position) readFenFullMove(fullMove string) (int, string) {
+	if fullMove == "" {
+		return 0, ""
+	}
+	count, err := strconv.Atoi(fullMove)
+	if err != nil || count < 1 {
+		return 0, fmt.Sprintf("expected a move number, found %q", fullMove)
+	}
+	p.fullMoves = count
+	return 0, ""
+}
+
+// canCastle reports whether the king and rook of a castling right are
+// on the squares they start on
+func (p *Position) canCastle(right uint8) bool {
+	for _, castling := range castlings {
+		if castling.right == right {
+			return p.hasPiece(castling.king, PieceKing|castling.player) && p.hasPiece(castling.rook, PieceRook|castling.player)
+		}
+	}
+	return false
+}
+
+// hasPiece reports whether the piece type is on the named square
+func (p *Position) hasPiece(square string, pieceType uint8) bool {
+	rank, file, _ := NtoRF(square)
+	found, ok := p.identifyPiece(RFtoB(rank, file))
+	return ok && found == pieceType
+}
@@ -0,0 +1,237 @@
+package engine
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/bits"
+	"math/rand/v2"
+	"testing"
+	. "us.figge.chess/internal/common"
+)
+
+// checkInvariants fails the test when the bitboards of a position are
+// inconsistent: colours that overlap or that don't match the pieces,
+// pieces sharing a square, or other than one king each
+func checkInvariants(t *testing.T, p *Position) {
+	t.Helper()
+	white, black := p.bitboards[BitWhite], p.bitboards[BitBlack]
+	assert.Zero(t, white&black, "white and black overlap")
+	union := uint64(0)
+	for board := BitPawns; board <= BitKings; board++ {
+		assert.Zero(t, union&p.bitboards[board], "piece bitboard %d overlaps another", board)
+		union |= p.bitboards[board]
+	}
+	assert.Equal(t, white|black, union, "colours are not the union of the pieces")
+	assert.Equal(t, 1, bits.OnesCount64(p.bitboards[BitKings]&white), "white kings")
+	assert.Equal(t, 1, bits.OnesCount64(p.bitboards[BitKings]&black), "black kings")
+	if ep := p.EnPassant(); ep != 0 {
+		assert.Equal(t, 1, bits.OnesCount64(ep), "en passant squares")
+		assert.Zero(t, ep&union, "en passant square is occupied")
+	}
+}
+
+// checkRoundTrip fails the test unless the FEN of a position parses
+// back to the same position and FEN. A FEN keeps the half move count
+// but not the earlier positions
+func checkRoundTrip(t *testing.T, p *Position) {
+	t.Helper()
+	fen := p.GenerateFen()
+	reparsed, err := ParseFEN(fen)
+	require.NoError(t, err, fen)
+	assert.Equal(t, fen, reparsed.GenerateFen())
+	assert.Len(t, reparsed.halfMoves, len(p.halfMoves), fen)
+	expected := p.Clone()
+	expected.halfMoves, reparsed.halfMoves = nil, nil
+	assert.Equal(t, expected, reparsed, fen)
+}
+
+func TestParseFEN(t *testing.T) {
+	tests := map[string]struct {
+		fen     string
+		next    string
+		field   string
+		offset  int
+		message string
+	}{
+		"start position": {
+			fen:  startPositionFEN,
+			next: startPositionFEN,
+		},
+		"missing counters": {
+			fen:  "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3",
+			next: "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+		},
+		"too few fields": {
+			fen:     "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq",
+			field:   FieldPlacement,
+			message: "expected 4 to 6 fields, found 3",
+		},
+		"unexpected character": {
+			fen:     "rnbqkbnr/pppppppp/9/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+			field:   FieldPlacement,
+			offset:  18,
+			message: `unexpected character '9'`,
+		},
+		"consecutive digits": {
+			fen:     "rnbqkbnr/pppppppp/44/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+			field:   FieldPlacement,
+			offset:  19,
+			message: "consecutive empty square counts",
+		},
+		"short rank": {
+			fen:     "rnbqkbnr/pppppppp/7/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+			field:   FieldPlacement,
+			offset:  18,
+			message: "rank 6 has 7 squares",
+		},
+		"long rank": {
+			fen:     "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNRR w KQkq - 0 1",
+			field:   FieldPlacement,
+			offset:  43,
+			message: "rank 1 has more than 8 squares",
+		},
+		"pawn on the back rank": {
+			fen:     "4k3/8/8/8/8/8/8/P3K3 w - - 0 1",
+			field:   FieldPlacement,
+			offset:  16,
+			message: "pawn on rank 1",
+		},
+		"no kings": {
+			fen:     "8/8/8/8/8/8/8/8 w - - 0 1",
+			field:   FieldPlacement,
+			message: "white has 0 kings",
+		},
+		"two kings": {
+			fen:     "4k3/8/8/8/8/8/8/K3K3 w - - 0 1",
+			field:   FieldPlacement,
+			message: "white has 2 kings",
+		},
+		"too many promotions": {
+			fen:     "4k3/8/8/8/8/8/PPPPPPPP/QQ2K3 w - - 0 1",
+			field:   FieldPlacement,
+			message: "white has 8 pawns and 1 promoted pieces",
+		},
+		"side to move": {
+			fen:     "4k3/8/8/8/8/8/8/4K3 x - - 0 1",
+			field:   FieldTurn,
+			offset:  20,
+			message: `expected w or b, found "x"`,
+		},
+		"side not to move in check": {
+			fen:     "4k3/8/8/8/8/8/8/r3K3 b - - 0 1",
+			field:   FieldTurn,
+			offset:  21,
+			message: "the side not to move is in check",
+		},
+		"castling without a rook": {
+			fen:     "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBN1 w KQkq - 0 1",
+			field:   FieldCastling,
+			offset:  46,
+			message: "K needs the king on e1 and a rook on h1",
+		},
+		"castling out of order": {
+			fen:     "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w QK - 0 1",
+			field:   FieldCastling,
+			offset:  47,
+			message: `expected - or KQkq in order, found "QK"`,
+		},
+		"en passant on the wrong rank": {
+			fen:     "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e3 0 1",
+			field:   FieldEnPassant,
+			offset:  53,
+			message: "e3 is not on rank 6",
+		},
+		"en passant without a pawn": {
+			fen:     "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR b KQkq e3 0 1",
+			field:   FieldEnPassant,
+			offset:  51,
+			message: "no pawn has just moved two squares past e3",
+		},
+		"en passant after a quiet move": {
+			fen:     "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 1 1",
+			field:   FieldHalfMove,
+			offset:  56,
+			message: "must be 0 straight after a pawn moves two squares",
+		},
+		"fullmove number": {
+			fen:     "4k3/8/8/8/8/8/8/4K3 w - - 0 0",
+			field:   FieldFullMove,
+			offset:  28,
+			message: `expected a move number, found "0"`,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			p, err := ParseFEN(test.fen)
+			if test.message == "" {
+				require.NoError(tt, err)
+				assert.Equal(tt, test.next, p.GenerateFen())
+				return
+			}
+			var fenErr *FENError
+			require.True(tt, errors.As(err, &fenErr), "expected a FENError, got %v", err)
+			assert.Equal(tt, test.field, fenErr.Field)
+			assert.Equal(tt, test.offset, fenErr.Offset)
+			assert.Equal(tt, test.message, fenErr.Message)
+			assert.Nil(tt, p)
+		})
+	}
+}
+
+func TestEngine_SetFENInvalid(t *testing.T) {
+	e := NewEngine(OptPlayers(KindHuman, KindHuman))
+	defer e.Close()
+	fen := "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1"
+	require.NoError(t, e.SetFEN(fen))
+	var fenErr *FENError
+	require.ErrorAs(t, e.SetFEN("4k3/8/8/8/8/8/8/4K3 w - - 0 0"), &fenErr)
+	assert.Equal(t, fen, e.position.GenerateFen())
+	assert.Equal(t, fen, e.fen)
+}
+
+func FuzzParseFEN(f *testing.F) {
+	for _, fen := range []string{
+		startPositionFEN,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3",
+		"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1",
+		"  4k3/8/8/8/8/8/8/4K3   b  -  -  12  40 ",
+		"8/8/8/8/8/8/8/8 w - - 0 1",
+	} {
+		f.Add(fen)
+	}
+	f.Fuzz(func(t *testing.T, fen string) {
+		p, err := ParseFEN(fen)
+		if err != nil {
+			var fenErr *FENError
+			require.ErrorAs(t, err, &fenErr)
+			assert.Nil(t, p)
+			return
+		}
+		checkInvariants(t, p)
+		checkRoundTrip(t, p)
+	})
+}
+
+func TestPosition_RandomGames(t *testing.T) {
+	random := rand.New(rand.NewPCG(1, 2))
+	for game := range 50 {
+		p, err := ParseFEN(startPositionFEN)
+		require.NoError(t, err)
+		var played []string
+		for range 200 {
+			moves := p.LegalMoves()
+			if len(moves) == 0 {
+				break
+			}
+			played = append(played, p.Play(moves[random.IntN(len(moves))]))
+			checkInvariants(t, p)
+			checkRoundTrip(t, p)
+			if t.Failed() {
+				t.Fatalf("game %d after %v", game, played)
+			}
+		}
+	}
+}
@@ -0,0 +1,510 @@
+package engine
+
+import (
+	"strings"
+	. "us.figge.chess/internal/common"
+)
+
+var (
+	knightDeltas   = [8][2]int{{2, -1}, {2, 1}, {1, -2}, {1, 2}, {-1, -2}, {-1, 2}, {-2, -1}, {-2, 1}}
+	kingDeltas     = [8][2]int{{1, -1}, {1, 0}, {1, 1}, {0, -1}, {0, 1}, {-1, -1}, {-1, 0}, {-1, 1}}
+	bishopDeltas   = [4][2]int{{1, -1}, {1, 1}, {-1, -1}, {-1, 1}}
+	rookDeltas     = [4][2]int{{1, 0}, {0, -1}, {0, 1}, {-1, 0}}
+	promotionTypes = [4]uint8{PieceQueen, PieceRook, PieceBishop, PieceKnight}
+)
+
+// Move is a move of a piece from one square index to another
+type Move struct {
+	From      uint8
+	To        uint8
+	Piece     uint8 // piece type, including the player, of the moving piece
+	Promotion uint8 // piece promoted to, PiecePawn when not promoting
+}
+
+// String returns the move in the long algebraic notation used by UCI
+func (m Move) String() string {
+	s := RFtoN(ItoRF(m.From)) + RFtoN(ItoRF(m.To))
+	if m.Promotion != PiecePawn {
+		s += strings.ToLower(string(algebraic[m.Promotion>>1]))
+	}
+	return s
+}
+
+// Clone returns a copy of the position that can be changed
+// without affecting the original
+func (p *Position) Clone() *Position {
+	c := *p
+	c.halfMoves = append([]uint64(nil), p.halfMoves...)
+	return &c
+}
+
+// LegalMoves returns every legal move for the player to move
+func (p *Position) LegalMoves() []Move {
+	var legal []Move
+	turn := p.Turn()
+	for _, move := range p.pseudoLegalMoves() {
+		next := *p
+		next.halfMoves = nil
+		next.apply(move)
+		if !next.isKingAttacked(turn) {
+			legal = append(legal, move)
+		}
+	}
+	return legal
+}
+
+// LegalMovesFrom returns the legal moves of the piece on the square index
+func (p *Position) LegalMovesFrom(index uint8) []Move {
+	var moves []Move
+	for _, move := range p.LegalMoves() {
+		if move.From == index {
+			moves = append(moves, move)
+		}
+	}
+	return moves
+}
+
+// FindMove returns the legal move from one square index to another,
+// choosing the promotion piece given when a pawn promotes
+func (p *Position) FindMove(from, to, promotion uint8) (Move, bool) {
+	for _, move := range p.LegalMovesFrom(from) {
+		if move.To == to && (move.Promotion == PiecePawn || move.Promotion == promotion) {
+			return move, true
+		}
+	}
+	return Move{}, false
+}
+
+// ParseMove returns the legal move given in UCI long algebraic notation
+func (p *Position) ParseMove(move string) (Move, bool) {
+	if len(move) < 4 || len(move) > 5 {
+		return Move{}, false
+	}
+	fromRank, fromFile, fromOk := NtoRF(move[:2])
+	toRank, toFile, toOk := NtoRF(move[2:4])
+	if !fromOk || !toOk {
+		return Move{}, false
+	}
+	promotion := PiecePawn
+	if len(move) == 5 {
+		i := strings.IndexByte(algebraic, strings.ToUpper(move[4:])[0])
+		if i < 1 || i > 4 {
+			return Move{}, false
+		}
+		promotion = uint8(i) << 1
+	}
+	m, ok := p.FindMove(RFtoI(fromRank, fromFile), RFtoI(toRank, toFile), promotion)
+	if ok && m.Promotion != promotion {
+		return Move{}, false
+	}
+	return m, ok
+}
+
+// InCheck reports whether the player to move is in check
+func (p *Position) InCheck() bool {
+	return p.isKingAttacked(p.Turn())
+}
+
+// IsAttacked reports whether the square index is attacked by the player
+func (p *Position) IsAttacked(index uint8, player uint8) bool {
+	rank, file := ItoRF(index)
+	attackers := p.bitboards[player]
+	pieceAt := func(dr, df int, pieces ...uint8) bool {
+		r, f := int(rank)+dr, int(file)+df
+		if r < 1 || r > 8 || f < 1 || f > 8 {
+			return false
+		}
+		bit := RFtoB(uint8(r), uint8(f))
+		if attackers&bit == 0 {
+			return false
+		}
+		for _, piece := range pieces {
+			if p.bitboards[piece]&bit != 0 {
+				return true
+			}
+		}
+		return false
+	}
+	for _, d := range knightDeltas {
+		if pieceAt(d[0], d[1], BitKnights) {
+			return true
+		}
+	}
+	for _, d := range kingDeltas {
+		if pieceAt(d[0], d[1], BitKings) {
+			return true
+		}
+	}
+	// pawns attack towards the opponent, so look back along their direction
+	forward := 1
+	if player == PlayerBlack {
+		forward = -1
+	}
+	if pieceAt(-forward, -1, BitPawns) || pieceAt(-forward, 1, BitPawns) {
+		return true
+	}
+	occupied := p.bitboards[BitWhite] | p.bitboards[BitBlack]
+	slider := func(deltas [4][2]int, pieces uint64) bool {
+		for _, d := range deltas {
+			r, f := int(rank)+d[0], int(file)+d[1]
+			for r >= 1 && r <= 8 && f >= 1 && f <= 8 {
+				bit := RFtoB(uint8(r), uint8(f))
+				if occupied&bit != 0 {
+					if attackers&pieces&bit != 0 {
+						return true
+					}
+					break
+				}
+				r, f = r+d[0], f+d[1]
+			}
+		}
+		return false
+	}
+	return slider(bishopDeltas, p.bitboards[BitBishops]|p.bitboards[BitQueens]) ||
+		slider(rookDeltas, p.bitboards[BitRooks]|p.bitboards[BitQueens])
+}
+
+func (p *Position) isKingAttacked(player uint8) bool {
+	kings := p.bitboards[BitKings] & p.bitboards[player]
+	if kings == 0 {
+		return false
+	}
+	return p.IsAttacked(BtoI(kings&-kings), 1-player)
+}
+
+// pseudoLegalMoves returns the moves for the player to move
+// without checking whether they leave the king in check
+func (p *Position) pseudoLegalMoves() []Move {
+	moves := make([]Move, 0, 48)
+	turn := p.Turn()
+	own := p.bitboards[turn]
+	opponent := p.bitboards[1-turn]
+	for index := uint8(0); index < 64; index++ {
+		bit := ItoB(index)
+		if own&bit == 0 {
+			continue
+		}
+		pieceType, _ := p.identifyPiece(bit)
+		rank, file := ItoRF(index)
+		add := func(r, f int) bool {
+			if r < 1 || r > 8 || f < 1 || f > 8 {
+				return false
+			}
+			to := RFtoI(uint8(r), uint8(f))
+			if own&ItoB(to) != 0 {
+				return false
+			}
+			moves = append(moves, Move{From: index, To: to, Piece: pieceType})
+			return opponent&ItoB(to) == 0
+		}
+		switch pieceType & PieceMask {
+		case PiecePawn:
+			moves = p.pawnMoves(moves, index, pieceType)
+		case PieceKnight:
+			for _, d := range knightDeltas {
+				add(int(rank)+d[0], int(file)+d[1])
+			}
+		case PieceKing:
+			for _, d := range kingDeltas {
+				add(int(rank)+d[0], int(file)+d[1])
+			}
+			moves = p.castlingMoves(moves, index, pieceType)
+		default:
+			var deltas [][2]int
+			if pieceType&PieceMask != PieceRook {
+				deltas = append(deltas, bishopDeltas[:]...)
+			}
+			if pieceType&PieceMask != PieceBishop {
+				deltas = append(deltas, rookDeltas[:]...)
+			}
+			for _, d := range deltas {
+				r, f := int(rank)+d[0], int(file)+d[1]
+				for add(r, f) {
+					r, f = r+d[0], f+d[1]
+				}
+			}
+		}
+	}
+	return moves
+}
+
+func (p *Position) pawnMoves(moves []Move, index uint8, pieceType uint8) []Move {
+	rank, file := ItoRF(index)
+	occupied := p.bitboards[BitWhite] | p.bitboards[BitBlack]
+	opponent := p.bitboards[1-pieceType&PlayerMask] | p.EnPassant()
+	forward, startRank, lastRank := 1, uint8(2), uint8(8)
+	if pieceType&PlayerMask == PlayerBlack {
+		forward, startRank, lastRank = -1, 7, 1
+	}
+	add := func(to uint8) {
+		if r, _ := ItoRF(to); r != lastRank {
+			moves = append(moves, Move{From: index, To: to, Piece: pieceType})
+			return
+		}
+		for _, promotion := range promotionTypes {
+			moves = append(moves, Move{From: index, To: to, Piece: pieceType, Promotion: promotion})
+		}
+	}
+	oneRank := uint8(int(rank) + forward)
+	one := RFtoI(oneRank, file)
+	if occupied&ItoB(one) == 0 {
+		add(one)
+		two := RFtoI(uint8(int(rank)+2*forward), file)
+		if rank == startRank && occupied&ItoB(two) == 0 {
+			add(two)
+		}
+	}
+	for _, f := range []int{int(file) - 1, int(file) + 1} {
+		if f < 1 || f > 8 {
+			continue
+		}
+		to := RFtoI(oneRank, uint8(f))
+		if opponent&ItoB(to) != 0 {
+			add(to)
+		}
+	}
+	return moves
+}
+
+func (p *Position) castlingMoves(moves []Move, index uint8, pieceType uint8) []Move {
+	player := pieceType & PlayerMask
+	rights := p.CastleRights()
+	occupied := p.bitboards[BitWhite] | p.bitboards[BitBlack]
+	rooks := p.bitboards[BitRooks] & p.bitboards[player]
+	// king from, king to, rook from, squares to be empty, squares not attacked
+	castles := []struct {
+		right  uint8
+		from   uint8
+		to     uint8
+		rook   uint8
+		empty  []uint8
+		passes []uint8
+	}{
+		{CastleRightsWhiteKing, 60, 62, 63, []uint8{61, 62}, []uint8{60, 61, 62}},
+		{CastleRightsWhiteQueen, 60, 58, 56, []uint8{57, 58, 59}, []uint8{60, 59, 58}},
+		{CastleRightsBlackKing, 4, 6, 7, []uint8{5, 6}, []uint8{4, 5, 6}},
+		{CastleRightsBlackQueen, 4, 2, 0, []uint8{1, 2, 3}, []uint8{4, 3, 2}},
+	}
+castling:
+	for _, castle := range castles {
+		if rights&castle.right == 0 || index != castle.from || rooks&ItoB(castle.rook) == 0 {
+			continue
+		}
+		for _, square := range castle.empty {
+			if occupied&ItoB(square) != 0 {
+				continue castling
+			}
+		}
+		for _, square := range castle.passes {
+			if p.IsAttacked(square, 1-player) {
+				continue castling
+			}
+		}
+		moves = append(moves, Move{From: castle.from, To: castle.to, Piece: pieceType})
+	}
+	return moves
+}
+
+// apply plays the move without checking that it is legal
+func (p *Position) apply(move Move) {
+	key := p.key()
+	player := move.Piece & PlayerMask
+	fromRank, fromFile := ItoRF(move.From)
+	toRank, toFile := ItoRF(move.To)
+	piece := move.Piece & PieceMask
+	enPassant := p.EnPassant()
+	p.ClearEnPassant()
+
+	captured, found := p.identifyPiece(ItoB(move.To))
+	if found {
+		p.RemovePiece(captured, toRank, toFile)
+	} else if piece == PiecePawn && ItoB(move.To) == enPassant {
+		p.RemovePiece(PiecePawn|(1-player), fromRank, toFile)
+		found = true
+	}
+
+	switch {
+	case piece == PieceKing && move.From == 60 && move.To == 62:
+		p.castle(60, 62, 63, 61, player)
+	case piece == PieceKing && move.From == 60 && move.To == 58:
+		p.castle(60, 58, 56, 59, player)
+	case piece == PieceKing && move.From == 4 && move.To == 6:
+		p.castle(4, 6, 7, 5, player)
+	case piece == PieceKing && move.From == 4 && move.To == 2:
+		p.castle(4, 2, 0, 3, player)
+	default:
+		p.RemovePiece(move.Piece, fromRank, fromFile)
+		if move.Promotion != PiecePawn {
+			p.SetPiece(move.Promotion|player, toRank, toFile)
+		} else {
+			p.SetPiece(move.Piece, toRank, toFile)
+		}
+	}
+
+	if piece == PiecePawn && (int(toRank)-int(fromRank) == 2 || int(fromRank)-int(toRank) == 2) {
+		p.SetEnPassant((fromRank+toRank)/2, fromFile)
+	}
+
+	// Moving the king or a rook, or capturing a rook, gives up castling
+	rights := p.CastleRights()
+	for _, square := range []uint8{move.From, move.To} {
+		switch square {
+		case 60:
+			rights &= CastleRightsBlackMask
+		case 4:
+			rights &= CastleRightsWhiteMask
+		case 63:
+			rights &^= CastleRightsWhiteKing
+		case 56:
+			rights &^= CastleRightsWhiteQueen
+		case 7:
+			rights &^= CastleRightsBlackKing
+		case 0:
+			rights &^= CastleRightsBlackQueen
+		}
+	}
+	p.SetCastleRights(rights)
+
+	// Keep the positions since the last capture or pawn move, which
+	// count the half moves and can't occur again once one is played
+	if piece == PiecePawn || found {
+		p.halfMoves = p.halfMoves[:0]
+	} else {
+		p.halfMoves = append(p.halfMoves, key)
+	}
+
+	// Update full move count
+	if player == PlayerBlack {
+		p.fullMoves++
+	}
+	p.SetTurn(1 - player)
+}
+
+// SAN returns the move in standard algebraic notation. The move
+// must be legal in the position
+func (p *Position) SAN(move Move) string {
+	piece := move.Piece & PieceMask
+	san := ""
+	switch {
+	case piece == PieceKing && int(move.To)-int(move.From) == 2:
+		san = "O-O"
+	case piece == PieceKing && int(move.From)-int(move.To) == 2:
+		san = "O-O-O"
+	default:
+		toRank, toFile := ItoRF(move.To)
+		fromRank, fromFile := ItoRF(move.From)
+		_, capture := p.identifyPiece(ItoB(move.To))
+		if piece == PiecePawn {
+			capture = fromFile != toFile
+			if capture {
+				san += FtoN(fromFile)
+			}
+		} else {
+			san += string(algebraic[piece>>1])
+			sameFile, sameRank, ambiguous := false, false, false
+			for _, other := range p.LegalMoves() {
+				if other.To != move.To || other.From == move.From || other.Piece != move.Piece {
+					continue
+				}
+				ambiguous = true
+				otherRank, otherFile := ItoRF(other.From)
+				sameFile = sameFile || otherFile == fromFile
+				sameRank = sameRank || otherRank == fromRank
+			}
+			if ambiguous && !sameFile {
+				san += FtoN(fromFile)
+			} else if ambiguous && !sameRank {
+				san += string('0' + fromRank)
+			} else if ambiguous {
+				san += RFtoN(fromRank, fromFile)
+			}
+		}
+		if capture {
+			san += "x"
+		}
+		san += RFtoN(toRank, toFile)
+		if move.Promotion != PiecePawn {
+			san += "=" + string(algebraic[move.Promotion>>1])
+		}
+	}
+	next := p.Clone()
+	next.apply(move)
+	if next.InCheck() {
+		if len(next.LegalMoves()) == 0 {
+			return san + "#"
+		}
+		return san + "+"
+	}
+	return san
+}
+
+// ParseSAN returns the legal move given in standard algebraic notation.
+// Check and annotation suffixes are ignored and castling may be
+// written with zeros as well as letters
+func (p *Position) ParseSAN(san string) (Move, bool) {
+	san = strings.TrimRight(san, "+#!?")
+	if san == "" {
+		return Move{}, false
+	}
+	castle := strings.ReplaceAll(san, "0", "O")
+	promotion := PiecePawn
+	if i := strings.IndexByte(san, '='); i >= 0 && i == len(san)-2 {
+		promotion = uint8(strings.IndexByte(algebraic, san[i+1])) << 1
+		if promotion < PieceKnight || promotion > PieceQueen {
+			return Move{}, false
+		}
+		san = san[:i]
+	}
+	piece := PiecePawn
+	if i := strings.IndexByte(algebraic, san[0]); i > 0 {
+		piece = uint8(i) << 1
+		san = san[1:]
+	}
+	san = strings.Replace(san, "x", "", 1)
+	if len(san) < 2 && castle != "O-O" && castle != "O-O-O" {
+		return Move{}, false
+	}
+
+	var found []Move
+	for _, move := range p.LegalMoves() {
+		switch {
+		case castle == "O-O":
+			if move.Piece&PieceMask != PieceKing || int(move.To)-int(move.From) != 2 {
+				continue
+			}
+		case castle == "O-O-O":
+			if move.Piece&PieceMask != PieceKing || int(move.From)-int(move.To) != 2 {
+				continue
+			}
+		case move.Piece&PieceMask != piece || move.Promotion != promotion:
+			continue
+		default:
+			toRank, toFile, ok := NtoRF(san[len(san)-2:])
+			if !ok || move.To != RFtoI(toRank, toFile) {
+				continue
+			}
+			fromRank, fromFile := ItoRF(move.From)
+			from := RFtoN(fromRank, fromFile)
+			if !matchesFrom(san[:len(san)-2], from) {
+				continue
+			}
+		}
+		found = append(found, move)
+	}
+	if len(found) != 1 {
+		return Move{}, false
+	}
+	return found[0], true
+}
+
+// matchesFrom reports whether the disambiguation of a SAN move, which
+// may be a file, a rank or a whole square, matches the square
+func matchesFrom(disambiguation, from string) bool {
+	switch len(disambiguation) {
+	case 0:
+		return true
+	case 1:
+		return strings.Contains(from, disambiguation)
+	}
+	return disambiguation == from
+}
@@ -0,0 +1,176 @@
+package engine
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func perft(p *Position, depth int) int {
+	if depth == 0 {
+		return 1
+	}
+	moves := p.LegalMoves()
+	if depth == 1 {
+		return len(moves)
+	}
+	nodes := 0
+	for _, move := range moves {
+		next := p.Clone()
+		next.apply(move)
+		nodes += perft(next, depth-1)
+	}
+	return nodes
+}
+
+func TestPosition_Perft(t *testing.T) {
+	tests := map[string]struct {
+		fen   string
+		nodes []int
+	}{
+		"start position": {
+			fen:   startPositionFEN,
+			nodes: []int{20, 400, 8902},
+		},
+		"kiwipete": {
+			fen:   "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+			nodes: []int{48, 2039},
+		},
+		"en passant and checks": {
+			fen:   "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+			nodes: []int{14, 191, 2812},
+		},
+		"promotions": {
+			fen:   "r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+			nodes: []int{6, 264, 9467},
+		},
+		"castling through check": {
+			fen:   "rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+			nodes: []int{44, 1486},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			p := NewPosition()
+			p.SetupBoard(test.fen)
+			for depth, nodes := range test.nodes {
+				assert.Equal(tt, nodes, perft(p, depth+1), "depth %d", depth+1)
+			}
+		})
+	}
+}
+
+func TestPosition_SAN(t *testing.T) {
+	tests := map[string]struct {
+		fen  string
+		move string
+		san  string
+		next string
+	}{
+		"pawn push": {
+			fen:  startPositionFEN,
+			move: "e2e4",
+			san:  "e4",
+			next: "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+		},
+		"file disambiguation": {
+			fen:  "4k3/8/8/8/8/8/8/R4RK1 w - - 0 1",
+			move: "a1d1",
+			san:  "Rad1",
+			next: "4k3/8/8/8/8/8/8/3R1RK1 b - - 1 1",
+		},
+		"rank disambiguation": {
+			fen:  "4k3/8/8/R7/8/8/8/R3K3 w - - 0 1",
+			move: "a5a3",
+			san:  "R5a3",
+			next: "4k3/8/8/8/8/R7/8/R3K3 b - - 1 1",
+		},
+		"square disambiguation": {
+			fen:  "6k1/8/8/8/Q6Q/8/8/Q3K3 w - - 0 1",
+			move: "a4d4",
+			san:  "Qa4d4",
+			next: "6k1/8/8/8/3Q3Q/8/8/Q3K3 b - - 1 1",
+		},
+		"en passant": {
+			fen:  "4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1",
+			move: "e5d6",
+			san:  "exd6",
+			next: "4k3/8/3P4/8/8/8/8/4K3 b - - 0 1",
+		},
+		"castle king side": {
+			fen:  "r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 3 10",
+			move: "e8g8",
+			san:  "O-O",
+			next: "r4rk1/8/8/8/8/8/8/R3K2R w KQ - 4 11",
+		},
+		"capture rook loses castling": {
+			fen:  "r3k2r/8/8/8/8/8/6b1/R3K2R b KQkq - 0 1",
+			move: "g2h1",
+			san:  "Bxh1",
+			next: "r3k2r/8/8/8/8/8/8/R3K2b w Qkq - 0 2",
+		},
+		"promotion with check": {
+			fen:  "4k3/1P6/8/8/8/8/8/4K3 w - - 0 1",
+			move: "b7b8q",
+			san:  "b8=Q+",
+			next: "1Q2k3/8/8/8/8/8/8/4K3 b - - 0 1",
+		},
+		"mate": {
+			fen:  "rnbqkbnr/pppp1ppp/8/4p3/6P1/5P2/PPPPP2P/RNBQKBNR b KQkq g3 0 2",
+			move: "d8h4",
+			san:  "Qh4#",
+			next: "rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			p := NewPosition()
+			p.SetupBoard(test.fen)
+			move, ok := p.ParseMove(test.move)
+			require.True(tt, ok)
+			assert.Equal(tt, test.move, move.String())
+			parsed, ok := p.ParseSAN(test.san)
+			require.True(tt, ok)
+			assert.Equal(tt, move, parsed)
+			assert.Equal(tt, test.san, p.Play(move))
+			assert.Equal(tt, test.next, p.GenerateFen())
+		})
+	}
+}
+
+func TestPosition_ParseSAN(t *testing.T) {
+	tests := map[string]struct {
+		fen  string
+		san  string
+		move string
+	}{
+		"castle with zeros":       {fen: "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", san: "0-0-0", move: "e1c1"},
+		"annotated":               {fen: startPositionFEN, san: "Nf3!?", move: "g1f3"},
+		"needless disambiguation": {fen: startPositionFEN, san: "Ngf3", move: "g1f3"},
+		"missing check":           {fen: "4k3/1P6/8/8/8/8/8/4K3 w - - 0 1", san: "b8=N", move: "b7b8n"},
+		"ambiguous":               {fen: "4k3/8/8/8/8/8/8/R4RK1 w - - 0 1", san: "Rd1"},
+		"illegal":                 {fen: startPositionFEN, san: "e5"},
+		"bad promotion":           {fen: "4k3/1P6/8/8/8/8/8/4K3 w - - 0 1", san: "b8=K"},
+		"nonsense":                {fen: startPositionFEN, san: "+"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			p := NewPosition()
+			p.SetupBoard(test.fen)
+			move, ok := p.ParseSAN(test.san)
+			assert.Equal(tt, test.move != "", ok)
+			if ok {
+				assert.Equal(tt, test.move, move.String())
+			}
+		})
+	}
+}
+
+func TestPosition_ParseMoveIllegal(t *testing.T) {
+	p := NewPosition()
+	p.SetupBoard(startPositionFEN)
+	for _, move := range []string{"e2e5", "e1e2", "e7e5", "a2a1q", "e2", "z9z9"} {
+		_, ok := p.ParseMove(move)
+		assert.False(t, ok, move)
+	}
+}
@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"io"
+	"time"
+	"us.figge.chess/internal/engine/uci"
+	"us.figge.chess/internal/game/clock"
+)
+
+type Option func(e *Engine)
+
+func OptEnginePath(path string, args ...string) Option {
+	return func(e *Engine) {
+		e.enginePath = path
+		e.engineArgs = args
+	}
+}
+
+func OptProtocol(protocol string) Option {
+	return func(e *Engine) {
+		e.protocol = protocol
+	}
+}
+
+func OptTranscript(writer io.Writer) Option {
+	return func(e *Engine) {
+		e.transcript = uci.NewTranscript(writer)
+	}
+}
+
+// OptPlayers sets the kind of player for each side, see KindHuman,
+// KindEngine, KindRandom and KindScript
+func OptPlayers(white, black string) Option {
+	return func(e *Engine) {
+		e.playerKinds = [2]string{white, black}
+	}
+}
+
+func OptSearch(depth int, movetime time.Duration) Option {
+	return func(e *Engine) {
+		e.depth = depth
+		e.movetime = movetime
+	}
+}
+
+// OptAnalysisLines sets how many of the best lines engine analysis
+// shows, for engines that can search more than one
+func OptAnalysisLines(lines int) Option {
+	return func(e *Engine) {
+		e.analysisLines = lines
+	}
+}
+
+// OptClock plays games on a clock with the time control, with the
+// clock's options such as the source it reads the time from
+func OptClock(control clock.Control, options ...clock.Option) Option {
+	return func(e *Engine) {
+		e.clock = clock.New(control, options...)
+	}
+}
@@ -0,0 +1,214 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+	"us.figge.chess/internal/engine/uci"
+)
+
+// Kinds of player that can be configured for each side
+const (
+	KindHuman  = "human"
+	KindEngine = "engine"
+	KindRandom = "random"
+	KindScript = "script" // followed by ':' and the moves to play
+)
+
+var (
+	ErrHumanPlayer = errors.New("human players move through the GUI")
+
+	// analyst moves both sides while a game is analysed
+	analyst = NewHumanPlayer("Analysis")
+)
+
+// Clock holds the time left for each side and their increments,
+// as handed to a player choosing a move. Zero times mean untimed
+type Clock struct {
+	WhiteTime      time.Duration
+	BlackTime      time.Duration
+	WhiteIncrement time.Duration
+	BlackIncrement time.Duration
+	MovesToGo      int // moves the player has to the next time control, zero for none
+	StageMoves     int // moves in the player's stage of the time control, zero for the rest of the game
+	StageTime      time.Duration
+}
+
+// IsTimed reports whether the game is played on the clock
+func (c Clock) IsTimed() bool {
+	return c.WhiteTime > 0 || c.BlackTime > 0
+}
+
+// History is how a position was reached: the game's starting position,
+// empty for the standard one, and the moves played from it in UCI
+// notation. Engines are sent the history rather than the position
+// alone, so that they can see repetitions and an XBoard engine can be
+// sent just the moves played since it last moved
+type History struct {
+	FEN   string
+	Moves string
+}
+
+// Player is anything that can choose a move for one side of the game.
+// ChooseMove is called on a copy of the position, away from the GUI
+// goroutine, so it may take as long as it needs
+type Player interface {
+	Name() string
+	IsHuman() bool
+	ChooseMove(position *Position, history History, clock Clock) (Move, error)
+}
+
+// Evaluator is implemented by players that can report their score,
+// in centipawns or mate in moves, for the move they last chose
+type Evaluator interface {
+	LastScore() (score int, mate bool, ok bool)
+}
+
+// HumanPlayer moves pieces through the GUI, so it is never asked
+// to choose a move
+type HumanPlayer struct {
+	name string
+}
+
+func NewHumanPlayer(name string) *HumanPlayer {
+	return &HumanPlayer{name: name}
+}
+
+func (h *HumanPlayer) Name() string  { return h.name }
+func (h *HumanPlayer) IsHuman() bool { return true }
+func (h *HumanPlayer) ChooseMove(_ *Position, _ History, _ Clock) (Move, error) {
+	return Move{}, ErrHumanPlayer
+}
+
+// EnginePlayer asks an external engine for its best move
+type EnginePlayer struct {
+	adapter  Adapter
+	depth    int
+	movetime time.Duration
+	score    *uci.ScoreResult
+}
+
+func NewEnginePlayer(adapter Adapter, depth int, movetime time.Duration) *EnginePlayer {
+	return &EnginePlayer{
+		adapter:  adapter,
+		depth:    depth,
+		movetime: movetime,
+	}
+}
+
+func (ep *EnginePlayer) Name() string  { return ep.adapter.Name() }
+func (ep *EnginePlayer) IsHuman() bool { return false }
+
+// ChooseMove searches to the player's depth or for its movetime, or
+// when the game is timed leaves the engine to spend its clock
+func (ep *EnginePlayer) ChooseMove(position *Position, history History, clock Clock) (Move, error) {
+	err := ep.adapter.SetPosition(history.FEN, history.Moves)
+	if err != nil {
+		return Move{}, fmt.Errorf("error setting position: %w", err)
+	}
+	var results *uci.Results
+	if clock.IsTimed() {
+		results, err = ep.adapter.GoClock(uci.Clock{
+			WhiteTime:      clock.WhiteTime,
+			BlackTime:      clock.BlackTime,
+			WhiteIncrement: clock.WhiteIncrement,
+			BlackIncrement: clock.BlackIncrement,
+			MovesToGo:      clock.MovesToGo,
+			StageMoves:     clock.StageMoves,
+			StageTime:      clock.StageTime,
+		})
+	} else {
+		results, err = ep.adapter.Go(ep.depth, "", ep.movetime.Milliseconds())
+	}
+	if err != nil {
+		return Move{}, fmt.Errorf("error getting moves: %w", err)
+	}
+	move, ok := position.ParseMove(results.BestMove)
+	if !ok {
+		return Move{}, fmt.Errorf("engine returned an invalid move: %q", results.BestMove)
+	}
+	ep.score = nil
+	for i := len(results.Results) - 1; i >= 0; i-- {
+		if results.Results[i].MultiPV <= 1 {
+			ep.score = &results.Results[i]
+			break
+		}
+	}
+	return move, nil
+}
+
+func (ep *EnginePlayer) LastScore() (int, bool, bool) {
+	if ep.score == nil {
+		return 0, false, false
+	}
+	return ep.score.Score, ep.score.Mate, true
+}
+
+// RandomPlayer plays a random legal move, which is
+// handy for testing the GUI and the other players
+type RandomPlayer struct {
+	random *rand.Rand
+}
+
+func NewRandomPlayer(seed int64) *RandomPlayer {
+	return &RandomPlayer{random: rand.New(rand.NewSource(seed))}
+}
+
+func (rp *RandomPlayer) Name() string  { return "Random" }
+func (rp *RandomPlayer) IsHuman() bool { return false }
+func (rp *RandomPlayer) ChooseMove(position *Position, _ History, _ Clock) (Move, error) {
+	moves := position.LegalMoves()
+	if len(moves) == 0 {
+		return Move{}, errors.New("no legal moves")
+	}
+	return moves[rp.random.Intn(len(moves))], nil
+}
+
+// ScriptedPlayer plays a fixed list of moves given in UCI notation
+type ScriptedPlayer struct {
+	moves []string
+	next  int
+}
+
+func NewScriptedPlayer(moves ...string) *ScriptedPlayer {
+	return &ScriptedPlayer{moves: moves}
+}
+
+func (sp *ScriptedPlayer) Name() string  { return "Script" }
+func (sp *ScriptedPlayer) IsHuman() bool { return false }
+func (sp *ScriptedPlayer) ChooseMove(position *Position, _ History, _ Clock) (Move, error) {
+	if sp.next >= len(sp.moves) {
+		return Move{}, errors.New("script has no more moves")
+	}
+	text := sp.moves[sp.next]
+	move, ok := position.ParseMove(text)
+	if !ok {
+		return Move{}, fmt.Errorf("scripted move %d is illegal: %s", sp.next+1, text)
+	}
+	sp.next++
+	return move, nil
+}
+
+// newPlayer creates a player of the given kind, launching the
+// external engine the first time an engine player is needed
+func (e *Engine) newPlayer(kind string) (Player, error) {
+	switch {
+	case kind == KindHuman:
+		return NewHumanPlayer("Human"), nil
+	case kind == KindRandom:
+		return NewRandomPlayer(time.Now().UnixNano()), nil
+	case strings.HasPrefix(kind, KindScript+":"):
+		return NewScriptedPlayer(strings.FieldsFunc(kind[len(KindScript)+1:], func(r rune) bool {
+			return r == ',' || r == ' '
+		})...), nil
+	case kind == KindEngine:
+		adapter, err := e.engineAdapter()
+		if err != nil {
+			return nil, err
+		}
+		return NewEnginePlayer(adapter, e.depth, e.movetime), nil
+	}
+	return nil, fmt.Errorf("unknown player %q", kind)
+}
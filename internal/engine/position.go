@@ -1,14 +1,17 @@
 package engine
 
 import (
+	"crypto/rand"
+	"encoding/binary"
 	"fmt"
+	"math/bits"
 	"strings"
 	. "us.figge.chess/internal/common"
 )
 
 var (
-	//hashKey        string
-	//keys           [576]uint64
+	keys           [576]uint64 // a random key for each square of each bitboard
+	statusKeys     [256]uint64 // a random key for each player to move and castling rights
 	knightMoves    [64]uint64
 	kingMoves      [64]uint64
 	whitePawnMoves [64]uint64
@@ -38,6 +41,7 @@ const (
 	RANK1     = 0x00000000000000FF
 	FileA     = 0x0101010101010101
 	FileH     = 0x8080808080808080
+	Light     = 0xAA55AA55AA55AA55
 )
 
 type Position struct {
@@ -97,88 +101,22 @@ func (p *Position) RemovePiece(pieceType uint8, rank, file uint8) {
 	p.bitboards[pb] &= notBit
 	p.bitboards[cb] &= notBit
 }
-func (p *Position) MovePiece(fromIndex, toIndex, pieceType uint8) (string, bool) {
-	p.ClearEnPassant()
-	move, moved := p.specialMove(fromIndex, toIndex, pieceType)
-	if !moved {
-		fromRank, fromFile := ItoRF(fromIndex)
-		toRank, toFile := ItoRF(toIndex)
-
-		// Find piece at destination location
-		bit := ItoB(toIndex)
-		targetPiece, found := p.identifyPiece(bit)
-
-		// Cannot move on top of own piece
-		if found && targetPiece&PlayerMask == pieceType&PlayerMask {
-			return "Square is occupied by players own piece", false
-		}
-
-		// Determine if piece is a pawn
-		piece := pieceType & PieceMask >> 1
-		if found && piece == PiecePawn {
-			move += FtoN(fromFile)
-		} else if piece != PiecePawn { // TODO: sames pieces, same ToIndex - Add N<file>xx, same file, use rank, not file
-			move += string(algebraic[piece])
-		} else if fromIndex-toIndex == 16 && fromIndex >= 48 && fromIndex <= 55 {
-			p.SetEnPassant(fromRank+1, fromFile)
-		} else if toIndex-fromIndex == 16 && fromIndex >= 8 && fromIndex <= 15 {
-			p.SetEnPassant(fromRank-1, fromFile)
-		}
-
-		// Remove piece from source location
-		p.RemovePiece(pieceType, fromRank, fromFile)
-
-		// Remove captured piece if found
-		if found {
-			move += "x"
-			p.RemovePiece(targetPiece, toRank, toFile)
-		}
-		// Set piece at destination location
-		p.SetPiece(pieceType, toRank, toFile)
-		move += RFtoN(toRank, toFile)
-	}
-
-	// Update half move count
 
-	// Update full move count
-	if p.Turn() == PlayerBlack {
-		p.fullMoves++
+// MovePiece plays the move of the piece between the square indexes if
+// it is legal, promoting to a queen, and returns the move in SAN
+func (p *Position) MovePiece(fromIndex, toIndex, pieceType uint8) (string, bool) {
+	move, ok := p.FindMove(fromIndex, toIndex, PieceQueen)
+	if !ok || move.Piece != pieceType {
+		return "Illegal move", false
 	}
-	p.SetTurn(1 - p.Turn()) // Switch turn
-
-	// Return move notification
-	return move, true
+	return p.Play(move), true
 }
 
-func (p *Position) specialMove(fromIndex uint8, toIndex uint8, pieceType uint8) (string, bool) {
-	player := pieceType & PlayerMask
-	castleRights := p.CastleRights()
-	if fromIndex == 60 && toIndex == 62 && player == PlayerWhite {
-		if castleRights&CastleRightsWhiteKing != 0 {
-			p.SetCastleRights(castleRights & CastleRightsBlackMask)
-			p.castle(60, 62, 63, 61, PlayerWhite)
-			return "O-O", true
-		}
-	} else if fromIndex == 60 && toIndex == 58 && player == PlayerWhite {
-		if castleRights&CastleRightsWhiteQueen != 0 {
-			p.SetCastleRights(castleRights & CastleRightsBlackMask)
-			p.castle(60, 58, 56, 59, PlayerWhite)
-			return "O-O-O", true
-		}
-	} else if fromIndex == 4 && toIndex == 6 && player == PlayerBlack {
-		if castleRights&CastleRightsBlackKing != 0 {
-			p.SetCastleRights(castleRights & CastleRightsWhiteMask)
-			p.castle(4, 6, 7, 5, PlayerBlack)
-			return "O-O", true
-		}
-	} else if fromIndex == 4 && toIndex == 2 && player == PlayerBlack {
-		if castleRights&CastleRightsBlackQueen != 0 {
-			p.SetCastleRights(castleRights & CastleRightsWhiteMask)
-			p.castle(4, 2, 0, 3, PlayerBlack)
-			return "O-O-O", true
-		}
-	}
-	return "", false
+// Play plays a legal move and returns it in SAN
+func (p *Position) Play(move Move) string {
+	san := p.SAN(move)
+	p.apply(move)
+	return san
 }
 
 func (p *Position) castle(kingFrom, kingTo, rookFrom, rookTo, player uint8) {
@@ -216,108 +154,107 @@ func (p *Position) identifyPiece(bit uint64) (uint8, bool) {
 	return 0, false
 }
 
-func (p *Position) SetupBoard(fen string) {
-	p.fullMoves = 0
-	p.halfMoves = make([]uint64, 0)
-	p.bitboards = [9]uint64{}
+// canMate reports whether the player could mate with some series of
+// legal moves, however badly the other side plays. A lone king can't,
+// nor can a single knight unless the other side has a piece other than
+// queens to block its king, nor bishops that all stand on one colour
+// with no knights or pawns on the board and no rooks or queens on the
+// other side to block its king
+func (p *Position) canMate(player uint8) bool {
+	own, other := p.bitboards[player&PlayerMask], p.bitboards[1-player&PlayerMask]
+	switch {
+	case own&(p.bitboards[BitPawns]|p.bitboards[BitRooks]|p.bitboards[BitQueens]) != 0:
+		return true
+	case own&p.bitboards[BitKnights] != 0:
+		return bits.OnesCount64(own) > 2 || other&^(p.bitboards[BitKings]|p.bitboards[BitQueens]) != 0
+	case own&p.bitboards[BitBishops] != 0:
+		bishops := p.bitboards[BitBishops]
+		oneColour := bishops&Light == 0 || bishops&^Light == 0
+		return !oneColour || p.bitboards[BitPawns]|p.bitboards[BitKnights] != 0 ||
+			other&(p.bitboards[BitRooks]|p.bitboards[BitQueens]) != 0
+	}
+	return false
+}
 
-	// Parse the FEN string and set up the board
-	index := uint8(0)
-bitboards:
-	for i := 0; i < len(fen); i++ {
-		c := fen[i]
-		switch c {
-		case '1', '2', '3', '4', '5', '6', '7', '8':
-			index += c - '0'
-		case '/':
-			continue
-		case ' ':
-			fen = fen[i+1:]
-			break bitboards
-		case 'K', 'Q', 'R', 'B', 'N', 'P', 'k', 'q', 'r', 'b', 'n', 'p':
-			rank, file := ItoRF(index)
-			p.SetPiece(fenPieceMap[c], rank, file)
-			index++
+// Draw rules a game can end by, other than stalemate
+const (
+	DrawFiftyMoves = "fifty-move rule"
+	DrawRepetition = "threefold repetition"
+	DrawMaterial   = "insufficient material"
+)
+
+// key identifies the position to spot repetitions, with a Zobrist hash
+// of the pieces, the player to move, the castling rights and the en
+// passant square when a pawn could take en passant
+func (p *Position) key() uint64 {
+	key := statusKeys[p.status]
+	for bb := BitWhite; bb < BitEnPassant; bb++ {
+		for board := p.bitboards[bb]; board != 0; board &= board - 1 {
+			key ^= keys[int(bb)*64+bits.TrailingZeros64(board)]
 		}
 	}
-	parts := strings.Split(fen, " ")
-	if len(parts) > 0 && len(parts[0]) > 0 {
-		p.readFenTurn(parts[0])
-	}
-	if len(parts) > 1 && len(parts[1]) > 0 {
-		p.readFenCastling(parts[1])
-	}
-	if len(parts) > 2 && len(parts[2]) > 0 {
-		p.readFenEnpassant(parts[2])
-	}
-	if len(parts) > 3 && len(parts[3]) > 0 {
-		p.readFenHalfMove(parts[3])
-	}
-	if len(parts) > 4 && len(parts[4]) > 0 {
-		p.readFenFullMove(parts[4])
+	if ep := p.EnPassant(); ep != 0 && p.canTakeEnPassant() {
+		key ^= keys[int(BitEnPassant)*64+bits.TrailingZeros64(ep)]
 	}
+	return key
 }
-func (p *Position) readFenTurn(turn string) {
-	t := PlayerWhite
-	if strings.EqualFold(turn, "b") {
-		t = PlayerBlack
-	} else if turn != "w" {
-		fmt.Printf("Invalid turn fen: %s\n", turn)
-	}
-	p.SetTurn(t)
-}
-func (p *Position) readFenCastling(castling string) {
-	castleRights := uint8(0)
-	for _, c := range castling {
-		switch c {
-		case 'K':
-			castleRights |= CastleRightsWhiteKing
-		case 'Q':
-			castleRights |= CastleRightsWhiteQueen
-		case 'k':
-			castleRights |= CastleRightsBlackKing
-		case 'q':
-			castleRights |= CastleRightsBlackQueen
-		case '-':
-			castleRights = 0
-			break
-		default:
-			fmt.Printf("Invalid castling fen: %s\n", castling)
-		}
+
+// canTakeEnPassant reports whether a pawn of the player to move stands
+// beside the pawn that can be taken en passant
+func (p *Position) canTakeEnPassant() bool {
+	rank, file := BtoRF(p.EnPassant())
+	if p.Turn() == PlayerWhite {
+		rank--
+	} else {
+		rank++
 	}
-	p.SetCastleRights(castleRights)
-}
-func (p *Position) readFenEnpassant(enpassant string) {
-	switch enpassant {
-	case "-":
-		p.ClearEnPassant()
-	default:
-		if rank, file, ok := NtoRF(enpassant); ok {
-			p.SetEnPassant(rank, file)
-		} else {
-			fmt.Printf("Invalid enPassant fen: %s\n", enpassant)
+	pawns := p.bitboards[BitPawns] & p.bitboards[p.Turn()]
+	return file > 1 && pawns&RFtoB(rank, file-1) != 0 || file < 8 && pawns&RFtoB(rank, file+1) != 0
+}
+
+// repetitions returns how many times the position has occurred since
+// the last capture or pawn move, counting this time
+func (p *Position) repetitions() int {
+	key, count := p.key(), 1
+	for _, earlier := range p.halfMoves {
+		if earlier == key {
+			count++
 		}
 	}
+	return count
 }
-func (p *Position) readFenHalfMove(halfMove string) {
-	halfMoveCount := 0
-	if _, err := fmt.Sscanf(halfMove, "%d", &halfMoveCount); err != nil {
-		fmt.Printf("Invalid halfmove fen: %s\n", halfMove)
-	}
-	p.halfMoves = make([]uint64, halfMoveCount)
+
+// drawReason returns the rule the position is drawn by, if it is,
+// other than stalemate: neither side having the material to mate,
+// fifty moves by each side with no capture or pawn move, or the same
+// position occurring three times
+func (p *Position) drawReason() string {
+	switch {
+	case !p.canMate(PlayerWhite) && !p.canMate(PlayerBlack):
+		return DrawMaterial
+	case len(p.halfMoves) >= 100:
+		return DrawFiftyMoves
+	case p.repetitions() >= 3:
+		return DrawRepetition
+	}
+	return ""
 }
-func (p *Position) readFenFullMove(fullMove string) {
-	fullMoveCount := 0
-	if _, err := fmt.Sscanf(fullMove, "%d", &fullMoveCount); err != nil {
-		fmt.Printf("Invalid fullmove fen: %s\n", fullMove)
+
+// SetupBoard sets up the position from a FEN, leaving it unchanged
+// when the FEN is invalid, see ParseFEN
+func (p *Position) SetupBoard(fen string) error {
+	position, err := ParseFEN(fen)
+	if err != nil {
+		return err
 	}
-	p.fullMoves = fullMoveCount
+	*p = *position
+	return nil
 }
 
 func (p *Position) GenerateFen() string {
 	count := 0
 	sb := &strings.Builder{}
-	for rank := uint8(1); rank <= 8; rank++ {
+	for rank := uint8(8); rank >= 1; rank-- {
 		for file := uint8(1); file <= 8; file++ {
 			bit := RFtoB(rank, file)
 			if pieceType, ok := p.identifyPiece(bit); ok {
@@ -329,7 +266,7 @@ func (p *Position) GenerateFen() string {
 		if count != 0 {
 			p.writeFenEntry(sb, &count, nil)
 		}
-		if rank < 8 {
+		if rank > 1 {
 			sb.WriteByte('/')
 		}
 	}
@@ -442,14 +379,16 @@ func (p *Position) debugPrintBitBoard(bitboard uint64, b uint64) {
 
 func init() {
 	// Key generation
-	//bs := make([]byte, 8)
-	//for i := range keys {
-	//	n, err := rand.Read(bs)
-	//	if err != nil || n != 8 {
-	//		panic("Random key generation failed")
-	//	}
-	//	keys[i] = binary.BigEndian.Uint64(bs)
-	//}
+	bs := make([]byte, 8)
+	for _, table := range [][]uint64{keys[:], statusKeys[:]} {
+		for i := range table {
+			n, err := rand.Read(bs)
+			if err != nil || n != 8 {
+				panic("Random key generation failed")
+			}
+			table[i] = binary.BigEndian.Uint64(bs)
+		}
+	}
 	generateRanksAndFiles()
 	generateKnightMoves()
 	generateKingMoves()
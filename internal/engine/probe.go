@@ -0,0 +1,192 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	probeMovetime = 500 * time.Millisecond // how long a hint or threat is searched for
+	probeHash     = 16                     // MB of hash for the probe engine, as it only searches briefly
+)
+
+// ErrInCheck is returned by Threat when the side to move is in check,
+// so it can't pass to see what the opponent threatens
+var ErrInCheck = errors.New("no threat can be shown while in check")
+
+// Probe is the move a short search found in the position on the board:
+// the best move for a hint, or for a threat the move the opponent
+// would play if the side to move could pass
+type Probe struct {
+	Threat bool
+	Move   Move
+	SAN    string
+}
+
+// probe is a short search of a position, run on an engine of its own
+// so that it doesn't disturb the game or its analysis
+type probe struct {
+	fen      string // the position on the board
+	position *Position
+	history  History // how the position searched was reached
+	threat   bool
+	done     chan struct{}
+	result   Probe
+	err      error
+}
+
+// Hint starts a short search for the best move in the position on the
+// board, which Probe returns once it is found
+func (e *Engine) Hint() error {
+	return e.startProbe(false)
+}
+
+// Threat starts a short search of the position on the board with the
+// side to move passing, to find what the opponent threatens. Probe
+// returns the opponent's move once it is found
+func (e *Engine) Threat() error {
+	return e.startProbe(true)
+}
+
+// Probe returns the hint or threat found in the position on the board,
+// and whether the search for it has finished
+func (e *Engine) Probe() (Probe, bool) {
+	p := e.probe
+	if p == nil || p.fen != e.FEN() {
+		return Probe{}, false
+	}
+	select {
+	case <-p.done:
+		return p.result, p.err == nil
+	default:
+		return Probe{}, false
+	}
+}
+
+// startProbe queues a search of the position on the board, started by
+// updateProbe once the engine has finished any search before it
+func (e *Engine) startProbe(threat bool) error {
+	fen := e.FEN()
+	for _, p := range []*probe{e.probe, e.nextProbe} {
+		if p != nil && p.fen == fen && p.threat == threat {
+			return nil
+		}
+	}
+	if len(e.position.LegalMoves()) == 0 {
+		return errors.New("the game is over")
+	}
+	position, history := e.position.Clone(), e.history()
+	if threat {
+		if position.InCheck() {
+			return ErrInCheck
+		}
+		// no move passes, so the engine is sent the position as it
+		// would be after one
+		position.SetTurn(1 - position.Turn())
+		position.ClearEnPassant()
+		history = History{FEN: position.GenerateFen()}
+	}
+	e.nextProbe = &probe{
+		fen:      fen,
+		position: position,
+		history:  history,
+		threat:   threat,
+		done:     make(chan struct{}),
+	}
+	return nil
+}
+
+// updateProbe reports a search that failed and starts the one queued
+// when the engine is free
+func (e *Engine) updateProbe() error {
+	if p := e.probe; p != nil {
+		select {
+		case <-p.done:
+			if p.err != nil {
+				e.probe = nil
+				return fmt.Errorf("%s: %w", p.name(), p.err)
+			}
+		default:
+			return nil
+		}
+	}
+	p := e.nextProbe
+	if p == nil {
+		return nil
+	}
+	e.nextProbe = nil
+	e.probe = p
+	// the engine is launched in the background too, so its handshake
+	// doesn't hold up a frame
+	go func() {
+		defer close(p.done)
+		adapter, err := e.probeEngine()
+		if err != nil {
+			p.err = err
+			return
+		}
+		p.result, p.err = p.search(adapter)
+	}()
+	return nil
+}
+
+// probeEngine returns the engine hints and threats are searched with,
+// launching it the first time it is needed. It plays at full strength
+// whatever the strength of the engine playing the game, on a single
+// thread with a small hash so as not to take resources from it. Only
+// the probe's goroutine calls it, one probe at a time
+func (e *Engine) probeEngine() (Adapter, error) {
+	if e.probeAdapter != nil {
+		return e.probeAdapter, nil
+	}
+	adapter, err := e.startAdapter(e.transcript.Tagged("probe"))
+	if err != nil {
+		return nil, err
+	}
+	options := e.engineOptions
+	options.MultiPV, options.Elo = 1, 0
+	options.Hash, options.Threads = probeHash, 1
+	err = adapter.SetOptions(options)
+	if err != nil {
+		adapter.Close()
+		return nil, fmt.Errorf("error setting engine options: %w", err)
+	}
+	e.probeAdapter = adapter
+	return adapter, nil
+}
+
+func (p *probe) search(adapter Adapter) (Probe, error) {
+	err := adapter.SetPosition(p.history.FEN, p.history.Moves)
+	if err != nil {
+		return Probe{}, fmt.Errorf("error setting position: %w", err)
+	}
+	results, err := adapter.Go(0, "", probeMovetime.Milliseconds())
+	if err != nil {
+		return Probe{}, fmt.Errorf("error getting moves: %w", err)
+	}
+	move, ok := p.position.ParseMove(results.BestMove)
+	if !ok {
+		return Probe{}, fmt.Errorf("engine returned an invalid move: %q", results.BestMove)
+	}
+	return Probe{Threat: p.threat, Move: move, SAN: p.position.SAN(move)}, nil
+}
+
+func (p *probe) name() string {
+	if p.threat {
+		return "threat"
+	}
+	return "hint"
+}
+
+// stopProbe waits for any search to finish and closes the engine
+func (e *Engine) stopProbe() {
+	if e.probe != nil {
+		<-e.probe.done
+		e.probe = nil
+	}
+	if e.probeAdapter != nil {
+		e.probeAdapter.Close()
+		e.probeAdapter = nil
+	}
+}
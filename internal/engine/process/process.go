@@ -0,0 +1,275 @@
+// Package process runs an external chess engine and exchanges
+// text lines with it, enforcing read and write deadlines and
+// detecting when the process dies.
+package process
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// default deadlines for communicating with the engine process
+const (
+	DefaultReadTimeout  = 10 * time.Second
+	DefaultWriteTimeout = 2 * time.Second
+	stderrLimit         = 4096
+)
+
+var (
+	ErrTimeout = errors.New("engine did not respond in time")
+	ErrExited  = errors.New("engine process exited")
+)
+
+// Recorder is told about every line exchanged with the process
+type Recorder interface {
+	Sent(line string)
+	Received(line string)
+}
+
+// Process is a running engine executable
+type Process struct {
+	cmd          *exec.Cmd
+	stdin        *os.File
+	lines        chan string
+	exited       chan struct{}
+	exitErr      error
+	stderr       *stderrTail
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	mutex        sync.RWMutex
+	recorder     Recorder
+}
+
+// Start launches the executable with its stdin and stdout
+// connected for line based communication
+func Start(path string, arg ...string) (*Process, error) {
+	p := &Process{
+		lines:        make(chan string, 256),
+		exited:       make(chan struct{}),
+		stderr:       &stderrTail{},
+		readTimeout:  DefaultReadTimeout,
+		writeTimeout: DefaultWriteTimeout,
+	}
+	p.cmd = exec.Command(path, arg...)
+	p.cmd.Stderr = p.stderr
+	stdinReader, stdinWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		_ = stdinReader.Close()
+		_ = stdinWriter.Close()
+		return nil, err
+	}
+	p.cmd.Stdin = stdinReader
+	p.cmd.Stdout = stdoutWriter
+	err = p.cmd.Start()
+	_ = stdinReader.Close()
+	_ = stdoutWriter.Close()
+	if err != nil {
+		_ = stdinWriter.Close()
+		_ = stdoutReader.Close()
+		return nil, err
+	}
+	p.stdin = stdinWriter
+	go p.readLines(stdoutReader)
+	go func() {
+		p.exitErr = p.cmd.Wait()
+		close(p.exited)
+	}()
+	return p, nil
+}
+
+// SetTimeouts changes how long the process may take to answer a
+// line (on top of any extra time asked for) and to accept a command
+func (p *Process) SetTimeouts(read, write time.Duration) {
+	p.readTimeout = read
+	p.writeTimeout = write
+}
+
+// SetRecorder starts telling the recorder about every line
+// exchanged with the process, or stops if it is nil
+func (p *Process) SetRecorder(recorder Recorder) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.recorder = recorder
+}
+
+// Stderr returns the most recent output the process wrote to stderr
+func (p *Process) Stderr() string {
+	return p.stderr.String()
+}
+
+// Exited reports whether the process has terminated
+func (p *Process) Exited() bool {
+	select {
+	case <-p.exited:
+		return true
+	default:
+		return false
+	}
+}
+
+// Send writes a single command line to the process
+func (p *Process) Send(command string) error {
+	if p.Exited() {
+		return p.exitError()
+	}
+	p.record(func(r Recorder) { r.Sent(command) })
+	_ = p.stdin.SetWriteDeadline(time.Now().Add(p.writeTimeout))
+	_, err := p.stdin.WriteString(command + "\n")
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return ErrTimeout
+	}
+	if err != nil {
+		// a broken pipe means the process is going, even when it
+		// hasn't finished exiting yet
+		return p.exitError()
+	}
+	return nil
+}
+
+// ReadLine waits for the next line from the process. The extra
+// duration is added to the read timeout for commands that are
+// expected to take a while, such as a timed search
+func (p *Process) ReadLine(extra time.Duration) (string, error) {
+	return p.ReadLineWithin(p.readTimeout + extra)
+}
+
+// ReadLineWithin waits for the next line from the process for no
+// longer than the timeout, whatever the read timeout is
+func (p *Process) ReadLineWithin(timeout time.Duration) (string, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case line, ok := <-p.lines:
+		if !ok {
+			return "", p.exitError()
+		}
+		return line, nil
+	case <-timer.C:
+		return "", ErrTimeout
+	}
+}
+
+// ReadLineUntil waits for the next line from the process for as long
+// as it takes, as for a search with no limit, and returns false if
+// done is closed first
+func (p *Process) ReadLineUntil(done <-chan struct{}) (string, bool, error) {
+	select {
+	case line, ok := <-p.lines:
+		if !ok {
+			return "", false, p.exitError()
+		}
+		return line, true, nil
+	case <-done:
+		return "", false, nil
+	}
+}
+
+// ReadUntil passes lines to handle until one starting with prefix is read
+func (p *Process) ReadUntil(prefix string, handle func(line string)) (string, error) {
+	for {
+		line, err := p.ReadLine(0)
+		if err != nil {
+			return "", err
+		}
+		if strings.HasPrefix(line, prefix) {
+			return line, nil
+		}
+		if handle != nil {
+			handle(line)
+		}
+	}
+}
+
+// Close sends the commands that ask the process to quit, killing
+// the process if it has not exited shortly afterwards
+func (p *Process) Close(commands ...string) {
+	if !p.Exited() {
+		var err error
+		for _, command := range commands {
+			if err = p.Send(command); err != nil {
+				log.Println("failed to stop engine:", err)
+				break
+			}
+		}
+	}
+	select {
+	case <-p.exited:
+	case <-time.After(p.writeTimeout):
+		err := p.cmd.Process.Kill()
+		if err != nil {
+			log.Println("failed to kill engine:", err)
+		}
+		<-p.exited
+	}
+	_ = p.stdin.Close()
+}
+
+func (p *Process) readLines(stdout *os.File) {
+	defer close(p.lines)
+	defer func() { _ = stdout.Close() }()
+	reader := bufio.NewReader(stdout)
+	for {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if line != "" {
+			p.record(func(r Recorder) { r.Received(line) })
+			p.lines <- line
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (p *Process) record(note func(r Recorder)) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	if p.recorder != nil {
+		note(p.recorder)
+	}
+}
+
+func (p *Process) exitError() error {
+	select {
+	case <-p.exited:
+	case <-time.After(p.writeTimeout):
+		return fmt.Errorf("%w: stdout closed", ErrExited)
+	}
+	if stderr := strings.TrimSpace(p.Stderr()); stderr != "" {
+		return fmt.Errorf("%w (%v): %s", ErrExited, p.exitErr, stderr)
+	}
+	return fmt.Errorf("%w (%v)", ErrExited, p.exitErr)
+}
+
+// stderrTail keeps the last few kilobytes written to the engine's stderr
+type stderrTail struct {
+	mutex sync.Mutex
+	data  []byte
+}
+
+func (t *stderrTail) Write(p []byte) (int, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.data = append(t.data, p...)
+	if len(t.data) > stderrLimit {
+		t.data = t.data[len(t.data)-stderrLimit:]
+	}
+	return len(p), nil
+}
+
+func (t *stderrTail) String() string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return string(t.data)
+}
@@ -0,0 +1,26 @@
+package process
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestProcess_SendBrokenPipe(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell")
+	}
+	// the process closes its stdin and lingers, so writes fail before
+	// it has exited
+	p, err := Start("sh", "-c", "exec 0<&-; exec sleep 5")
+	require.NoError(t, err)
+	p.SetTimeouts(100*time.Millisecond, 100*time.Millisecond)
+	defer p.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	err = p.Send("isready")
+	assert.True(t, errors.Is(err, ErrExited), "expected %v, got %v", ErrExited, err)
+}
@@ -0,0 +1,177 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	. "us.figge.chess/internal/common"
+	"us.figge.chess/internal/game/tree"
+	"us.figge.chess/internal/pgn"
+)
+
+const (
+	startPositionFEN = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+)
+
+// Result returns the PGN result at the end of the mainline, "*" while
+// the game is in progress. A loaded game keeps its result, such as a
+// resignation, until a new move is played
+func (e *Engine) Result() string {
+	if e.result != "" && e.result != pgn.ResultOngoing {
+		return e.result
+	}
+	position, _ := ParseFEN(e.fen)
+	for _, node := range e.tree.Mainline() {
+		move, _ := position.ParseMove(node.Move)
+		position.apply(move)
+	}
+	return position.result()
+}
+
+// PositionResult returns the result of the game at the position on the
+// board, which may end a variation rather than the mainline
+func (e *Engine) PositionResult() string {
+	if e.termination != "" {
+		return e.result
+	}
+	return e.position.result()
+}
+
+// result returns the PGN result of the game ending in the position
+func (p *Position) result() string {
+	switch {
+	case len(p.LegalMoves()) > 0 && p.drawReason() == "":
+		return pgn.ResultOngoing
+	case len(p.LegalMoves()) > 0 || !p.InCheck():
+		return pgn.ResultDraw
+	case p.Turn() == PlayerWhite:
+		return pgn.ResultBlackWins
+	}
+	return pgn.ResultWhiteWins
+}
+
+// Record returns the game played so far with its variations. A
+// loaded game keeps its tags and comments
+func (e *Engine) Record() *pgn.Game {
+	g := &pgn.Game{
+		Comment:     e.comment,
+		Moves:       e.tree.Moves(),
+		Result:      e.Result(),
+		Annotations: e.tree.Root().Annotations.Clone(),
+	}
+	if e.tags != nil {
+		g.Tags = append([]pgn.Tag(nil), e.tags...)
+		g.SetTag("Result", g.Result)
+		e.setTermination(g)
+		return g
+	}
+	g.SetTag("Event", "Lutefisk Chess")
+	g.SetTag("Site", "?")
+	g.SetTag("Date", pgn.FormatDate(e.started))
+	g.SetTag("Round", "-")
+	g.SetTag("White", e.Player(PlayerWhite).Name())
+	g.SetTag("Black", e.Player(PlayerBlack).Name())
+	for player, tag := range []string{"WhiteElo", "BlackElo"} {
+		if _, ok := e.Player(uint8(player)).(*EnginePlayer); ok && e.engineOptions.Elo > 0 {
+			g.SetTag(tag, strconv.Itoa(e.engineOptions.Elo))
+		}
+	}
+	if e.fen != startPositionFEN {
+		g.SetTag("SetUp", "1")
+		g.SetTag("FEN", e.fen)
+	}
+	e.setTermination(g)
+	return g
+}
+
+// setTermination tags a game that ended other than on the board
+func (e *Engine) setTermination(g *pgn.Game) {
+	if e.termination != "" {
+		g.SetTag("Termination", e.termination)
+	}
+}
+
+// LoadGame checks every move of the game and its variations is legal
+// and shows its starting position, ready to be stepped through
+func (e *Engine) LoadGame(g *pgn.Game) error {
+	fen, ok := g.Tag("FEN")
+	if !ok {
+		fen = startPositionFEN
+	}
+	position, err := ParseFEN(fen)
+	if err != nil {
+		return fmt.Errorf("FEN tag: %w", err)
+	}
+	t := tree.New()
+	t.Root().Annotations = g.Annotations.Clone()
+	if err = replay(position, t.Root(), g.Moves); err != nil {
+		return err
+	}
+	if err = e.SetFEN(fen); err != nil {
+		return err
+	}
+	e.tree = t
+	e.tags = append([]pgn.Tag(nil), g.Tags...)
+	e.comment = g.Comment
+	e.result = g.Result
+	return nil
+}
+
+// replay adds the moves to the tree after the node, checking they are
+// legal. The variations of each move are played from the position
+// before it and added as sidelines
+func replay(position *Position, node *tree.Node, moves []pgn.Move) error {
+	for _, m := range moves {
+		move, ok := position.ParseSAN(m.SAN)
+		if !ok {
+			return m.Errorf("illegal move %s", m.SAN)
+		}
+		child := node.AddChild(move.String(), position.SAN(move))
+		child.Comment = m.Comment
+		child.NAGs = slices.Clone(m.NAGs)
+		child.Clock = m.Clock
+		child.Eval = m.Eval
+		child.Annotations = m.Annotations.Clone()
+		for _, variation := range m.Variations {
+			if err := replay(position.Clone(), node, variation); err != nil {
+				return err
+			}
+		}
+		position.apply(move)
+		node = child
+	}
+	return nil
+}
+
+// SavePGN writes the game to a file in the directory named after the
+// time the game started, so saving again replaces the earlier save
+func (e *Engine) SavePGN(dir string) (string, error) {
+	path := filepath.Join(dir, "lutefisk-"+e.started.Format("20060102-150405")+".pgn")
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("error saving game: %w", err)
+	}
+	err = pgn.Write(f, e.Record())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", fmt.Errorf("error saving game: %w", err)
+	}
+	return path, nil
+}
+
+// recordEval adds the score of the player's last move, from white's
+// point of view, to the record
+func (e *Engine) recordEval(player uint8, evaluator Evaluator) {
+	score, mate, ok := evaluator.LastScore()
+	if !ok || e.tree.Current().Parent() == nil {
+		return
+	}
+	if player == PlayerBlack {
+		score = -score
+	}
+	e.tree.Current().Eval = pgn.FormatEval(score, mate)
+}
@@ -0,0 +1,259 @@
+package engine
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"strings"
+	"testing"
+	. "us.figge.chess/internal/common"
+	"us.figge.chess/internal/engine/uci/ucitest"
+	"us.figge.chess/internal/pgn"
+)
+
+func TestEngine_Record(t *testing.T) {
+	fake := ucitest.New(t, `
+> uci
+< id name Fakefish 1
+< uciok
+> go*
+< info depth 10 score cp 20 pv e7e5
+< bestmove e7e5
+> go*
+< info depth 10 score mate 1 pv d8h4
+< bestmove d8h4
+`)
+	e := NewEngine(OptEnginePath(fake.Path()), OptPlayers(KindScript+":f2f3 g2g4", KindEngine))
+	defer e.Close()
+	require.NoError(t, e.SetFEN(""))
+	assert.Equal(t, pgn.ResultOngoing, e.Result())
+	for range 4 {
+		_, err := awaitMove(t, e)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, pgn.ResultBlackWins, e.Result())
+
+	path, err := e.SavePGN(t.TempDir())
+	require.NoError(t, err)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	text := string(data)
+	assert.True(t, strings.HasPrefix(text, "[Event \"Lutefisk Chess\"]\n"))
+	assert.Contains(t, text, "[White \"Script\"]\n[Black \"Fakefish 1\"]\n[Result \"0-1\"]\n[BlackElo \"800\"]\n\n")
+	assert.Contains(t, text, "1. f3 e5 {[%eval -0.20]} 2. g4 Qh4# {[%eval #-1]} 0-1\n")
+	assert.NotContains(t, text, "[FEN ")
+}
+
+func TestEngine_Draws(t *testing.T) {
+	repeat := []string{"Nf3", "Nf6", "Ng1", "Ng8", "Nf3", "Nf6", "Ng1"}
+	tests := map[string]struct {
+		fen    string
+		moves  []string
+		result string
+		reason string
+	}{
+		"fifty moves":            {"4k3/8/8/8/8/8/8/R3K3 w - - 99 80", []string{"Ra2"}, pgn.ResultDraw, DrawFiftyMoves},
+		"forty nine moves":       {"4k3/8/8/8/8/8/8/R3K3 w - - 98 80", []string{"Ra2"}, pgn.ResultOngoing, ""},
+		"pawn move resets":       {"4k3/8/8/8/8/8/P7/R3K3 w - - 99 80", []string{"a3"}, pgn.ResultOngoing, ""},
+		"threefold repetition":   {"", append(repeat, "Ng8"), pgn.ResultDraw, DrawRepetition},
+		"twofold repetition":     {"", repeat, pgn.ResultOngoing, ""},
+		"bare kings":             {"4k3/8/8/8/8/8/3p4/4K3 w - - 0 1", []string{"Kxd2"}, pgn.ResultDraw, DrawMaterial},
+		"king and bishop":        {"4k3/8/8/8/8/8/8/2B1K3 w - - 0 1", nil, pgn.ResultDraw, DrawMaterial},
+		"king and pawn":          {"4k3/8/8/8/8/8/4P3/4K3 w - - 0 1", nil, pgn.ResultOngoing, ""},
+		"bishops on one colour":  {"3bk3/8/8/8/8/8/8/2B1K3 w - - 0 1", nil, pgn.ResultDraw, DrawMaterial},
+		"bishops on two colours": {"2b1k3/8/8/8/8/8/8/2B1K3 w - - 0 1", nil, pgn.ResultOngoing, ""},
+		"knights":                {"4kn2/8/8/8/8/8/8/4KN2 w - - 0 1", nil, pgn.ResultOngoing, ""},
+		"bishop against a rook":  {"1r2k3/8/8/8/8/8/8/2B1K3 w - - 0 1", nil, pgn.ResultOngoing, ""},
+		"bishop against a queen": {"1q2k3/8/8/8/8/8/8/2B1K3 w - - 0 1", nil, pgn.ResultOngoing, ""},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			e := NewEngine(OptPlayers(KindHuman, KindHuman))
+			defer e.Close()
+			require.NoError(tt, e.SetFEN(test.fen))
+			for _, move := range test.moves {
+				_, ok := e.PlayMove(move)
+				require.True(tt, ok, move)
+			}
+			assert.Equal(tt, test.result, e.Result())
+			assert.Equal(tt, test.reason, e.DrawReason())
+			assert.Equal(tt, test.reason != "", e.IsGameOver())
+		})
+	}
+}
+
+func TestEngine_RecordSetUp(t *testing.T) {
+	fen := "4k3/8/8/8/8/8/4P3/4K3 b - - 0 12"
+	e := NewEngine(OptPlayers(KindHuman, KindScript+":e8d7"))
+	defer e.Close()
+	require.NoError(t, e.SetFEN(fen))
+	_, err := awaitMove(t, e)
+	require.NoError(t, err)
+
+	g := e.Record()
+	value, _ := g.Tag("SetUp")
+	assert.Equal(t, "1", value)
+	value, _ = g.Tag("FEN")
+	assert.Equal(t, fen, value)
+	_, ok := g.Tag("WhiteElo")
+	assert.False(t, ok)
+	assert.Equal(t, []pgn.Move{{SAN: "Kd7"}}, g.Moves)
+}
+
+func TestEngine_LoadGame(t *testing.T) {
+	games, err := pgn.ReadAll(strings.NewReader(`[Event "Opera Game"]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 d6 (2... Nc6 3. Bb5) 3. d4 Bg4 {pinning} 4. dxe5 1-0
+`))
+	require.NoError(t, err)
+	e := NewEngine(OptPlayers(KindHuman, KindScript+":c8g4"))
+	defer e.Close()
+	require.NoError(t, e.LoadGame(games[0]))
+
+	ply, plies := e.Ply()
+	assert.Equal(t, 0, ply)
+	assert.Equal(t, 7, plies)
+	assert.Equal(t, startPositionFEN, e.position.GenerateFen())
+	_, ok := e.LastMove()
+	assert.False(t, ok)
+
+	e.GotoPly(4)
+	assert.Equal(t, "rnbqkbnr/ppp2ppp/3p4/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 0 3", e.position.GenerateFen())
+	move, ok := e.LastMove()
+	require.True(t, ok)
+	assert.Equal(t, "d7d6", move.String())
+	assert.Equal(t, "1-0", e.Result())
+
+	e.GotoPly(99)
+	ply, _ = e.Ply()
+	assert.Equal(t, 7, ply)
+	g := e.Record()
+	assert.Equal(t, "pinning", g.Moves[5].Comment)
+	assert.Len(t, g.Moves[3].Variations, 1)
+	event, _ := g.Tag("Event")
+	assert.Equal(t, "Opera Game", event)
+
+	// playing the move of the game follows it, so the players wait
+	e.GotoPly(4)
+	_, ok = e.MovePiece(squareIndex("d2"), squareIndex("d4"), PiecePawn|PlayerWhite)
+	require.True(t, ok)
+	ply, plies = e.Ply()
+	assert.Equal(t, 5, ply)
+	assert.Equal(t, 7, plies)
+
+	// playing a different move starts a variation, until it is
+	// promoted to the mainline
+	e.GotoPly(4)
+	_, ok = e.MovePiece(squareIndex("f1"), squareIndex("c4"), PieceBishop|PlayerWhite)
+	require.True(t, ok)
+	played, err := awaitMove(t, e)
+	require.NoError(t, err)
+	assert.Equal(t, "Bg4", played.SAN)
+	ply, plies = e.Ply()
+	assert.Equal(t, 6, ply)
+	assert.Equal(t, 6, plies)
+	assert.Equal(t, "1-0", e.Result())
+	assert.Equal(t, pgn.ResultOngoing, e.PositionResult())
+	var sb strings.Builder
+	require.NoError(t, pgn.Write(&sb, e.Record()))
+	assert.Contains(t, sb.String(), "3. d4 (3. Bc4 Bg4) 3... Bg4 {pinning} 4.\ndxe5 1-0")
+	require.True(t, e.PromoteVariation())
+	assert.Equal(t, pgn.ResultOngoing, e.Result())
+	sb.Reset()
+	require.NoError(t, pgn.Write(&sb, e.Record()))
+	assert.Contains(t, sb.String(), "1. e4 e5 2. Nf3 d6 (2... Nc6 3. Bb5) 3. Bc4 (3. d4 Bg4 {pinning} 4. dxe5) 3...\nBg4 *")
+}
+
+func TestEngine_Annotations(t *testing.T) {
+	games, err := pgn.ReadAll(strings.NewReader(`{[%csl Re4]} 1. e4 {[%cal Gg1f3]} e5 *
+`))
+	require.NoError(t, err)
+	e := NewEngine(OptPlayers(KindHuman, KindHuman))
+	defer e.Close()
+	require.NoError(t, e.LoadGame(games[0]))
+	assert.Equal(t, pgn.Annotations{Circles: []string{"Re4"}}, e.Annotations())
+
+	e.GotoPly(1)
+	e.ToggleArrow(squareIndex("f1"), squareIndex("c4"), 'B')
+	e.ToggleArrow(squareIndex("g1"), squareIndex("f3"), 'G')
+	e.ToggleCircle(squareIndex("e5"), 'R')
+	e.ToggleCircle(squareIndex("e5"), 'Y')
+	e.ToggleArrow(squareIndex("e4"), squareIndex("e4"), 'G')
+	assert.Equal(t, pgn.Annotations{Arrows: []string{"Bf1c4"}, Circles: []string{"Ye5"}}, e.Annotations())
+
+	assert.Equal(t, []string{"Gg1f3"}, games[0].Moves[0].Arrows, "the loaded game is left as it was")
+
+	e.GotoPly(2)
+	assert.Empty(t, e.Annotations())
+	var sb strings.Builder
+	record := e.Record()
+	require.NoError(t, pgn.Write(&sb, record))
+	assert.Contains(t, sb.String(), "{[%csl Re4]} 1. e4 {[%csl Ye5] [%cal Bf1c4]} 1... e5 *")
+
+	e.GotoPly(0)
+	e.ToggleCircle(squareIndex("e4"), 'G')
+	e.GotoPly(1)
+	e.ToggleArrow(squareIndex("f1"), squareIndex("c4"), 'R')
+	e.ClearAnnotations()
+	assert.Empty(t, e.Annotations())
+	assert.Equal(t, []string{"Re4"}, record.Annotations.Circles, "a record is left as it was")
+	assert.Equal(t, []string{"Bf1c4"}, record.Moves[0].Arrows)
+}
+
+func TestEngine_Line(t *testing.T) {
+	games, err := pgn.ReadAll(strings.NewReader(`[FEN "4k3/8/8/8/8/8/4P3/4K3 b - - 0 12"]
+
+12... Kd7 13. e4 (13. Kd2 Ke6) 13... Ke6 *
+`))
+	require.NoError(t, err)
+	e := NewEngine(OptPlayers(KindHuman, KindHuman))
+	defer e.Close()
+	require.NoError(t, e.LoadGame(games[0]))
+
+	line := func() []string {
+		var moves []string
+		for _, move := range e.Line() {
+			moves = append(moves, fmt.Sprintf("%d %s %s", move.Number, playerName(move.Player), move.Node.SAN))
+		}
+		return moves
+	}
+	assert.Equal(t, []string{"12 Black Kd7", "13 White e4", "13 Black Ke6"}, line(), "the mainline from the start")
+
+	variation := e.Tree().Current().Children()[0].Children()[1]
+	e.GotoNode(variation)
+	assert.Equal(t, []string{"12 Black Kd7", "13 White Kd2", "13 Black Ke6"}, line(), "the line through a variation")
+}
+
+func TestEngine_LoadGameErrors(t *testing.T) {
+	tests := map[string]struct {
+		pgn     string
+		message string
+	}{
+		"illegal mainline move": {
+			pgn:     "1. e4 e5 2. Ke3 *",
+			message: "line 1, column 13: illegal move Ke3",
+		},
+		"illegal variation move": {
+			pgn:     "1. e4 e5 (1... e4) *",
+			message: "line 1, column 16: illegal move e4",
+		},
+		"illegal from a custom start": {
+			pgn:     "[FEN \"4k3/8/8/8/8/8/4P3/4K3 b - - 0 1\"]\n\n1... e5 *",
+			message: "line 3, column 6: illegal move e5",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			games, err := pgn.ReadAll(strings.NewReader(test.pgn))
+			require.NoError(tt, err)
+			e := NewEngine(OptPlayers(KindHuman, KindHuman))
+			require.NoError(tt, e.SetFEN(""))
+			err = e.LoadGame(games[0])
+			var pgnErr *pgn.Error
+			require.ErrorAs(tt, err, &pgnErr)
+			assert.Equal(tt, test.message, err.Error())
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package uci
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	DefaultMaxRestarts = 3
+)
+
+// Supervisor wraps an Engine, watching for the process dying or
+// no longer answering. When that happens the engine is restarted,
+// the last options and position are replayed, and the command
+// is tried again before the error is handed back
+type Supervisor struct {
+	path         string
+	args         []string
+	engine       *Engine
+	options      *Options
+	fen          string
+	moves        string
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	maxRestarts  int
+	restarts     int
+	lastError    error
+	transcript   *Transcript
+}
+
+// NewSupervisor returns a Supervisor for the engine executable.
+// The engine is not launched until Start is called
+func NewSupervisor(path string, arg ...string) *Supervisor {
+	return &Supervisor{
+		path:         path,
+		args:         arg,
+		readTimeout:  DefaultReadTimeout,
+		writeTimeout: DefaultWriteTimeout,
+		maxRestarts:  DefaultMaxRestarts,
+	}
+}
+
+// Start launches the engine executable and completes the UCI handshake
+func (s *Supervisor) Start() error {
+	return s.start()
+}
+
+// SetTimeouts changes the read and write deadlines of the current
+// engine and of any engine started to replace it
+func (s *Supervisor) SetTimeouts(read, write time.Duration) {
+	s.readTimeout = read
+	s.writeTimeout = write
+	if s.engine != nil {
+		s.engine.SetTimeouts(read, write)
+	}
+}
+
+// SetTranscript records the conversation with the current engine
+// and any engine started to replace it
+func (s *Supervisor) SetTranscript(transcript *Transcript) {
+	s.transcript = transcript
+	if s.engine != nil {
+		s.engine.SetTranscript(transcript)
+	}
+}
+
+// SetMaxRestarts limits the number of consecutive restarts
+// attempted before giving up on the engine
+func (s *Supervisor) SetMaxRestarts(maxRestarts int) {
+	s.maxRestarts = maxRestarts
+}
+
+// Restarts returns the number of times the engine has been restarted
+func (s *Supervisor) Restarts() int {
+	return s.restarts
+}
+
+// LastError returns the error that caused the most recent restart
+func (s *Supervisor) LastError() error {
+	return s.lastError
+}
+
+// Name returns the engine name reported during the UCI handshake
+func (s *Supervisor) Name() string {
+	return s.engine.Name()
+}
+
+// Stderr returns the most recent stderr output of the current engine
+func (s *Supervisor) Stderr() string {
+	return s.engine.Stderr()
+}
+
+// SetOptions sends the options to the engine and remembers
+// them so they can be replayed after a restart
+func (s *Supervisor) SetOptions(opt Options) error {
+	s.options = &opt
+	return s.do(func(eng *Engine) error {
+		return eng.SetOptions(opt)
+	})
+}
+
+// SetPosition sends the position to the engine and remembers
+// it so it can be replayed after a restart
+func (s *Supervisor) SetPosition(fen string, moves string) error {
+	s.fen = fen
+	s.moves = moves
+	return s.do(func(eng *Engine) error {
+		return eng.SetPosition(fen, moves)
+	})
+}
+
+func (s *Supervisor) IsReady() error {
+	return s.do(func(eng *Engine) error {
+		return eng.IsReady()
+	})
+}
+
+// Go runs a search on the current position, see Engine.Go
+func (s *Supervisor) Go(depth int, searchmoves string, movetime int64, resultOpts ...uint) (*Results, error) {
+	var results *Results
+	err := s.do(func(eng *Engine) error {
+		var err error
+		results, err = eng.Go(depth, searchmoves, movetime, resultOpts...)
+		return err
+	})
+	return results, err
+}
+
+// GoClock runs a search timed by the clocks, see Engine.GoClock
+func (s *Supervisor) GoClock(clock Clock, resultOpts ...uint) (*Results, error) {
+	var results *Results
+	err := s.do(func(eng *Engine) error {
+		var err error
+		results, err = eng.GoClock(clock, resultOpts...)
+		return err
+	})
+	return results, err
+}
+
+// Analyse searches the current position until stopped, see
+// Engine.Analyse
+func (s *Supervisor) Analyse(lines int, stop <-chan struct{}, update func(lines []ScoreResult)) error {
+	return s.do(func(eng *Engine) error {
+		return eng.Analyse(lines, stop, update)
+	})
+}
+
+func (s *Supervisor) Close() {
+	s.engine.Close()
+}
+
+// do runs the command against the engine. If the engine has died or
+// stopped responding it is restarted and the command is retried,
+// up to the restart limit
+func (s *Supervisor) do(command func(eng *Engine) error) error {
+	err := command(s.engine)
+	for attempt := 1; errors.Is(err, ErrExited) || errors.Is(err, ErrTimeout); attempt++ {
+		s.lastError = err
+		if attempt > s.maxRestarts {
+			return fmt.Errorf("engine restart limit reached: %w", err)
+		}
+		log.Printf("Engine failed, restarting (%d/%d): %v\n", attempt, s.maxRestarts, err)
+		s.transcript.Note("engine failed, restarting (%d/%d): %v", attempt, s.maxRestarts, err)
+		s.engine.Close()
+		err = s.start()
+		if err != nil {
+			continue
+		}
+		s.restarts++
+		err = s.replay()
+		if err == nil {
+			err = command(s.engine)
+		}
+	}
+	return err
+}
+
+func (s *Supervisor) start() error {
+	eng, err := NewEngine(s.path, s.args...)
+	if err != nil {
+		return err
+	}
+	eng.SetTimeouts(s.readTimeout, s.writeTimeout)
+	eng.SetTranscript(s.transcript)
+	s.engine = eng
+	return eng.UCI()
+}
+
+func (s *Supervisor) replay() error {
+	if s.options != nil {
+		err := s.engine.SetOptions(*s.options)
+		if err != nil {
+			return err
+		}
+	}
+	if s.fen != "" || s.moves != "" {
+		err := s.engine.SetPosition(s.fen, s.moves)
+		if err != nil {
+			return err
+		}
+	}
+	return s.engine.IsReady()
+}
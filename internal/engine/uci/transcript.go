@@ -0,0 +1,171 @@
+package uci
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Directions of transcript lines
+const (
+	DirectionSent     = ">"
+	DirectionReceived = "<"
+	DirectionNote     = "#"
+)
+
+// Transcript records every line exchanged with an engine, one per line
+// as "<timestamp> <direction> <text>", where direction is '>' for lines
+// sent to the engine, '<' for lines received and '#' for notes. Lines
+// exchanged with another engine sharing the writer are tagged with its
+// role, as "<timestamp> [<role>] <direction> <text>"
+type Transcript struct {
+	mutex  *sync.Mutex
+	writer io.Writer
+	now    func() time.Time
+	role   string
+}
+
+// TranscriptLine is a single parsed line of a transcript
+type TranscriptLine struct {
+	Time      time.Time
+	Role      string // the engine the line was exchanged with, empty for the main one
+	Direction string
+	Text      string
+}
+
+// Search is a single search found when replaying a transcript
+type Search struct {
+	Command string
+	Results *Results
+}
+
+func NewTranscript(writer io.Writer) *Transcript {
+	return &Transcript{
+		mutex:  &sync.Mutex{},
+		writer: writer,
+		now:    time.Now,
+	}
+}
+
+// Tagged returns a transcript for another engine, writing to the same
+// writer with its lines tagged with the engine's role
+func (t *Transcript) Tagged(role string) *Transcript {
+	if t == nil {
+		return nil
+	}
+	tagged := *t
+	tagged.role = role
+	return &tagged
+}
+
+func (t *Transcript) Sent(line string) {
+	t.write(DirectionSent, line)
+}
+
+func (t *Transcript) Received(line string) {
+	t.write(DirectionReceived, line)
+}
+
+func (t *Transcript) Note(format string, args ...interface{}) {
+	t.write(DirectionNote, fmt.Sprintf(format, args...))
+}
+
+func (t *Transcript) write(direction, line string) {
+	if t == nil {
+		return
+	}
+	if t.role != "" {
+		direction = "[" + t.role + "] " + direction
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	_, _ = fmt.Fprintf(t.writer, "%s %s %s\n", t.now().UTC().Format(time.RFC3339Nano), direction, line)
+}
+
+// ReadTranscript parses a transcript written by a Transcript
+func ReadTranscript(reader io.Reader) ([]TranscriptLine, error) {
+	var lines []TranscriptLine
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		line, err := ParseTranscriptLine(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// ParseTranscriptLine parses a single transcript line
+func ParseTranscriptLine(text string) (TranscriptLine, error) {
+	line := TranscriptLine{}
+	stamp, rest, _ := strings.Cut(text, " ")
+	var err error
+	line.Time, err = time.Parse(time.RFC3339Nano, stamp)
+	if err != nil {
+		return line, fmt.Errorf("invalid timestamp: %w", err)
+	}
+	if tagged, ok := strings.CutPrefix(rest, "["); ok {
+		var found bool
+		line.Role, rest, found = strings.Cut(tagged, "] ")
+		if !found {
+			return line, fmt.Errorf("invalid role %q", tagged)
+		}
+	}
+	line.Direction, line.Text, _ = strings.Cut(rest, " ")
+	switch line.Direction {
+	case DirectionSent, DirectionReceived, DirectionNote:
+	default:
+		return line, fmt.Errorf("invalid direction %q", line.Direction)
+	}
+	return line, nil
+}
+
+// Replay feeds the lines received in a transcript back through the
+// result parser, returning every search that was run along with the
+// results the engine reported for it. Lines tagged with the role of
+// another engine are skipped
+func Replay(reader io.Reader, resultOpts ...uint) ([]Search, error) {
+	lines, err := ReadTranscript(reader)
+	if err != nil {
+		return nil, err
+	}
+	var searches []Search
+	var search *Search
+	depth := 0
+	for _, line := range lines {
+		switch {
+		case line.Role != "":
+		case line.Direction == DirectionSent && strings.HasPrefix(line.Text, "go"):
+			search = &Search{Command: line.Text, Results: &Results{}}
+			_, _ = fmt.Sscanf(strings.TrimPrefix(line.Text, "go "), "depth %d", &depth)
+		case line.Direction != DirectionReceived || search == nil:
+		case strings.HasPrefix(line.Text, "bestmove"):
+			err = search.Results.setBestMove(line.Text)
+			if err != nil {
+				return nil, err
+			}
+			search.Results.filter(depth, resultOpts...)
+			searches = append(searches, *search)
+			search = nil
+			depth = 0
+		default:
+			err = search.Results.addLineToResults(line.Text)
+			if err != nil {
+				log.Printf("Ignoring malformed engine output [%s]: %v\n", line.Text, err)
+			}
+		}
+	}
+	if search != nil {
+		return searches, fmt.Errorf("transcript ends during search: %s", search.Command)
+	}
+	return searches, nil
+}
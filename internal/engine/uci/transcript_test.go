@@ -0,0 +1,127 @@
+package uci
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+	"us.figge.chess/internal/engine/uci/ucitest"
+)
+
+func TestTranscript_Record(t *testing.T) {
+	fake := ucitest.New(t, `
+> go*
+< info depth 1 score cp 10 pv e7e5
+< bestmove e7e5
+`)
+	buffer := &bytes.Buffer{}
+	eng, err := NewEngine(fake.Path())
+	require.NoError(t, err)
+	transcript := NewTranscript(buffer)
+	eng.SetTranscript(transcript)
+	require.NoError(t, eng.UCI())
+	require.NoError(t, eng.SetPosition("", "e2e4"))
+	_, err = eng.Go(1, "", 0)
+	require.NoError(t, err)
+	eng.SetTranscript(nil)
+	eng.Close()
+	transcript.Tagged("probe").Sent("isready")
+
+	lines, err := ReadTranscript(buffer)
+	require.NoError(t, err)
+	var texts []string
+	for _, line := range lines {
+		assert.WithinDuration(t, time.Now(), line.Time, time.Minute)
+		texts = append(texts, line.Direction+" "+line.Text)
+	}
+	assert.Equal(t, []string{
+		"> uci",
+		"< id name ucitest",
+		"< uciok",
+		"> position startpos moves e2e4",
+		"> go depth 1",
+		"< info depth 1 score cp 10 pv e7e5",
+		"< bestmove e7e5",
+		"> isready",
+	}, texts)
+	assert.Equal(t, "probe", lines[len(lines)-1].Role)
+	assert.Empty(t, lines[0].Role)
+}
+
+func TestTranscript_Replay(t *testing.T) {
+	transcript := `
+2026-10-19T16:00:00.000001Z > uci
+2026-10-19T16:00:00.000002Z < id name Stockfish 17
+2026-10-19T16:00:00.000003Z < uciok
+2026-10-19T16:00:00.000004Z > position startpos moves e2e4
+2026-10-19T16:00:00.000005Z > go depth 2 movetime 1000
+2026-10-19T16:00:00.000006Z < info depth 1 multipv 1 score cp 30 pv e7e5
+2026-10-19T16:00:00.000006Z [probe] > go movetime 500
+2026-10-19T16:00:00.000006Z [probe] < info depth 9 score cp 40 pv d7d5
+2026-10-19T16:00:00.000006Z [probe] < bestmove d7d5
+2026-10-19T16:00:00.000007Z < info depth 2 multipv 1 score cp 25 pv e7e5 g1f3
+2026-10-19T16:00:00.000008Z < bestmove e7e5 ponder g1f3
+2026-10-19T16:00:00.000009Z # engine failed, restarting (1/3): engine process exited
+2026-10-19T16:00:00.000010Z > go depth 1
+2026-10-19T16:00:00.000011Z < info depth 1 score mate -3 pv g8f6
+2026-10-19T16:00:00.000012Z < bestmove g8f6
+`
+	searches, err := Replay(strings.NewReader(transcript), HighestDepthOnly)
+	require.NoError(t, err)
+	require.Len(t, searches, 2)
+
+	assert.Equal(t, "go depth 2 movetime 1000", searches[0].Command)
+	assert.Equal(t, "e7e5", searches[0].Results.BestMove)
+	assert.Equal(t, []ScoreResult{
+		{Depth: 2, MultiPV: 1, Score: 25, BestMoves: []string{"e7e5", "g1f3"}},
+	}, searches[0].Results.Results)
+
+	assert.Equal(t, "g8f6", searches[1].Results.BestMove)
+	assert.Equal(t, []ScoreResult{
+		{Depth: 1, Score: -3, Mate: true, BestMoves: []string{"g8f6"}},
+	}, searches[1].Results.Results)
+
+	// A transcript also serves as a script for the fake engine
+	fake := ucitest.New(t, transcript)
+	eng, err := NewEngine(fake.Path())
+	require.NoError(t, err)
+	defer eng.Close()
+	require.NoError(t, eng.UCI())
+	assert.Equal(t, "Stockfish 17", eng.Name())
+	require.NoError(t, eng.SetPosition("", "e2e4"))
+	results, err := eng.Go(2, "", 1000, HighestDepthOnly)
+	require.NoError(t, err)
+	assert.Equal(t, searches[0].Results.Results, results.Results)
+}
+
+func TestTranscript_Invalid(t *testing.T) {
+	tests := map[string]struct {
+		transcript string
+		err        string
+	}{
+		"bad timestamp": {
+			transcript: "yesterday > uci\n",
+			err:        "line 1: invalid timestamp",
+		},
+		"bad direction": {
+			transcript: "2026-10-19T16:00:00Z ? uci\n",
+			err:        `line 1: invalid direction "?"`,
+		},
+		"bad role": {
+			transcript: "2026-10-19T16:00:00Z [probe > uci\n",
+			err:        `line 1: invalid role "probe > uci"`,
+		},
+		"unfinished search": {
+			transcript: "2026-10-19T16:00:00Z > go depth 5\n2026-10-19T16:00:01Z < info depth 1 score cp 3 pv a2a3\n",
+			err:        "transcript ends during search: go depth 5",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			_, err := Replay(strings.NewReader(test.transcript))
+			assert.ErrorContains(tt, err, test.err)
+		})
+	}
+}
@@ -1,15 +1,15 @@
 package uci
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
 	"log"
-	"os/exec"
 	"sort"
 	"strconv"
 	"strings"
 	"text/scanner"
+	"time"
+	"us.figge.chess/internal/engine/process"
 )
 
 // constants for result filtering
@@ -19,6 +19,17 @@ const (
 	IncludeLowerbounds uint = 1 << iota // include lowerbound results
 )
 
+// default deadlines for communicating with the engine process
+const (
+	DefaultReadTimeout  = process.DefaultReadTimeout
+	DefaultWriteTimeout = process.DefaultWriteTimeout
+)
+
+var (
+	ErrTimeout = process.ErrTimeout
+	ErrExited  = process.ErrExited
+)
+
 // Options, for initializing the chess engine
 type Options struct {
 	MultiPV int  // number of principal variations (ranks top X moves)
@@ -71,39 +82,67 @@ func (r Results) String() string {
 // a chess engine executable. Engines should be created with
 // a call to NewEngine(/path/to/executable)
 type Engine struct {
-	cmd    *exec.Cmd
-	stdout *bufio.Reader
-	stdin  *bufio.Writer
+	process *process.Process
+	name    string
+	multiPV int
 }
 
 // NewEngine returns an Engine it has spun up
 // and connected communication to
 func NewEngine(path string, arg ...string) (*Engine, error) {
-	eng := Engine{}
-	eng.cmd = exec.Command(path, arg...)
-	stdin, err := eng.cmd.StdinPipe()
-	if err != nil {
-		return nil, err
-	}
-	stdout, err := eng.cmd.StdoutPipe()
+	p, err := process.Start(path, arg...)
 	if err != nil {
 		return nil, err
 	}
-	if err := eng.cmd.Start(); err != nil {
-		return nil, err
+	return &Engine{process: p}, nil
+}
+
+// SetTimeouts changes how long the engine may take to answer a
+// line (on top of any requested search time) and to accept a command
+func (eng *Engine) SetTimeouts(read, write time.Duration) {
+	eng.process.SetTimeouts(read, write)
+}
+
+// SetTranscript starts recording every line exchanged with the
+// engine to the transcript, or stops recording if it is nil
+func (eng *Engine) SetTranscript(transcript *Transcript) {
+	if transcript == nil {
+		eng.process.SetRecorder(nil)
+		return
 	}
-	eng.stdin = bufio.NewWriter(stdin)
-	eng.stdout = bufio.NewReader(stdout)
-	return &eng, nil
+	eng.process.SetRecorder(transcript)
 }
 
-// UCI sets the engine to uci mode
+// Name returns the engine name reported during the UCI handshake
+func (eng *Engine) Name() string {
+	return eng.name
+}
+
+// Stderr returns the most recent output the engine wrote to stderr
+func (eng *Engine) Stderr() string {
+	return eng.process.Stderr()
+}
+
+// Exited reports whether the engine process has terminated
+func (eng *Engine) Exited() bool {
+	return eng.process.Exited()
+}
+
+func (eng *Engine) send(command string) error {
+	return eng.process.Send(command)
+}
+
+// UCI sets the engine to uci mode and waits for it to acknowledge
 func (eng *Engine) UCI() error {
-	_, err := eng.stdin.WriteString("uci\n")
+	err := eng.send("uci")
 	if err != nil {
 		return err
 	}
-	err = eng.stdin.Flush()
+	_, err = eng.process.ReadUntil("uciok", func(line string) {
+		if name, ok := strings.CutPrefix(line, "id name "); ok {
+			eng.name = strings.TrimSpace(name)
+		}
+	})
 	return err
 }
 
@@ -116,6 +155,7 @@ func (eng *Engine) SetOptions(opt Options) error {
 		if err != nil {
 			return err
 		}
+		eng.multiPV = opt.MultiPV
 	}
 	if opt.Hash > 0 {
 		err = eng.SendOption("Hash", opt.Hash)
@@ -153,61 +193,43 @@ func (eng *Engine) SetOptions(opt Options) error {
 
 // SendOption sends setoption command to the Engine
 func (eng *Engine) SendOption(name string, value interface{}) error {
-	_, err := eng.stdin.WriteString(fmt.Sprintf("setoption name %s value %v\n", name, value))
-	if err != nil {
-		return err
-	}
-	err = eng.stdin.Flush()
-	return err
+	return eng.send(fmt.Sprintf("setoption name %s value %v", name, value))
 }
 
 // SetFEN takes a FEN string and tells the engine to set the position
 func (eng *Engine) SetFEN(fen string) error {
-	_, err := eng.stdin.WriteString(fmt.Sprintf("position fen %s\n", fen))
-	if err != nil {
-		return err
-	}
-	err = eng.stdin.Flush()
-	return err
+	return eng.send(fmt.Sprintf("position fen %s", fen))
 }
 
 func (eng *Engine) SetMoves(moves string) error {
-	_, err := eng.stdin.WriteString(fmt.Sprintf("position startpos moves %s\n", moves))
-	if err != nil {
-		return err
-	}
-	err = eng.stdin.Flush()
-	return err
+	return eng.send(fmt.Sprintf("position startpos moves %s", moves))
 }
 
-func (eng *Engine) IsReady() error {
-	_, err := eng.stdin.WriteString("isready\n")
-	if err != nil {
-		return err
+// SetPosition tells the engine to set up the FEN position, or the
+// start position if the FEN is empty, and then play the moves
+func (eng *Engine) SetPosition(fen string, moves string) error {
+	position := "position startpos"
+	if fen != "" {
+		position = "position fen " + fen
 	}
-	err = eng.stdin.Flush()
-	if err != nil {
-		return err
+	if moves = strings.TrimSpace(moves); moves != "" {
+		position += " moves " + moves
 	}
-	var line string
-	line, err = eng.stdout.ReadString('\n')
+	return eng.send(position)
+}
+
+func (eng *Engine) IsReady() error {
+	err := eng.send("isready")
 	if err != nil {
 		return err
 	}
-	if strings.Trim(line, "\n") != "readyok" {
-		return fmt.Errorf("engine not ready: %s", line)
-	}
+	_, err = eng.process.ReadUntil("readyok", nil)
 	return err
 }
 
 // Go can use search moves, depth and time to move as filter  for the results being returned.
 // see http://wbec-ridderkerk.nl/html/UCIProtocol.html
 func (eng *Engine) Go(depth int, searchmoves string, movetime int64, resultOpts ...uint) (*Results, error) {
-	res := Results{}
-	resultOpt := uint(0)
-	if len(resultOpts) == 1 {
-		resultOpt = resultOpts[0]
-	}
 	goCmd := "go "
 
 	if depth != 0 {
@@ -219,25 +241,51 @@ func (eng *Engine) Go(depth int, searchmoves string, movetime int64, resultOpts
 	if movetime != 0 {
 		goCmd += fmt.Sprintf(" movetime %d", movetime)
 	}
-	goCmd += "\n"
-	_, err := eng.stdin.WriteString(goCmd)
+	return eng.search(goCmd, depth, time.Duration(movetime)*time.Millisecond, resultOpts...)
+}
 
-	if err != nil {
-		return nil, err
+// Clock is the time left on each side's clock and their increments,
+// handed to the engine to manage its own time
+type Clock struct {
+	WhiteTime      time.Duration
+	BlackTime      time.Duration
+	WhiteIncrement time.Duration
+	BlackIncrement time.Duration
+	MovesToGo      int // moves to the next time control, zero for none
+
+	// the stage of the time control the player to move is in, for
+	// engines told the time control rather than the moves to go
+	StageMoves int           // moves in the stage, zero for the rest of the game
+	StageTime  time.Duration // time the stage adds to the clock
+}
+
+// GoClock asks the engine for a move, letting it decide how long to
+// think from the time left on the clocks
+func (eng *Engine) GoClock(clock Clock, resultOpts ...uint) (*Results, error) {
+	goCmd := fmt.Sprintf("go wtime %d btime %d winc %d binc %d",
+		clock.WhiteTime.Milliseconds(), clock.BlackTime.Milliseconds(),
+		clock.WhiteIncrement.Milliseconds(), clock.BlackIncrement.Milliseconds())
+	if clock.MovesToGo > 0 {
+		goCmd += fmt.Sprintf(" movestogo %d", clock.MovesToGo)
 	}
-	err = eng.stdin.Flush()
+	return eng.search(goCmd, 0, max(clock.WhiteTime, clock.BlackTime), resultOpts...)
+}
+
+// search sends the go command and collects the engine's results until
+// it reports its best move, waiting up to the search time for each line
+func (eng *Engine) search(goCmd string, depth int, searchTime time.Duration, resultOpts ...uint) (*Results, error) {
+	res := Results{}
+	err := eng.send(goCmd)
 	if err != nil {
 		return nil, err
 	}
 	for {
-		line, err := eng.stdout.ReadString('\n')
+		line, err := eng.process.ReadLine(searchTime)
 		if err != nil {
 			return nil, err
 		}
-		line = strings.Trim(line, "\n")
 		if strings.HasPrefix(line, "bestmove") {
-			dummy := ""
-			_, err := fmt.Sscanf(line, "%s %s", &dummy, &res.BestMove)
+			err = res.setBestMove(line)
 			if err != nil {
 				return nil, err
 			}
@@ -246,8 +294,91 @@ func (eng *Engine) Go(depth int, searchmoves string, movetime int64, resultOpts
 
 		err = res.addLineToResults(line)
 		if err != nil {
-			return nil, err
+			log.Printf("Ignoring malformed engine output [%s]: %v\n", line, err)
+		}
+	}
+	res.filter(depth, resultOpts...)
+	return &res, nil
+}
+
+// Analyse searches the position until stop is closed, passing update
+// the latest lines as the engine reports them. The engine searches the
+// number of lines given, going back to the MultiPV set by SetOptions
+// once it has stopped
+func (eng *Engine) Analyse(lines int, stop <-chan struct{}, update func(lines []ScoreResult)) error {
+	if multiPV := max(1, eng.multiPV); max(1, lines) != multiPV {
+		err := eng.SendOption("MultiPV", max(1, lines))
+		if err != nil {
+			return err
 		}
+		defer func() { _ = eng.SendOption("MultiPV", multiPV) }()
+	}
+	err := eng.send("go infinite")
+	if err != nil {
+		return err
+	}
+	res := Results{}
+	for {
+		line, ok, err := eng.process.ReadLineUntil(stop)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		if strings.HasPrefix(line, "bestmove") {
+			// the engine has nothing to search, as in a mated position,
+			// and only has to be waited on
+			<-stop
+			return nil
+		}
+		err = res.addLineToResults(line)
+		if err != nil {
+			log.Printf("Ignoring malformed engine output [%s]: %v\n", line, err)
+		} else if strings.Contains(line, " pv ") {
+			update(res.Lines())
+		}
+	}
+	err = eng.send("stop")
+	if err != nil {
+		return err
+	}
+	_, err = eng.process.ReadUntil("bestmove", nil)
+	return err
+}
+
+// Lines returns the deepest result of each principal variation, leaving
+// out bounds, ordered by MultiPV
+func (res *Results) Lines() []ScoreResult {
+	deepest := map[int]ScoreResult{}
+	for _, r := range res.results {
+		if r.Upperbound || r.Lowerbound || len(r.BestMoves) == 0 {
+			continue
+		}
+		if d, ok := deepest[r.MultiPV]; !ok || r.Depth > d.Depth {
+			deepest[r.MultiPV] = r
+		}
+	}
+	lines := make([]ScoreResult, 0, len(deepest))
+	for _, r := range deepest {
+		lines = append(lines, r)
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i].MultiPV < lines[j].MultiPV })
+	return lines
+}
+
+func (res *Results) setBestMove(line string) error {
+	dummy := ""
+	_, err := fmt.Sscanf(line, "%s %s", &dummy, &res.BestMove)
+	return err
+}
+
+// filter moves the collected results that pass the result options
+// into Results, sorted by depth
+func (res *Results) filter(depth int, resultOpts ...uint) {
+	resultOpt := uint(0)
+	if len(resultOpts) == 1 {
+		resultOpt = resultOpts[0]
 	}
 	for _, v := range res.results {
 		if resultOpt&HighestDepthOnly != 0 && v.Depth != depth {
@@ -262,7 +393,6 @@ func (eng *Engine) Go(depth int, searchmoves string, movetime int64, resultOpts
 		res.Results = append(res.Results, v)
 	}
 	sort.Sort(byDepth(res.Results))
-	return &res, nil
 }
 
 // GoDepth takes a depth and an optional uint flag that configures filters
@@ -390,15 +520,8 @@ func (res *Results) addLineToResults(line string) error {
 	return nil
 }
 
+// Close asks the engine to quit, killing the process
+// if it has not exited shortly afterwards
 func (eng *Engine) Close() {
-	_, err := eng.stdin.WriteString("stop\n")
-	if err != nil {
-		log.Println("failed to stop engine:", err)
-	}
-	eng.stdin.Flush()
-	err = eng.cmd.Process.Kill()
-	if err != nil {
-		log.Println("failed to kill engine:", err)
-	}
-	eng.cmd.Wait()
+	eng.process.Close("stop", "quit")
 }
@@ -0,0 +1,326 @@
+package uci
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+	"time"
+	"us.figge.chess/internal/engine/uci/ucitest"
+)
+
+func TestMain(m *testing.M) {
+	ucitest.Main()
+	os.Exit(m.Run())
+}
+
+func TestEngine_UCI(t *testing.T) {
+	fake := ucitest.New(t, `
+> uci
+< id name Fakefish 1.0
+< id author Nobody
+< option name Hash type spin default 16 min 1 max 1024
+< uciok
+`)
+	eng, err := NewEngine(fake.Path())
+	require.NoError(t, err)
+	defer eng.Close()
+
+	require.NoError(t, eng.UCI())
+	require.NoError(t, eng.IsReady())
+	assert.Equal(t, "Fakefish 1.0", eng.Name())
+}
+
+func TestEngine_Go(t *testing.T) {
+	tests := map[string]struct {
+		script   string
+		bestMove string
+		results  []ScoreResult
+	}{
+		"single pv": {
+			script: `
+> go*
+< info depth 1 seldepth 1 multipv 1 score cp 20 nodes 20 nps 10000 time 2 pv e7e5
+< info depth 2 seldepth 2 multipv 1 score cp -15 nodes 80 nps 20000 time 4 pv e7e5 g1f3
+< bestmove e7e5 ponder g1f3
+`,
+			bestMove: "e7e5",
+			results: []ScoreResult{
+				{Time: 2, Depth: 1, SelDepth: 1, Nodes: 20, NodesPerSecond: 10000, MultiPV: 1, Score: 20, BestMoves: []string{"e7e5"}},
+				{Time: 4, Depth: 2, SelDepth: 2, Nodes: 80, NodesPerSecond: 20000, MultiPV: 1, Score: -15, BestMoves: []string{"e7e5", "g1f3"}},
+			},
+		},
+		"mate score": {
+			script: `
+> go*
+< info depth 5 score mate 2 pv d8h4
+< bestmove d8h4
+`,
+			bestMove: "d8h4",
+			results: []ScoreResult{
+				{Depth: 5, Score: 2, Mate: true, BestMoves: []string{"d8h4"}},
+			},
+		},
+		"garbage lines": {
+			script: `
+> go*
+< Stockfish says hello
+< info depth x score cp 10 pv a7a6
+< info string NNUE evaluation enabled
+< info depth 3 score cp 5 pv b8c6
+< bestmove b8c6
+`,
+			bestMove: "b8c6",
+			results: []ScoreResult{
+				{Depth: 3, Score: 5, BestMoves: []string{"b8c6"}},
+			},
+		},
+		"bounds filtered": {
+			script: `
+> go*
+< info depth 4 score cp 30 lowerbound pv g8f6
+< info depth 4 score cp 25 pv g8f6
+< bestmove g8f6
+`,
+			bestMove: "g8f6",
+			results: []ScoreResult{
+				{Depth: 4, Score: 25, BestMoves: []string{"g8f6"}},
+			},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			fake := ucitest.New(tt, test.script)
+			eng, err := NewEngine(fake.Path())
+			require.NoError(tt, err)
+			defer eng.Close()
+			require.NoError(tt, eng.UCI())
+
+			results, err := eng.Go(10, "", 100)
+			require.NoError(tt, err)
+			assert.Equal(tt, test.bestMove, results.BestMove)
+			assert.Equal(tt, test.results, results.Results)
+		})
+	}
+}
+
+func TestEngine_GoClock(t *testing.T) {
+	tests := map[string]struct {
+		clock   Clock
+		command string
+	}{
+		"increments": {
+			clock:   Clock{WhiteTime: 61500 * time.Millisecond, BlackTime: time.Minute, WhiteIncrement: 2 * time.Second, BlackIncrement: time.Second},
+			command: "go wtime 61500 btime 60000 winc 2000 binc 1000",
+		},
+		"moves to go": {
+			clock:   Clock{WhiteTime: 90 * time.Minute, BlackTime: 80 * time.Minute, MovesToGo: 12},
+			command: "go wtime 5400000 btime 4800000 winc 0 binc 0 movestogo 12",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			fake := ucitest.New(tt, `
+> go w*
+< info depth 1 score cp 10 pv e2e4
+< bestmove e2e4
+`)
+			eng, err := NewEngine(fake.Path())
+			require.NoError(tt, err)
+			require.NoError(tt, eng.UCI())
+
+			results, err := eng.GoClock(test.clock)
+			require.NoError(tt, err)
+			assert.Equal(tt, "e2e4", results.BestMove)
+			assert.Len(tt, results.Results, 1)
+			eng.Close()
+			assert.Contains(tt, fake.Commands(), test.command)
+		})
+	}
+}
+
+func TestEngine_Analyse(t *testing.T) {
+	fake := ucitest.New(t, `
+> go infinite
+< info depth 1 multipv 1 score cp 20 nodes 20 nps 10000 time 2 pv e7e5
+< info depth 1 multipv 2 score cp 10 nodes 40 nps 10000 time 4 pv c7c5
+< info depth 2 currmove e7e5 currmovenumber 1
+< info depth 2 multipv 1 score cp 40 lowerbound nodes 60 nps 10000 time 6 pv e7e5
+< info depth 2 multipv 1 score mate -3 nodes 80 nps 20000 time 4 pv e7e5 g1f3
+> stop
+< bestmove e7e5
+`)
+	eng, err := NewEngine(fake.Path())
+	require.NoError(t, err)
+	require.NoError(t, eng.UCI())
+
+	var updates [][]ScoreResult
+	stop := make(chan struct{})
+	err = eng.Analyse(2, stop, func(lines []ScoreResult) {
+		updates = append(updates, lines)
+		if len(updates) == 4 {
+			close(stop)
+		}
+	})
+	require.NoError(t, err)
+	assert.Equal(t, [][]ScoreResult{
+		{{Time: 2, Depth: 1, Nodes: 20, NodesPerSecond: 10000, MultiPV: 1, Score: 20, BestMoves: []string{"e7e5"}}},
+		{
+			{Time: 2, Depth: 1, Nodes: 20, NodesPerSecond: 10000, MultiPV: 1, Score: 20, BestMoves: []string{"e7e5"}},
+			{Time: 4, Depth: 1, Nodes: 40, NodesPerSecond: 10000, MultiPV: 2, Score: 10, BestMoves: []string{"c7c5"}},
+		},
+		// bounds are left out
+		{
+			{Time: 2, Depth: 1, Nodes: 20, NodesPerSecond: 10000, MultiPV: 1, Score: 20, BestMoves: []string{"e7e5"}},
+			{Time: 4, Depth: 1, Nodes: 40, NodesPerSecond: 10000, MultiPV: 2, Score: 10, BestMoves: []string{"c7c5"}},
+		},
+		{
+			{Time: 4, Depth: 2, Nodes: 80, NodesPerSecond: 20000, MultiPV: 1, Score: -3, Mate: true, BestMoves: []string{"e7e5", "g1f3"}},
+			{Time: 4, Depth: 1, Nodes: 40, NodesPerSecond: 10000, MultiPV: 2, Score: 10, BestMoves: []string{"c7c5"}},
+		},
+	}, updates)
+	eng.Close()
+	assert.Equal(t, []string{
+		"uci",
+		"setoption name MultiPV value 2",
+		"go infinite",
+		"stop",
+		"setoption name MultiPV value 1",
+		"stop",
+		"quit",
+	}, fake.Commands())
+}
+
+func TestEngine_Commands(t *testing.T) {
+	fake := ucitest.New(t, "")
+	eng, err := NewEngine(fake.Path())
+	require.NoError(t, err)
+
+	require.NoError(t, eng.UCI())
+	require.NoError(t, eng.SetOptions(Options{MultiPV: 2, Hash: 64, Elo: 1500}))
+	require.NoError(t, eng.SetPosition("", "e2e4 e7e5"))
+	require.NoError(t, eng.SetPosition("8/8/8/8/8/8/8/K6k w - - 0 1", ""))
+	require.NoError(t, eng.IsReady())
+	eng.Close()
+
+	assert.Equal(t, []string{
+		"uci",
+		"setoption name MultiPV value 2",
+		"setoption name Hash value 64",
+		"setoption name ownbook value false",
+		"setoption name ponder value false",
+		"setoption name UCI_LimitStrength value true",
+		"setoption name UCI_Elo value 1500",
+		"position startpos moves e2e4 e7e5",
+		"position fen 8/8/8/8/8/8/8/K6k w - - 0 1",
+		"isready",
+		"stop",
+		"quit",
+	}, fake.Commands())
+}
+
+func TestEngine_Failures(t *testing.T) {
+	tests := map[string]struct {
+		script string
+		err    error
+		stderr string
+	}{
+		"crash": {
+			script: `
+> go*
+! stderr segmentation fault
+! exit 139
+`,
+			err:    ErrExited,
+			stderr: "segmentation fault",
+		},
+		"hang": {
+			script: `
+> go*
+< info depth 1 score cp 10 pv e7e5
+! hang
+`,
+			err: ErrTimeout,
+		},
+		"slow": {
+			script: `
+> go*
+! sleep 500ms
+< bestmove e7e5
+`,
+			err: ErrTimeout,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			fake := ucitest.New(tt, test.script)
+			eng, err := NewEngine(fake.Path())
+			require.NoError(tt, err)
+			defer eng.Close()
+			eng.SetTimeouts(200*time.Millisecond, 200*time.Millisecond)
+			require.NoError(tt, eng.UCI())
+
+			_, err = eng.Go(0, "", 10)
+			assert.True(tt, errors.Is(err, test.err), "expected %v, got %v", test.err, err)
+			assert.Contains(tt, eng.Stderr(), test.stderr)
+		})
+	}
+}
+
+func TestSupervisor_Restart(t *testing.T) {
+	fake := ucitest.New(t, `
+> go*
+! exit 1
+---
+> go*
+< info depth 1 score cp 10 pv e7e5
+< bestmove e7e5
+`)
+	s := NewSupervisor(fake.Path())
+	require.NoError(t, s.Start())
+	defer s.Close()
+	s.SetTimeouts(time.Second, time.Second)
+
+	require.NoError(t, s.SetOptions(Options{Hash: 32}))
+	require.NoError(t, s.SetPosition("", "e2e4"))
+	results, err := s.Go(1, "", 10)
+	require.NoError(t, err)
+	assert.Equal(t, "e7e5", results.BestMove)
+	assert.Equal(t, 1, s.Restarts())
+	assert.Equal(t, 2, fake.Launches())
+	assert.True(t, errors.Is(s.LastError(), ErrExited))
+
+	// The restarted engine has the options and position replayed before the search is retried
+	assert.Equal(t, []string{
+		"uci",
+		"setoption name Hash value 32",
+		"setoption name ownbook value false",
+		"setoption name ponder value false",
+		"position startpos moves e2e4",
+		"go depth 1 movetime 10",
+		"uci",
+		"setoption name Hash value 32",
+		"setoption name ownbook value false",
+		"setoption name ponder value false",
+		"position startpos moves e2e4",
+		"isready",
+		"go depth 1 movetime 10",
+	}, fake.Commands())
+}
+
+func TestSupervisor_GivesUp(t *testing.T) {
+	fake := ucitest.New(t, `
+> go*
+! exit 1
+`)
+	s := NewSupervisor(fake.Path())
+	require.NoError(t, s.Start())
+	defer s.Close()
+	s.SetMaxRestarts(2)
+
+	_, err := s.Go(1, "", 10)
+	assert.True(t, errors.Is(err, ErrExited), "expected %v, got %v", ErrExited, err)
+	assert.Equal(t, 2, s.Restarts())
+	assert.Equal(t, 3, fake.Launches())
+}
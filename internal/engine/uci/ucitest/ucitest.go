@@ -0,0 +1,233 @@
+// Package ucitest provides a scriptable fake UCI engine for tests.
+//
+// The fake runs as a re-execution of the test binary itself, so tests
+// need no real engine installed. A test package opts in from TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		ucitest.Main()
+//		os.Exit(m.Run())
+//	}
+//
+// and then launches the fake with the path returned by Fake.Path.
+//
+// Scripts are line based. A "> command" line starts a block that is
+// played when the engine receives a matching command, where a trailing
+// '*' matches any suffix. The lines that follow the block header are
+// played in order:
+//
+//	< text        write text to stdout
+//	! sleep 50ms  pause before continuing
+//	! stderr text write text to stderr
+//	! exit 3      terminate the process with the exit code
+//	! hang        stop responding altogether
+//
+// Each command plays the first remaining block that matches it, and
+// any blocks skipped over are discarded. Commands that match no block
+// get a default answer: "uci" is acknowledged, "isready" is answered
+// with readyok, "quit" exits, and anything else is ignored.
+// A line containing only "---" separates the scripts used by
+// successive launches; the last script is reused for further launches.
+// Blank lines and lines starting with '#' are ignored.
+//
+// Transcripts recorded with uci.Transcript can be used as scripts
+// directly, as the leading timestamps, any notes and the lines tagged
+// with the role of another engine are ignored.
+package ucitest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	EnvScript    = "UCITEST_SCRIPT"
+	commandsFile = "commands.log"
+	launchesFile = "launches"
+)
+
+// TB is the part of testing.TB the fake needs, kept to an interface
+// so that binaries using the package don't link in the testing package
+type TB interface {
+	Helper()
+	TempDir() string
+	Setenv(key, value string)
+	Fatalf(format string, args ...any)
+}
+
+// Fake is a handle on a scripted engine set up for a single test
+type Fake struct {
+	dir string
+}
+
+// New writes the script to a temporary directory and points the
+// fake engine at it for the remainder of the test
+func New(t TB, script string) *Fake {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "script.txt")
+	err := os.WriteFile(path, []byte(script), 0o644)
+	if err != nil {
+		t.Fatalf("failed to write script: %v", err)
+	}
+	t.Setenv(EnvScript, path)
+	return &Fake{dir: dir}
+}
+
+// Path returns the executable to launch as the engine
+func (f *Fake) Path() string {
+	return os.Args[0]
+}
+
+// Commands returns every command received, across all launches
+func (f *Fake) Commands() []string {
+	data, err := os.ReadFile(filepath.Join(f.dir, commandsFile))
+	if err != nil {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// Launches returns the number of times the fake engine was started
+func (f *Fake) Launches() int {
+	data, _ := os.ReadFile(filepath.Join(f.dir, launchesFile))
+	return len(data)
+}
+
+// Main runs the fake engine and exits if the process was launched
+// as one, otherwise it returns immediately
+func Main() {
+	path := os.Getenv(EnvScript)
+	if path == "" {
+		return
+	}
+	os.Exit(run(path, os.Stdin, os.Stdout, os.Stderr))
+}
+
+type step struct {
+	kind string
+	text string
+}
+
+type block struct {
+	pattern string
+	steps   []step
+}
+
+func run(path string, stdin io.Reader, stdout, stderr io.Writer) int {
+	dir := filepath.Dir(path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 2
+	}
+	launch := recordLaunch(dir)
+	scripts := strings.Split(string(data), "\n---\n")
+	blocks, err := parseScript(scripts[min(launch, len(scripts)-1)])
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 2
+	}
+	log, err := os.OpenFile(filepath.Join(dir, commandsFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return 2
+	}
+	defer func() { _ = log.Close() }()
+
+	out := bufio.NewWriter(stdout)
+	scanner := bufio.NewScanner(stdin)
+	for scanner.Scan() {
+		command := strings.TrimSpace(scanner.Text())
+		_, _ = fmt.Fprintln(log, command)
+		var steps []step
+		if i := slices.IndexFunc(blocks, func(b block) bool { return matches(b.pattern, command) }); i >= 0 {
+			steps = blocks[i].steps
+			blocks = blocks[i+1:]
+		} else {
+			switch command {
+			case "uci":
+				steps = []step{{"<", "id name ucitest"}, {"<", "uciok"}}
+			case "isready":
+				steps = []step{{"<", "readyok"}}
+			case "quit":
+				steps = []step{{"exit", "0"}}
+			}
+		}
+		for _, s := range steps {
+			switch s.kind {
+			case "<":
+				_, _ = fmt.Fprintln(out, s.text)
+				_ = out.Flush()
+			case "stderr":
+				_, _ = fmt.Fprintln(stderr, s.text)
+			case "sleep":
+				d, _ := time.ParseDuration(s.text)
+				time.Sleep(d)
+			case "exit":
+				code, _ := strconv.Atoi(s.text)
+				return code
+			case "hang":
+				select {}
+			}
+		}
+	}
+	return 0
+}
+
+// parseScript parses a single launch script into its blocks
+func parseScript(script string) ([]block, error) {
+	var blocks []block
+	for n, line := range strings.Split(script, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if stamp, rest, ok := strings.Cut(line, " "); ok {
+			if _, err := time.Parse(time.RFC3339Nano, stamp); err == nil {
+				line = rest
+			}
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "[") {
+			continue
+		}
+		kind, text, _ := strings.Cut(line, " ")
+		if kind == ">" {
+			blocks = append(blocks, block{pattern: text})
+			continue
+		}
+		if len(blocks) == 0 {
+			return nil, fmt.Errorf("line %d: %q appears before the first command", n+1, line)
+		}
+		if kind == "!" {
+			kind, text, _ = strings.Cut(text, " ")
+			switch kind {
+			case "sleep", "stderr", "exit", "hang":
+			default:
+				return nil, fmt.Errorf("line %d: unknown directive %q", n+1, kind)
+			}
+		} else if kind != "<" {
+			return nil, fmt.Errorf("line %d: unrecognized line %q", n+1, line)
+		}
+		last := &blocks[len(blocks)-1]
+		last.steps = append(last.steps, step{kind: kind, text: text})
+	}
+	return blocks, nil
+}
+
+func matches(pattern, command string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(command, prefix)
+	}
+	return pattern == command
+}
+
+func recordLaunch(dir string) int {
+	path := filepath.Join(dir, launchesFile)
+	data, _ := os.ReadFile(path)
+	_ = os.WriteFile(path, append(data, '.'), 0o644)
+	return len(data)
+}
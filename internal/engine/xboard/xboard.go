@@ -0,0 +1,546 @@
+// Package xboard talks to chess engines that speak the Chess Engine
+// Communication Protocol (CECP) used by WinBoard and XBoard.
+// see https://www.gnu.org/software/xboard/engine-intf.html
+package xboard
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"us.figge.chess/internal/engine/process"
+	"us.figge.chess/internal/engine/uci"
+)
+
+const (
+	// mateScore is the score engines commonly report for mate, with
+	// the distance to mate in plies subtracted from it
+	mateScore = 100000
+	mateRange = 1000
+
+	// featureTimeout is how long an engine has to start announcing its
+	// features before it is taken to speak protocol version 1, as the
+	// protocol suggests
+	featureTimeout = 2 * time.Second
+)
+
+var (
+	ErrUnsupported = errors.New("not supported by engine")
+)
+
+// GameOverError is returned when the engine declares the game over,
+// either by claiming a result or by resigning
+type GameOverError struct {
+	Result string // 1-0, 0-1 or 1/2-1/2
+	Reason string
+}
+
+func (e *GameOverError) Error() string {
+	return fmt.Sprintf("game over %s {%s}", e.Result, e.Reason)
+}
+
+// Engine holds the information needed to communicate with a
+// CECP chess engine executable. Engines should be created
+// with a call to NewEngine(/path/to/executable). Unlike a UCI
+// engine there is no supervisor to restart one that dies
+type Engine struct {
+	process  *process.Process
+	name     string
+	features map[string]string
+	boardFEN string
+	fen      string
+	moves    []string
+	played   []string
+	synced   bool
+	limits   []string // level, sd and st commands in force since the last new
+
+	featureTimeout time.Duration
+}
+
+// NewEngine returns an Engine it has spun up
+// and connected communication to
+func NewEngine(path string, arg ...string) (*Engine, error) {
+	p, err := process.Start(path, arg...)
+	if err != nil {
+		return nil, err
+	}
+	return &Engine{
+		process:        p,
+		name:           filepath.Base(path),
+		features:       map[string]string{},
+		featureTimeout: featureTimeout,
+	}, nil
+}
+
+// SetTimeouts changes how long the engine may take to answer a
+// line (on top of any requested search time) and to accept a command
+func (eng *Engine) SetTimeouts(read, write time.Duration) {
+	eng.process.SetTimeouts(read, write)
+}
+
+// SetTranscript starts recording every line exchanged with the
+// engine to the transcript, or stops recording if it is nil
+func (eng *Engine) SetTranscript(transcript *uci.Transcript) {
+	if transcript == nil {
+		eng.process.SetRecorder(nil)
+		return
+	}
+	eng.process.SetRecorder(transcript)
+}
+
+// Name returns the name the engine announced with the myname
+// feature, or the name of the executable if it did not
+func (eng *Engine) Name() string {
+	return eng.name
+}
+
+// Feature returns the value of a feature announced by the engine
+func (eng *Engine) Feature(name string) (string, bool) {
+	value, ok := eng.features[name]
+	return value, ok
+}
+
+// Stderr returns the most recent output the engine wrote to stderr
+func (eng *Engine) Stderr() string {
+	return eng.process.Stderr()
+}
+
+// XBoard puts the engine in xboard mode, negotiates protocol
+// version 2 features, and leaves the engine in force mode
+func (eng *Engine) XBoard() error {
+	for _, command := range []string{"xboard", "protover 2"} {
+		if err := eng.process.Send(command); err != nil {
+			return err
+		}
+	}
+	err := eng.readFeatures()
+	if err != nil {
+		return err
+	}
+	for _, command := range []string{"new", "force", "post", "easy"} {
+		if err = eng.process.Send(command); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (eng *Engine) readFeatures() error {
+	deadline := time.Now().Add(eng.featureTimeout)
+	waiting := false
+	for {
+		var line string
+		var err error
+		if waiting {
+			line, err = eng.process.ReadLine(0)
+		} else {
+			line, err = eng.process.ReadLineWithin(time.Until(deadline))
+		}
+		if errors.Is(err, process.ErrTimeout) && !waiting {
+			// protocol version 1 engines never announce features,
+			// so they are only detected by the feature timeout
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		features, ok := strings.CutPrefix(line, "feature ")
+		if !ok {
+			continue
+		}
+		for _, feature := range parseFeatures(features) {
+			if feature[0] == "done" {
+				if feature[1] == "1" {
+					return nil
+				}
+				// done=0 asks for longer than the feature timeout
+				waiting = true
+				continue
+			}
+			// features asking for commands or notation we do not use are rejected
+			reply := "accepted "
+			switch feature[0] {
+			case "san", "name", "nps", "exclude":
+				reply = "rejected "
+			}
+			if feature[0] == "myname" {
+				eng.name = feature[1]
+			}
+			if reply == "accepted " {
+				eng.features[feature[0]] = feature[1]
+			}
+			if err = eng.process.Send(reply + feature[0]); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// parseFeatures splits a feature line into name and value pairs,
+// where values may be quoted strings containing spaces
+func parseFeatures(line string) [][2]string {
+	var features [][2]string
+	for line = strings.TrimSpace(line); line != ""; line = strings.TrimSpace(line) {
+		name, rest, _ := strings.Cut(line, "=")
+		value := ""
+		if strings.HasPrefix(rest, "\"") {
+			value, line, _ = strings.Cut(rest[1:], "\"")
+		} else {
+			value, line, _ = strings.Cut(rest, " ")
+		}
+		features = append(features, [2]string{strings.TrimSpace(name), value})
+	}
+	return features
+}
+
+// SetOptions sends the options the engine understands. Hash and
+// Threads need the memory and smp features, and Ponder is sent as
+// hard or easy. MultiPV and Elo have no CECP equivalent
+func (eng *Engine) SetOptions(opt uci.Options) error {
+	var commands []string
+	if _, ok := eng.features["memory"]; ok && opt.Hash > 0 {
+		commands = append(commands, fmt.Sprintf("memory %d", opt.Hash))
+	}
+	if _, ok := eng.features["smp"]; ok && opt.Threads > 0 {
+		commands = append(commands, fmt.Sprintf("cores %d", opt.Threads))
+	}
+	if opt.Ponder {
+		commands = append(commands, "hard")
+	} else {
+		commands = append(commands, "easy")
+	}
+	for _, command := range commands {
+		if err := eng.process.Send(command); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetPosition sets up the FEN position, or the start position if
+// the FEN is empty, and plays the moves given in coordinate notation.
+// The engine is only updated when the next search starts, so that
+// moves it already knows about do not have to be sent again
+func (eng *Engine) SetPosition(fen string, moves string) error {
+	if fen != "" && eng.features["setboard"] != "1" {
+		return fmt.Errorf("setboard %w", ErrUnsupported)
+	}
+	eng.fen = fen
+	eng.moves = strings.Fields(moves)
+	return nil
+}
+
+// Level sets a conventional clock: the number of moves per time
+// control (0 for the whole game), the base time and the increment
+func (eng *Engine) Level(movesPerSession int, base, increment time.Duration) error {
+	return eng.process.Send(level(movesPerSession, base, increment))
+}
+
+func level(movesPerSession int, base, increment time.Duration) string {
+	seconds := int(base.Seconds())
+	return fmt.Sprintf("level %d %d:%02d %g", movesPerSession, seconds/60, seconds%60, increment.Seconds())
+}
+
+// Clocks tells the engine the time left on its own and its opponent's
+// clock, to be sent before the engine is asked to move
+func (eng *Engine) Clocks(own, opponent time.Duration) error {
+	err := eng.process.Send(fmt.Sprintf("time %d", own.Milliseconds()/10))
+	if err != nil {
+		return err
+	}
+	return eng.process.Send(fmt.Sprintf("otim %d", opponent.Milliseconds()/10))
+}
+
+// IsReady waits for the engine to finish processing earlier
+// commands, using ping if the engine supports it
+func (eng *Engine) IsReady() error {
+	if eng.features["ping"] != "1" {
+		return nil
+	}
+	err := eng.process.Send("ping 1")
+	if err != nil {
+		return err
+	}
+	_, err = eng.process.ReadUntil("pong", nil)
+	return err
+}
+
+// Go asks the engine to move in the current position, searching to
+// the given depth (sd) and/or for the given time in milliseconds (st).
+// The engine's thinking output is returned as results
+func (eng *Engine) Go(depth int, searchmoves string, movetime int64, resultOpts ...uint) (*uci.Results, error) {
+	if searchmoves != "" {
+		return nil, fmt.Errorf("searchmoves %w", ErrUnsupported)
+	}
+	return eng.search(depth, movetime, nil, resultOpts...)
+}
+
+// GoClock asks the engine to move, telling it the time left on its own
+// and its opponent's clock. The Level is set from the stage of the time
+// control the engine is in, once for each new game
+func (eng *Engine) GoClock(clock uci.Clock, resultOpts ...uint) (*uci.Results, error) {
+	return eng.search(0, 0, &clock, resultOpts...)
+}
+
+// search brings the engine's board up to date, sends the search limits
+// and clocks and collects its thinking until it moves
+func (eng *Engine) search(depth int, movetime int64, clock *uci.Clock, resultOpts ...uint) (*uci.Results, error) {
+	var limits []string
+	white := eng.whiteToMove()
+	if clock != nil {
+		increment := clock.WhiteIncrement
+		if !white {
+			increment = clock.BlackIncrement
+		}
+		limits = append(limits, level(clock.StageMoves, clock.StageTime, increment))
+	}
+	if depth > 0 {
+		limits = append(limits, fmt.Sprintf("sd %d", depth))
+	}
+	if movetime > 0 {
+		limits = append(limits, fmt.Sprintf("st %d", (movetime+999)/1000))
+	}
+	// the limits stay in force until new, the only way to clear an sd
+	// or st left by an earlier search
+	if len(eng.limits) > 0 && !slices.Equal(eng.limits, limits) {
+		eng.synced = false
+	}
+	err := eng.sync()
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Equal(eng.limits, limits) {
+		for _, limit := range limits {
+			if err = eng.process.Send(limit); err != nil {
+				return nil, err
+			}
+		}
+		eng.limits = limits
+	}
+	timeout := time.Duration(movetime) * time.Millisecond
+	if clock != nil {
+		own, opponent := clock.WhiteTime, clock.BlackTime
+		if !white {
+			own, opponent = opponent, own
+		}
+		if err = eng.Clocks(own, opponent); err != nil {
+			return nil, err
+		}
+		timeout = own
+	}
+	if err = eng.process.Send("go"); err != nil {
+		return nil, err
+	}
+	// the engine now plays the side to move; put it back in force
+	// mode once it has moved so it does not answer our moves itself
+	defer func() { _ = eng.process.Send("force") }()
+
+	res := &uci.Results{}
+	byDepth := map[int]uci.ScoreResult{}
+	for {
+		line, err := eng.process.ReadLine(timeout)
+		if err != nil {
+			eng.synced = false
+			return nil, err
+		}
+		if move, ok := parseMove(line); ok {
+			res.BestMove = move
+			eng.played = append(eng.played, move)
+			break
+		}
+		if err = parseError(line, eng.whiteToMove()); err != nil {
+			eng.synced = false
+			return nil, err
+		}
+		if result, ok := parseThinking(line); ok {
+			byDepth[result.Depth] = result
+		}
+	}
+	highest := 0
+	for d := range byDepth {
+		highest = max(highest, d)
+	}
+	for d, result := range byDepth {
+		if len(resultOpts) == 1 && resultOpts[0]&uci.HighestDepthOnly != 0 && d != highest {
+			continue
+		}
+		res.Results = append(res.Results, result)
+	}
+	sort.Slice(res.Results, func(i, j int) bool { return res.Results[i].Depth < res.Results[j].Depth })
+	return res, nil
+}
+
+// Analyse puts the engine in analyze mode on the position until stop
+// is closed, passing update its thinking as it posts it. CECP has no
+// MultiPV, so there is only ever the one line
+func (eng *Engine) Analyse(_ int, stop <-chan struct{}, update func(lines []uci.ScoreResult)) error {
+	if eng.features["analyze"] == "0" {
+		return fmt.Errorf("analyze %w", ErrUnsupported)
+	}
+	err := eng.sync()
+	if err != nil {
+		return err
+	}
+	if err = eng.process.Send("analyze"); err != nil {
+		return err
+	}
+	for {
+		line, ok, err := eng.process.ReadLineUntil(stop)
+		if err != nil {
+			eng.synced = false
+			return err
+		}
+		if !ok {
+			break
+		}
+		if result, ok := parseThinking(line); ok {
+			update([]uci.ScoreResult{result})
+		}
+	}
+	if err = eng.process.Send("exit"); err != nil {
+		eng.synced = false
+		return err
+	}
+	// thinking posted before the engine left analyze mode is read
+	// and thrown away
+	return eng.IsReady()
+}
+
+// whiteToMove reports whether white is to move once the moves have
+// been played from the position
+func (eng *Engine) whiteToMove() bool {
+	white := true
+	if fields := strings.Fields(eng.fen); len(fields) > 1 {
+		white = fields[1] != "b"
+	}
+	return white == (len(eng.moves)%2 == 0)
+}
+
+// sync brings the engine's board in line with the position, sending
+// only the new moves if the engine's game is a prefix of it
+func (eng *Engine) sync() error {
+	played := len(eng.played)
+	if eng.synced && len(eng.moves) >= played && slices.Equal(eng.moves[:played], eng.played) && eng.fen == eng.boardFEN {
+		return eng.sendMoves(eng.moves[played:])
+	}
+	commands := []string{"new", "force"}
+	if eng.fen != "" {
+		commands = append(commands, "setboard "+eng.fen)
+	}
+	for _, command := range commands {
+		if err := eng.process.Send(command); err != nil {
+			return err
+		}
+	}
+	eng.boardFEN = eng.fen
+	eng.played = nil
+	eng.limits = nil
+	eng.synced = true
+	return eng.sendMoves(eng.moves)
+}
+
+func (eng *Engine) sendMoves(moves []string) error {
+	prefix := ""
+	if eng.features["usermove"] == "1" {
+		prefix = "usermove "
+	}
+	for _, move := range moves {
+		if err := eng.process.Send(prefix + move); err != nil {
+			eng.synced = false
+			return err
+		}
+		eng.played = append(eng.played, move)
+	}
+	return nil
+}
+
+// parseMove recognizes the engine announcing its move
+func parseMove(line string) (string, bool) {
+	if move, ok := strings.CutPrefix(line, "move "); ok {
+		return strings.TrimSpace(move), true
+	}
+	// protocol version 1 engines announce moves as "1. ... e7e5"
+	fields := strings.Fields(line)
+	if len(fields) == 3 && fields[1] == "..." && strings.HasSuffix(fields[0], ".") {
+		return fields[2], true
+	}
+	return "", false
+}
+
+// parseError recognizes results, resignations and errors. An engine
+// playing white resigns the game to black, and the other way round
+func parseError(line string, white bool) error {
+	for _, result := range []string{"1-0", "0-1", "1/2-1/2"} {
+		if reason, ok := strings.CutPrefix(line, result+" "); ok {
+			return &GameOverError{Result: result, Reason: strings.Trim(reason, "{} ")}
+		}
+	}
+	switch {
+	case line == "resign" && white:
+		return &GameOverError{Result: "0-1", Reason: "White resigns"}
+	case line == "resign":
+		return &GameOverError{Result: "1-0", Reason: "Black resigns"}
+	case strings.HasPrefix(line, "Illegal move"):
+		return errors.New(line)
+	case strings.HasPrefix(line, "Error"):
+		return errors.New(line)
+	}
+	return nil
+}
+
+// parseThinking parses the "ply score time nodes pv" lines an
+// engine posts while searching. Time is in centiseconds
+func parseThinking(line string) (uci.ScoreResult, bool) {
+	result := uci.ScoreResult{}
+	fields := strings.Fields(line)
+	if len(fields) < 5 {
+		return result, false
+	}
+	var values [4]int
+	for i := range values {
+		value, err := strconv.Atoi(strings.TrimRight(fields[i], ".&?"))
+		if err != nil {
+			return result, false
+		}
+		values[i] = value
+	}
+	result.Depth = values[0]
+	result.Score = values[1]
+	result.Time = values[2] * 10
+	result.Nodes = values[3]
+	if result.Time > 0 {
+		result.NodesPerSecond = result.Nodes * 1000 / result.Time
+	}
+	if distance := mateScore - abs(result.Score); distance >= 0 && distance < mateRange {
+		result.Mate = true
+		moves := (distance + 1) / 2
+		if result.Score < 0 {
+			moves = -moves
+		}
+		result.Score = moves
+	}
+	for _, move := range fields[4:] {
+		if strings.HasPrefix(move, "{") || strings.HasPrefix(move, "(") {
+			break
+		}
+		result.BestMoves = append(result.BestMoves, move)
+	}
+	return result, true
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// Close asks the engine to quit, killing the process
+// if it has not exited shortly afterwards
+func (eng *Engine) Close() {
+	eng.process.Close("quit")
+}
@@ -0,0 +1,298 @@
+package xboard
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+	"time"
+	"us.figge.chess/internal/engine/uci"
+	"us.figge.chess/internal/engine/uci/ucitest"
+)
+
+const (
+	handshake = `
+> protover 2
+< feature myname="Fake Crafty 25.2" setboard=1 usermove=1 ping=1 san=1 done=0
+< feature memory=1 smp=1 done=1
+`
+)
+
+func TestMain(m *testing.M) {
+	ucitest.Main()
+	os.Exit(m.Run())
+}
+
+func newEngine(t *testing.T, script string) (*Engine, *ucitest.Fake) {
+	fake := ucitest.New(t, script)
+	eng, err := NewEngine(fake.Path())
+	require.NoError(t, err)
+	t.Cleanup(eng.Close)
+	eng.SetTimeouts(time.Second, time.Second)
+	require.NoError(t, eng.XBoard())
+	return eng, fake
+}
+
+func TestEngine_XBoard(t *testing.T) {
+	eng, fake := newEngine(t, handshake+`
+> ping 1
+< pong 1
+> ping 1
+< pong 1
+`)
+	require.NoError(t, eng.IsReady())
+	require.NoError(t, eng.SetOptions(uci.Options{Hash: 64, Threads: 2}))
+	require.NoError(t, eng.IsReady())
+
+	assert.Equal(t, "Fake Crafty 25.2", eng.Name())
+	_, san := eng.Feature("san")
+	assert.False(t, san)
+	assert.Equal(t, []string{
+		"xboard",
+		"protover 2",
+		"accepted myname",
+		"accepted setboard",
+		"accepted usermove",
+		"accepted ping",
+		"rejected san",
+		"accepted memory",
+		"accepted smp",
+		"new",
+		"force",
+		"post",
+		"easy",
+		"ping 1",
+		"memory 64",
+		"cores 2",
+		"easy",
+		"ping 1",
+	}, fake.Commands())
+}
+
+func TestEngine_Go(t *testing.T) {
+	eng, fake := newEngine(t, handshake+`
+> go
+< 1 12 0 21 e7e5
+< 2 -8 1 143 e7e5 Nf3
+< 2 -5 2 298 e7e5 Nf3 {book}
+< move e7e5
+> go
+< 3 99995 15 12000 Qh4 g3 Qxg3
+< move d8h4
+> go
+< move e1g1
+`)
+	require.NoError(t, eng.SetPosition("", "e2e4"))
+	results, err := eng.Go(2, "", 1500)
+	require.NoError(t, err)
+	assert.Equal(t, "e7e5", results.BestMove)
+	assert.Equal(t, []uci.ScoreResult{
+		{Depth: 1, Score: 12, Nodes: 21, BestMoves: []string{"e7e5"}},
+		{Depth: 2, Score: -5, Time: 20, Nodes: 298, NodesPerSecond: 14900, BestMoves: []string{"e7e5", "Nf3"}},
+	}, results.Results)
+
+	// The engine already knows its own move, so only the new move is sent
+	require.NoError(t, eng.SetPosition("", "e2e4 e7e5 f2f3"))
+	results, err = eng.Go(2, "", 1500, uci.HighestDepthOnly)
+	require.NoError(t, err)
+	assert.Equal(t, "d8h4", results.BestMove)
+	assert.Equal(t, []uci.ScoreResult{
+		{Depth: 3, Score: 3, Mate: true, Time: 150, Nodes: 12000, NodesPerSecond: 80000, BestMoves: []string{"Qh4", "g3", "Qxg3"}},
+	}, results.Results)
+
+	// Starting from a new position resets the engine's board
+	require.NoError(t, eng.SetPosition("4k3/8/8/8/8/8/8/4K2R w K - 0 1", ""))
+	results, err = eng.Go(1, "", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "e1g1", results.BestMove)
+
+	eng.Close()
+	commands := fake.Commands()
+	assert.Equal(t, []string{
+		"new", "force", "usermove e2e4", "sd 2", "st 2", "go", "force",
+		"usermove f2f3", "go", "force",
+		"new", "force", "setboard 4k3/8/8/8/8/8/8/4K2R w K - 0 1", "sd 1", "go", "force",
+		"quit",
+	}, commands[len(commands)-17:])
+}
+
+func TestEngine_GoClock(t *testing.T) {
+	eng, fake := newEngine(t, handshake+`
+> go
+< move e7e5
+> go
+< move b8c6
+> go
+< move g1f3
+`)
+	clock := uci.Clock{WhiteTime: 30 * time.Second, BlackTime: 80 * time.Second, BlackIncrement: 2 * time.Second, MovesToGo: 12,
+		StageMoves: 40, StageTime: 90 * time.Second}
+	require.NoError(t, eng.SetPosition("", "e2e4"))
+	results, err := eng.GoClock(clock)
+	require.NoError(t, err)
+	assert.Equal(t, "e7e5", results.BestMove)
+
+	// the level stays in force for the rest of the game
+	clock.BlackTime = 75 * time.Second
+	require.NoError(t, eng.SetPosition("", "e2e4 e7e5 g1f3"))
+	results, err = eng.GoClock(clock)
+	require.NoError(t, err)
+	assert.Equal(t, "b8c6", results.BestMove)
+
+	require.NoError(t, eng.SetPosition("rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 2", "b8c6"))
+	results, err = eng.GoClock(clock)
+	require.NoError(t, err)
+	assert.Equal(t, "g1f3", results.BestMove)
+
+	eng.Close()
+	commands := fake.Commands()
+	assert.Equal(t, []string{
+		"new", "force", "usermove e2e4", "level 40 1:30 2", "time 8000", "otim 3000", "go", "force",
+		"usermove g1f3", "time 7500", "otim 3000", "go", "force",
+		"new", "force", "setboard rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 2", "usermove b8c6",
+		"level 40 1:30 0", "time 3000", "otim 7500", "go", "force",
+		"quit",
+	}, commands[len(commands)-23:])
+}
+
+func TestEngine_ClearLimits(t *testing.T) {
+	eng, fake := newEngine(t, handshake+`
+> go
+< move e7e5
+> go
+< move g1f3
+> go
+< move b8c6
+`)
+	require.NoError(t, eng.SetPosition("", "e2e4"))
+	_, err := eng.Go(3, "", 0)
+	require.NoError(t, err)
+	require.NoError(t, eng.SetPosition("", "e2e4 e7e5"))
+	_, err = eng.Go(3, "", 0)
+	require.NoError(t, err)
+	// a search on the clock starts a new game to drop the depth limit
+	require.NoError(t, eng.SetPosition("", "e2e4 e7e5 g1f3"))
+	_, err = eng.GoClock(uci.Clock{WhiteTime: time.Minute, BlackTime: time.Minute, StageTime: time.Minute})
+	require.NoError(t, err)
+
+	eng.Close()
+	commands := fake.Commands()
+	assert.Equal(t, []string{
+		"new", "force", "usermove e2e4", "sd 3", "go", "force",
+		"go", "force",
+		"new", "force", "usermove e2e4", "usermove e7e5", "usermove g1f3", "level 0 1:00 0", "time 6000", "otim 6000", "go", "force",
+		"quit",
+	}, commands[len(commands)-19:])
+}
+
+func TestEngine_Analyse(t *testing.T) {
+	eng, fake := newEngine(t, handshake+`
+> analyze
+< 1 12 0 21 e7e5
+< stat01: 0 21 1 1 20
+< 2 -8 1 143 e7e5 Nf3
+> ping 1
+< pong 1
+`)
+	require.NoError(t, eng.SetPosition("", "e2e4"))
+	var updates [][]uci.ScoreResult
+	stop := make(chan struct{})
+	err := eng.Analyse(3, stop, func(lines []uci.ScoreResult) {
+		updates = append(updates, lines)
+		if len(updates) == 2 {
+			close(stop)
+		}
+	})
+	require.NoError(t, err)
+	assert.Equal(t, [][]uci.ScoreResult{
+		{{Depth: 1, Score: 12, Nodes: 21, BestMoves: []string{"e7e5"}}},
+		{{Depth: 2, Score: -8, Time: 10, Nodes: 143, NodesPerSecond: 14300, BestMoves: []string{"e7e5", "Nf3"}}},
+	}, updates)
+
+	eng.Close()
+	commands := fake.Commands()
+	assert.Equal(t, []string{
+		"new", "force", "usermove e2e4", "analyze", "exit", "ping 1", "quit",
+	}, commands[len(commands)-7:])
+}
+
+func TestEngine_GameOver(t *testing.T) {
+	tests := map[string]struct {
+		moves  string
+		script string
+		result string
+		reason string
+	}{
+		"mate": {
+			script: `
+> go
+< 0-1 {Black mates}
+`,
+			result: "0-1",
+			reason: "Black mates",
+		},
+		"draw": {
+			script: `
+> go
+< 1/2-1/2 {Draw by repetition}
+`,
+			result: "1/2-1/2",
+			reason: "Draw by repetition",
+		},
+		"white resigns": {
+			script: `
+> go
+< resign
+`,
+			result: "0-1",
+			reason: "White resigns",
+		},
+		"black resigns": {
+			moves: "e2e4",
+			script: `
+> go
+< resign
+`,
+			result: "1-0",
+			reason: "Black resigns",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			eng, _ := newEngine(t, handshake+test.script)
+			require.NoError(tt, eng.SetPosition("", test.moves))
+			_, err := eng.Go(1, "", 0)
+			var gameOver *GameOverError
+			require.True(tt, errors.As(err, &gameOver), "expected game over, got %v", err)
+			assert.Equal(tt, test.result, gameOver.Result)
+			assert.Equal(tt, test.reason, gameOver.Reason)
+		})
+	}
+}
+
+func TestEngine_Unsupported(t *testing.T) {
+	eng, _ := newEngine(t, `
+> protover 2
+< feature done=1
+`)
+	assert.True(t, errors.Is(eng.SetPosition("8/8/8/8/8/8/8/K6k w - - 0 1", ""), ErrUnsupported))
+	_, err := eng.Go(1, "e2e4", 0)
+	assert.True(t, errors.Is(err, ErrUnsupported))
+}
+
+func TestEngine_ProtocolVersion1(t *testing.T) {
+	fake := ucitest.New(t, `
+> protover 2
+< Illegal move: protover
+`)
+	eng, err := NewEngine(fake.Path())
+	require.NoError(t, err)
+	defer eng.Close()
+	eng.featureTimeout = 100 * time.Millisecond
+
+	started := time.Now()
+	require.NoError(t, eng.XBoard())
+	assert.Less(t, time.Since(started), time.Second, "the read timeout isn't waited out")
+	assert.Empty(t, eng.features)
+}
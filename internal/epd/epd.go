@@ -0,0 +1,148 @@
+package epd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Record is a single EPD position along with its opcodes
+type Record struct {
+	FEN        string   // the position, with the move counters from hmvc and fmvn
+	ID         string   // id opcode
+	BestMoves  []string // bm opcode, in SAN
+	AvoidMoves []string // am opcode, in SAN
+	Comments   [10]string
+	Depth      int // acd opcode, zero when missing
+	Opcodes    map[string][]string
+	Line       int
+}
+
+// Parse reads the EPD records of a file, one per line, skipping blank
+// lines and lines starting with #
+func Parse(r io.Reader) ([]*Record, error) {
+	var records []*Record
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		record, err := ParseLine(text)
+		if err != nil {
+			return records, fmt.Errorf("line %d: %w", line, err)
+		}
+		record.Line = line
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// ParseLine parses a single EPD record
+func ParseLine(line string) (*Record, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("expected 4 position fields, found %d", len(fields))
+	}
+	record := &Record{Opcodes: map[string][]string{}}
+	rest := line
+	for range 4 {
+		rest = strings.TrimSpace(rest)
+		rest = rest[strings.IndexAny(rest+" ", " \t"):]
+	}
+	operations, err := splitOperations(rest)
+	if err != nil {
+		return nil, err
+	}
+	for _, operation := range operations {
+		opcode, operands := operation[0], operation[1:]
+		record.Opcodes[opcode] = operands
+		switch {
+		case opcode == "id" && len(operands) > 0:
+			record.ID = operands[0]
+		case opcode == "bm":
+			record.BestMoves = operands
+		case opcode == "am":
+			record.AvoidMoves = operands
+		case opcode == "acd":
+			if record.Depth, err = singleInt(opcode, operands); err != nil {
+				return nil, err
+			}
+		case len(opcode) == 2 && opcode[0] == 'c' && opcode[1] >= '0' && opcode[1] <= '9' && len(operands) > 0:
+			record.Comments[opcode[1]-'0'] = operands[0]
+		}
+	}
+
+	halfMoves, fullMoves := 0, 1
+	if operands, ok := record.Opcodes["hmvc"]; ok {
+		if halfMoves, err = singleInt("hmvc", operands); err != nil {
+			return nil, err
+		}
+	}
+	if operands, ok := record.Opcodes["fmvn"]; ok {
+		if fullMoves, err = singleInt("fmvn", operands); err != nil {
+			return nil, err
+		}
+	}
+	record.FEN = fmt.Sprintf("%s %s %s %s %d %d", fields[0], fields[1], fields[2], fields[3], halfMoves, fullMoves)
+	return record, nil
+}
+
+// splitOperations splits the operations of a record, each an opcode
+// followed by its operands and ended by a semicolon. Operands may be
+// quoted strings holding spaces and semicolons
+func splitOperations(text string) ([][]string, error) {
+	var operations [][]string
+	var operation []string
+	var word strings.Builder
+	quoted, inWord := false, false
+	endWord := func() {
+		if inWord {
+			operation = append(operation, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	for _, c := range text {
+		switch {
+		case quoted && c == '"':
+			quoted = false
+		case quoted:
+			word.WriteRune(c)
+		case c == '"':
+			quoted, inWord = true, true
+		case c == ';':
+			endWord()
+			if len(operation) > 0 {
+				operations = append(operations, operation)
+			}
+			operation = nil
+		case c == ' ' || c == '\t':
+			endWord()
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated string")
+	}
+	endWord()
+	if len(operation) > 0 {
+		return nil, fmt.Errorf("operation %s is missing its semicolon", operation[0])
+	}
+	return operations, nil
+}
+
+func singleInt(opcode string, operands []string) (int, error) {
+	if len(operands) != 1 {
+		return 0, fmt.Errorf("%s expects one operand", opcode)
+	}
+	value, err := strconv.Atoi(operands[0])
+	if err != nil {
+		return 0, fmt.Errorf("%s expects a number: %q", opcode, operands[0])
+	}
+	return value, nil
+}
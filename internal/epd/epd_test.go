@@ -0,0 +1,83 @@
+package epd
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := map[string]struct {
+		line     string
+		expected Record
+		err      string
+	}{
+		"win at chess": {
+			line: `2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 w - - bm Qg6; id "WAC.001";`,
+			expected: Record{
+				FEN:       "2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 w - - 0 1",
+				ID:        "WAC.001",
+				BestMoves: []string{"Qg6"},
+				Opcodes:   map[string][]string{"bm": {"Qg6"}, "id": {"WAC.001"}},
+			},
+		},
+		"several moves, comments and counters": {
+			line: `r1b1k2r/ppp2ppp/8/8/8/8/PPP2PPP/R3K2R b KQkq -  am O-O Kf8;acd 12; c0 "quiet; really"; c9 x; hmvc 3; fmvn 20;`,
+			expected: Record{
+				FEN:        "r1b1k2r/ppp2ppp/8/8/8/8/PPP2PPP/R3K2R b KQkq - 3 20",
+				AvoidMoves: []string{"O-O", "Kf8"},
+				Depth:      12,
+				Comments:   [10]string{0: "quiet; really", 9: "x"},
+				Opcodes: map[string][]string{
+					"am": {"O-O", "Kf8"}, "acd": {"12"}, "c0": {"quiet; really"}, "c9": {"x"},
+					"hmvc": {"3"}, "fmvn": {"20"},
+				},
+			},
+		},
+		"position only": {
+			line:     "8/8/8/8/8/8/8/K6k w - -",
+			expected: Record{FEN: "8/8/8/8/8/8/8/K6k w - - 0 1", Opcodes: map[string][]string{}},
+		},
+		"too few fields": {
+			line: "8/8/8/8/8/8/8/K6k w -",
+			err:  "expected 4 position fields, found 3",
+		},
+		"missing semicolon": {
+			line: "8/8/8/8/8/8/8/K6k w - - bm Ka2",
+			err:  "operation bm is missing its semicolon",
+		},
+		"unterminated string": {
+			line: `8/8/8/8/8/8/8/K6k w - - id "WAC;`,
+			err:  "unterminated string",
+		},
+		"bad depth": {
+			line: "8/8/8/8/8/8/8/K6k w - - acd deep;",
+			err:  `acd expects a number: "deep"`,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			record, err := ParseLine(test.line)
+			if test.err != "" {
+				assert.EqualError(tt, err, test.err)
+				return
+			}
+			require.NoError(tt, err)
+			assert.Equal(tt, test.expected, *record)
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	records, err := Parse(strings.NewReader(`# a suite
+8/8/8/8/8/8/8/K6k w - - id "one";
+
+8/8/8/8/8/8/8/K6k b - - id "two";
+8/8/8/8/8/8/8/K6k w -
+`))
+	assert.EqualError(t, err, "line 5: expected 4 position fields, found 3")
+	require.Len(t, records, 2)
+	assert.Equal(t, "two", records[1].ID)
+	assert.Equal(t, 4, records[1].Line)
+}
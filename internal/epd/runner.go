@@ -0,0 +1,136 @@
+package epd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+	"us.figge.chess/internal/engine"
+	"us.figge.chess/internal/engine/uci"
+)
+
+// Searcher searches a position for its best move, see engine.Search
+type Searcher interface {
+	Search(fen, moves string, depth int, movetime time.Duration) (*uci.Results, error)
+}
+
+// Result is the outcome of searching a single record
+type Result struct {
+	Record  *Record
+	Move    string // the move found, in SAN
+	Solved  bool
+	Elapsed time.Duration
+	Err     error
+}
+
+// Summary counts the outcomes of a run
+type Summary struct {
+	Solved  int
+	Failed  int
+	Errors  int
+	Elapsed time.Duration
+}
+
+// Run searches each record, at the depth given by its acd opcode or
+// else the depth given, for at most movetime. A record is solved when
+// the move found is one of its bm moves and none of its am moves.
+// Each result is reported as soon as it is known
+func Run(searcher Searcher, records []*Record, depth int, movetime time.Duration, report func(Result)) Summary {
+	var summary Summary
+	for _, record := range records {
+		result := run(searcher, record, depth, movetime)
+		summary.Elapsed += result.Elapsed
+		switch {
+		case result.Err != nil:
+			summary.Errors++
+		case result.Solved:
+			summary.Solved++
+		default:
+			summary.Failed++
+		}
+		if report != nil {
+			report(result)
+		}
+	}
+	return summary
+}
+
+func run(searcher Searcher, record *Record, depth int, movetime time.Duration) (result Result) {
+	result.Record = record
+	if len(record.BestMoves) == 0 && len(record.AvoidMoves) == 0 {
+		result.Err = errors.New("no bm or am opcode")
+		return
+	}
+	position, err := engine.ParseFEN(record.FEN)
+	if err != nil {
+		result.Err = err
+		return
+	}
+	bestMoves, err := parseMoves(position, record.BestMoves)
+	if err != nil {
+		result.Err = err
+		return
+	}
+	avoidMoves, err := parseMoves(position, record.AvoidMoves)
+	if err != nil {
+		result.Err = err
+		return
+	}
+	if record.Depth > 0 {
+		depth = record.Depth
+	}
+
+	start := time.Now()
+	results, err := searcher.Search(record.FEN, "", depth, movetime)
+	result.Elapsed = time.Since(start)
+	if err != nil {
+		result.Err = err
+		return
+	}
+	move, ok := position.ParseMove(results.BestMove)
+	if !ok {
+		result.Err = fmt.Errorf("engine returned an invalid move: %q", results.BestMove)
+		return
+	}
+	result.Move = position.SAN(move)
+	result.Solved = (len(bestMoves) == 0 || slices.Contains(bestMoves, move)) && !slices.Contains(avoidMoves, move)
+	return
+}
+
+func parseMoves(position *engine.Position, sans []string) ([]engine.Move, error) {
+	var moves []engine.Move
+	for _, san := range sans {
+		move, ok := position.ParseSAN(san)
+		if !ok {
+			return nil, fmt.Errorf("illegal move in record: %s", san)
+		}
+		moves = append(moves, move)
+	}
+	return moves, nil
+}
+
+// Print reports a result as a line of a table
+func Print(w io.Writer, result Result) {
+	id := result.Record.ID
+	if id == "" {
+		id = fmt.Sprintf("line %d", result.Record.Line)
+	}
+	switch {
+	case result.Err != nil:
+		_, _ = fmt.Fprintf(w, "%-12s error   %v\n", id, result.Err)
+	case result.Solved:
+		_, _ = fmt.Fprintf(w, "%-12s solved  %-8s %6.2fs\n", id, result.Move, result.Elapsed.Seconds())
+	default:
+		expected := "bm " + fmt.Sprint(result.Record.BestMoves)
+		if len(result.Record.BestMoves) == 0 {
+			expected = "am " + fmt.Sprint(result.Record.AvoidMoves)
+		}
+		_, _ = fmt.Fprintf(w, "%-12s failed  %-8s %6.2fs  %s\n", id, result.Move, result.Elapsed.Seconds(), expected)
+	}
+}
+
+func (s Summary) String() string {
+	total := s.Solved + s.Failed + s.Errors
+	return fmt.Sprintf("Solved %d of %d, failed %d, errors %d, in %s", s.Solved, total, s.Failed, s.Errors, s.Elapsed.Round(time.Millisecond))
+}
@@ -0,0 +1,98 @@
+package epd
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"us.figge.chess/internal/engine"
+	"us.figge.chess/internal/engine/uci"
+	"us.figge.chess/internal/engine/uci/ucitest"
+)
+
+func TestMain(m *testing.M) {
+	ucitest.Main()
+	os.Exit(m.Run())
+}
+
+// stubSearcher answers with a fixed move for each position
+type stubSearcher struct {
+	moves  map[string]string
+	depths []int
+}
+
+func (s *stubSearcher) Search(fen, _ string, depth int, _ time.Duration) (*uci.Results, error) {
+	s.depths = append(s.depths, depth)
+	move, ok := s.moves[fen]
+	if !ok {
+		return nil, errors.New("engine crashed")
+	}
+	return &uci.Results{BestMove: move}, nil
+}
+
+func TestRun(t *testing.T) {
+	records, err := Parse(strings.NewReader(`2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 w - - bm Qg6; id "WAC.001";
+2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 b - - bm Qd7 Nd7; acd 5; id "both";
+r3k2r/8/8/8/8/8/8/R3K2R w KQkq - am O-O; id "avoid";
+4k3/8/8/8/8/8/8/4K3 w - - am Ke2; id "crash";
+4k3/8/8/8/8/8/8/4K3 b - - id "no moves";
+4k3/8/8/8/8/8/8/4K3 b - - bm Qh1; id "bad record";
+`))
+	require.NoError(t, err)
+	searcher := &stubSearcher{moves: map[string]string{
+		"2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 w - - 0 1": "g3g6",
+		"2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 b - - 0 1": "g7f6",
+		"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1":                        "e1c1",
+	}}
+
+	var sb strings.Builder
+	var results []Result
+	summary := Run(searcher, records, 10, time.Second, func(result Result) {
+		results = append(results, result)
+		Print(&sb, result)
+	})
+	assert.Equal(t, Summary{Solved: 2, Failed: 1, Errors: 3, Elapsed: summary.Elapsed}, summary)
+	require.Len(t, results, 6)
+	assert.Equal(t, "Qg6", results[0].Move)
+	assert.True(t, results[0].Solved)
+	assert.Equal(t, "gxf6", results[1].Move)
+	assert.False(t, results[1].Solved)
+	assert.Equal(t, "O-O-O", results[2].Move)
+	assert.True(t, results[2].Solved)
+	assert.EqualError(t, results[3].Err, "engine crashed")
+	assert.EqualError(t, results[4].Err, "no bm or am opcode")
+	assert.EqualError(t, results[5].Err, "illegal move in record: Qh1")
+	assert.Equal(t, []int{10, 5, 10, 10}, searcher.depths, "acd overrides the depth")
+
+	lines := strings.Split(sb.String(), "\n")
+	assert.Regexp(t, `^WAC\.001 +solved +Qg6 +\d+\.\d\ds$`, lines[0])
+	assert.Regexp(t, `^both +failed +gxf6 +\d+\.\d\ds +bm \[Qd7 Nd7\]$`, lines[1])
+	assert.Equal(t, "crash        error   engine crashed", lines[3])
+	assert.Contains(t, summary.String(), "Solved 2 of 6, failed 1, errors 3, in ")
+}
+
+func TestRun_FullStrength(t *testing.T) {
+	fake := ucitest.New(t, `
+> go*
+< info depth 3 score cp 500 pv g3g6
+< bestmove g3g6
+`)
+	records, err := Parse(strings.NewReader(`2rr3k/pp3pp1/1nnqbN1p/3pN3/2pP4/2P3Q1/PPB4P/R4RK1 w - - bm Qg6; id "WAC.001";
+`))
+	require.NoError(t, err)
+	e := engine.NewEngine(engine.OptEnginePath(fake.Path()), engine.OptPlayers(engine.KindHuman, engine.KindHuman))
+	defer e.Close()
+	summary := Run(e, records, 3, time.Second, func(Result) {})
+	assert.Equal(t, 1, summary.Solved)
+
+	e.Close()
+	commands := fake.Commands()
+	assert.Contains(t, commands, "setoption name MultiPV value 1")
+	for _, command := range commands {
+		assert.NotContains(t, command, "UCI_LimitStrength", "the suite is searched at full strength")
+		assert.NotContains(t, command, "UCI_Elo")
+	}
+}
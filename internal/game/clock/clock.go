@@ -0,0 +1,280 @@
+package clock
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	. "us.figge.chess/internal/common"
+)
+
+// Mode is how a time control gives back time as moves are made
+type Mode int
+
+const (
+	Fischer     Mode = iota // the increment is added after each move
+	Bronstein               // the time used, up to the delay, is added back after each move
+	SimpleDelay             // the clock waits for the delay before it starts running
+)
+
+// Stage is one period of a time control
+type Stage struct {
+	Moves     int           // moves to be made in the stage, zero for the rest of the game
+	Time      time.Duration // time added to the clock as the stage starts
+	Increment time.Duration // increment or delay for each move of the stage
+}
+
+// Control is a time control: its stages, played in turn, with the last
+// repeating for as long as the game lasts when it has a move count
+type Control struct {
+	Stages []Stage
+	Mode   Mode
+}
+
+// modeMarks separate the minutes of a stage from its increment or delay
+var modeMarks = map[Mode]string{Fischer: "+", Bronstein: "b", SimpleDelay: "d"}
+
+// Parse reads a time control written as stages separated by colons,
+// each [moves/]minutes with an optional +seconds increment, or seconds
+// of delay after d for a simple delay or b for a Bronstein delay. So
+// "5" is five minutes sudden death, "3+2" adds two seconds a move and
+// "40/90+30:30+30" is 90 minutes for 40 moves then 30 for the rest,
+// with 30 seconds added a move throughout
+func Parse(text string) (Control, error) {
+	var c Control
+	incremented := false
+	for _, stage := range strings.Split(strings.TrimSpace(text), ":") {
+		s, mode, err := parseStage(stage)
+		if err != nil {
+			return Control{}, fmt.Errorf("time control %q: %w", text, err)
+		}
+		if s.Increment > 0 {
+			if incremented && mode != c.Mode {
+				return Control{}, fmt.Errorf("time control %q: stages mix increments and delays", text)
+			}
+			c.Mode, incremented = mode, true
+		}
+		c.Stages = append(c.Stages, s)
+	}
+	return c, nil
+}
+
+func parseStage(text string) (Stage, Mode, error) {
+	var s Stage
+	if moves, rest, ok := strings.Cut(text, "/"); ok {
+		n, err := strconv.Atoi(moves)
+		if err != nil || n < 1 {
+			return s, Fischer, fmt.Errorf("bad move count %q", moves)
+		}
+		s.Moves, text = n, rest
+	}
+	mode := Fischer
+	if i := strings.IndexAny(text, "+bd"); i >= 0 {
+		for m, mark := range modeMarks {
+			if text[i:i+1] == mark {
+				mode = m
+			}
+		}
+		seconds, err := strconv.ParseFloat(text[i+1:], 64)
+		if err != nil || seconds < 0 {
+			return s, mode, fmt.Errorf("bad increment %q", text[i+1:])
+		}
+		s.Increment, text = time.Duration(seconds*float64(time.Second)), text[:i]
+	}
+	minutes, err := strconv.ParseFloat(text, 64)
+	if err != nil || minutes <= 0 {
+		return s, mode, fmt.Errorf("bad minutes %q", text)
+	}
+	s.Time = time.Duration(minutes * float64(time.Minute))
+	return s, mode, nil
+}
+
+// String returns the time control written as Parse reads it
+func (c Control) String() string {
+	stages := make([]string, len(c.Stages))
+	for i, s := range c.Stages {
+		text := strconv.FormatFloat(s.Time.Minutes(), 'f', -1, 64)
+		if s.Moves > 0 {
+			text = strconv.Itoa(s.Moves) + "/" + text
+		}
+		if s.Increment > 0 {
+			text += modeMarks[c.Mode] + strconv.FormatFloat(s.Increment.Seconds(), 'f', -1, 64)
+		}
+		stages[i] = text
+	}
+	return strings.Join(stages, ":")
+}
+
+// Clock is a chess clock for both players. Only the clock of the player
+// to move runs, and pressing it at the end of a move starts the other
+type Clock struct {
+	control Control
+	now     func() time.Time
+	left    [2]time.Duration
+	stage   [2]int
+	moves   [2]int // moves made in the stage
+	turn    uint8
+	running bool
+	started time.Time
+}
+
+type Option func(*Clock)
+
+// OptSource sets where the clock reads the time from, so that it can
+// be driven by hand
+func OptSource(now func() time.Time) Option {
+	return func(c *Clock) {
+		c.now = now
+	}
+}
+
+func New(control Control, options ...Option) *Clock {
+	c := &Clock{control: control, now: time.Now}
+	for _, option := range options {
+		option(c)
+	}
+	c.Reset()
+	return c
+}
+
+func (c *Clock) Control() Control {
+	return c.control
+}
+
+// Reset stops the clock and sets both players back to the start of the
+// first stage
+func (c *Clock) Reset() {
+	c.running = false
+	c.stage, c.moves = [2]int{}, [2]int{}
+	for player := range c.left {
+		c.left[player] = 0
+		if len(c.control.Stages) > 0 {
+			c.left[player] = c.control.Stages[0].Time
+		}
+	}
+}
+
+// Start runs the clock of the player, stopping the other's
+func (c *Clock) Start(player uint8) {
+	c.Stop()
+	c.turn, c.running, c.started = player&PlayerMask, true, c.now()
+}
+
+// Stop stops the clock that is running, taking off the time it ran for
+func (c *Clock) Stop() {
+	if !c.running {
+		return
+	}
+	c.left[c.turn] = max(0, c.left[c.turn]-c.used(c.turn, c.now().Sub(c.started)))
+	c.running = false
+}
+
+// Running returns the player whose clock is running, if either is
+func (c *Clock) Running() (uint8, bool) {
+	return c.turn, c.running
+}
+
+// Press ends the move of the player whose clock is running, adding
+// their increment or delay and the time for their next stage if the
+// move ends one, and starts the other player's clock. A player out of
+// time has their clock stopped instead
+func (c *Clock) Press() {
+	if !c.running {
+		return
+	}
+	player, now := c.turn, c.now()
+	elapsed := now.Sub(c.started)
+	stage := c.currentStage(player)
+	c.left[player] -= c.used(player, elapsed)
+	if c.left[player] <= 0 {
+		c.left[player], c.running = 0, false
+		return
+	}
+	switch c.control.Mode {
+	case Fischer:
+		c.left[player] += stage.Increment
+	case Bronstein:
+		c.left[player] += min(elapsed, stage.Increment)
+	}
+	if c.moves[player]++; stage.Moves > 0 && c.moves[player] == stage.Moves {
+		c.stage[player] = min(c.stage[player]+1, len(c.control.Stages)-1)
+		c.moves[player] = 0
+		c.left[player] += c.currentStage(player).Time
+	}
+	c.turn, c.started = 1-player, now
+}
+
+// Remaining returns the time the player has left
+func (c *Clock) Remaining(player uint8) time.Duration {
+	player &= PlayerMask
+	left := c.left[player]
+	if c.running && c.turn == player {
+		left -= c.used(player, c.now().Sub(c.started))
+	}
+	return max(0, left)
+}
+
+// Flagged returns the player that has run out of time, if either has
+func (c *Clock) Flagged() (uint8, bool) {
+	for _, player := range []uint8{c.turn, 1 - c.turn} {
+		if c.Remaining(player) <= 0 {
+			return player, true
+		}
+	}
+	return 0, false
+}
+
+// Increment returns the time the player gains with each move of their
+// stage, which is only known ahead of the move with Fischer increments
+func (c *Clock) Increment(player uint8) time.Duration {
+	if c.control.Mode != Fischer {
+		return 0
+	}
+	return c.currentStage(player & PlayerMask).Increment
+}
+
+// MovesToGo returns the moves the player has left to make in their
+// stage, zero when it lasts the rest of the game
+func (c *Clock) MovesToGo(player uint8) int {
+	player &= PlayerMask
+	if stage := c.currentStage(player); stage.Moves > 0 {
+		return stage.Moves - c.moves[player]
+	}
+	return 0
+}
+
+// Stage returns the stage of the time control the player is in
+func (c *Clock) Stage(player uint8) Stage {
+	return c.currentStage(player & PlayerMask)
+}
+
+func (c *Clock) currentStage(player uint8) Stage {
+	if len(c.control.Stages) == 0 {
+		return Stage{}
+	}
+	return c.control.Stages[c.stage[player]]
+}
+
+// used returns the time taken off a player's clock for a move that has
+// taken so long, which with a simple delay starts after the delay
+func (c *Clock) used(player uint8, elapsed time.Duration) time.Duration {
+	if c.control.Mode == SimpleDelay {
+		return max(0, elapsed-c.currentStage(player).Increment)
+	}
+	return elapsed
+}
+
+// Format writes the time left on a clock as h:mm:ss, or m:ss, with
+// tenths of a second once under twenty seconds
+func Format(left time.Duration) string {
+	left = max(0, left)
+	if left < 20*time.Second {
+		tenths := int(left / (100 * time.Millisecond))
+		return fmt.Sprintf("0:%02d.%d", tenths/10, tenths%10)
+	}
+	seconds := int(left / time.Second)
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
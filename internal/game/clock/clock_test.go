@@ -0,0 +1,182 @@
+package clock
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+	. "us.figge.chess/internal/common"
+)
+
+// manual is a clock source moved on by hand
+type manual struct {
+	now time.Time
+}
+
+func (m *manual) Now() time.Time {
+	return m.now
+}
+
+func (m *manual) advance(d time.Duration) {
+	m.now = m.now.Add(d)
+}
+
+func newClock(t *testing.T, control string) (*Clock, *manual) {
+	t.Helper()
+	c, err := Parse(control)
+	require.NoError(t, err)
+	source := &manual{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	return New(c, OptSource(source.Now)), source
+}
+
+func TestParse(t *testing.T) {
+	tests := map[string]struct {
+		text    string
+		control Control
+		err     string
+	}{
+		"sudden death": {text: "5", control: Control{Stages: []Stage{{Time: 5 * time.Minute}}}},
+		"fischer":      {text: "3+2", control: Control{Stages: []Stage{{Time: 3 * time.Minute, Increment: 2 * time.Second}}}},
+		"bronstein":    {text: "5b3", control: Control{Stages: []Stage{{Time: 5 * time.Minute, Increment: 3 * time.Second}}, Mode: Bronstein}},
+		"simple delay": {text: "90d5", control: Control{Stages: []Stage{{Time: 90 * time.Minute, Increment: 5 * time.Second}}, Mode: SimpleDelay}},
+		"fractions":    {text: "0.5+0.5", control: Control{Stages: []Stage{{Time: 30 * time.Second, Increment: 500 * time.Millisecond}}}},
+		"repeating":    {text: "40/90+30", control: Control{Stages: []Stage{{Moves: 40, Time: 90 * time.Minute, Increment: 30 * time.Second}}}},
+		"multi-stage": {text: "40/90+30:30+30", control: Control{Stages: []Stage{
+			{Moves: 40, Time: 90 * time.Minute, Increment: 30 * time.Second},
+			{Time: 30 * time.Minute, Increment: 30 * time.Second},
+		}}},
+		"delay in a later stage": {text: "40/120:60d5", control: Control{Stages: []Stage{
+			{Moves: 40, Time: 120 * time.Minute},
+			{Time: 60 * time.Minute, Increment: 5 * time.Second},
+		}, Mode: SimpleDelay}},
+		"empty":         {text: "", err: `bad minutes ""`},
+		"no minutes":    {text: "40/", err: `bad minutes ""`},
+		"zero moves":    {text: "0/90", err: `bad move count "0"`},
+		"bad increment": {text: "5+x", err: `bad increment "x"`},
+		"mixed":         {text: "40/90+30:30d30", err: "stages mix increments and delays"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			control, err := Parse(test.text)
+			if test.err != "" {
+				require.Error(tt, err)
+				assert.Contains(tt, err.Error(), test.err)
+				return
+			}
+			require.NoError(tt, err)
+			assert.Equal(tt, test.control, control)
+			assert.Equal(tt, test.text, control.String())
+		})
+	}
+}
+
+func TestClock_Modes(t *testing.T) {
+	tests := map[string]struct {
+		control string
+		think   time.Duration
+		during  time.Duration // time shown while thinking
+		after   time.Duration // time left after pressing
+	}{
+		"sudden death":         {"1", 10 * time.Second, 50 * time.Second, 50 * time.Second},
+		"fischer":              {"1+5", 10 * time.Second, 50 * time.Second, 55 * time.Second},
+		"bronstein short move": {"1b5", 3 * time.Second, 57 * time.Second, 60 * time.Second},
+		"bronstein long move":  {"1b5", 10 * time.Second, 50 * time.Second, 55 * time.Second},
+		"simple short move":    {"1d5", 3 * time.Second, 60 * time.Second, 60 * time.Second},
+		"simple long move":     {"1d5", 10 * time.Second, 55 * time.Second, 55 * time.Second},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			c, source := newClock(tt, test.control)
+			c.Start(PlayerWhite)
+			source.advance(test.think)
+			assert.Equal(tt, test.during, c.Remaining(PlayerWhite))
+			assert.Equal(tt, time.Minute, c.Remaining(PlayerBlack))
+			c.Press()
+			assert.Equal(tt, test.after, c.Remaining(PlayerWhite))
+			player, running := c.Running()
+			assert.True(tt, running)
+			assert.Equal(tt, PlayerBlack, player)
+		})
+	}
+}
+
+func TestClock_Stages(t *testing.T) {
+	c, source := newClock(t, "2/10+1:5")
+	c.Start(PlayerWhite)
+	assert.Equal(t, 2, c.MovesToGo(PlayerWhite))
+	assert.Equal(t, time.Second, c.Increment(PlayerWhite))
+	for range 2 {
+		source.advance(time.Minute)
+		c.Press()
+		source.advance(time.Minute)
+		c.Press()
+	}
+	assert.Equal(t, 10*time.Minute-2*time.Minute+2*time.Second+5*time.Minute, c.Remaining(PlayerWhite))
+	assert.Equal(t, 0, c.MovesToGo(PlayerWhite))
+	assert.Equal(t, time.Duration(0), c.Increment(PlayerWhite))
+
+	// a last stage with a move count repeats
+	c, source = newClock(t, "1/1")
+	c.Start(PlayerWhite)
+	for range 3 {
+		source.advance(30 * time.Second)
+		c.Press()
+		c.Start(PlayerWhite)
+	}
+	assert.Equal(t, 150*time.Second, c.Remaining(PlayerWhite))
+	assert.Equal(t, 1, c.MovesToGo(PlayerWhite))
+}
+
+func TestClock_Flag(t *testing.T) {
+	c, source := newClock(t, "1+10")
+	c.Start(PlayerWhite)
+	_, flagged := c.Flagged()
+	assert.False(t, flagged)
+	source.advance(time.Minute)
+	player, flagged := c.Flagged()
+	assert.True(t, flagged)
+	assert.Equal(t, PlayerWhite, player)
+
+	// no increment is added to a clock that has run out
+	c.Press()
+	assert.Equal(t, time.Duration(0), c.Remaining(PlayerWhite))
+	_, running := c.Running()
+	assert.False(t, running)
+
+	c.Reset()
+	_, flagged = c.Flagged()
+	assert.False(t, flagged)
+	assert.Equal(t, time.Minute, c.Remaining(PlayerWhite))
+}
+
+func TestClock_Stop(t *testing.T) {
+	c, source := newClock(t, "1")
+	c.Start(PlayerBlack)
+	source.advance(10 * time.Second)
+	c.Stop()
+	source.advance(10 * time.Second)
+	assert.Equal(t, 50*time.Second, c.Remaining(PlayerBlack))
+	c.Start(PlayerWhite)
+	source.advance(5 * time.Second)
+	assert.Equal(t, 55*time.Second, c.Remaining(PlayerWhite))
+	assert.Equal(t, 50*time.Second, c.Remaining(PlayerBlack))
+}
+
+func TestFormat(t *testing.T) {
+	tests := map[string]struct {
+		left time.Duration
+		text string
+	}{
+		"hours":    {time.Hour + 2*time.Minute + 3*time.Second, "1:02:03"},
+		"minutes":  {5*time.Minute + 7*time.Second + 900*time.Millisecond, "5:07"},
+		"twenty":   {20 * time.Second, "0:20"},
+		"tenths":   {9*time.Second + 450*time.Millisecond, "0:09.4"},
+		"out":      {0, "0:00.0"},
+		"negative": {-time.Second, "0:00.0"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			assert.Equal(tt, test.text, Format(test.left))
+		})
+	}
+}
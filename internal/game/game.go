@@ -2,12 +2,16 @@ package game
 
 import (
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"us.figge.chess/internal/board"
+	. "us.figge.chess/internal/common"
 	"us.figge.chess/internal/engine"
+	"us.figge.chess/internal/pgn"
 )
 
 const (
 	SquareSize = 71
+	maxPlies   = 10000
 )
 
 type Game struct {
@@ -15,29 +19,126 @@ type Game struct {
 	engine *engine.Engine
 }
 
-func NewGame() *Game {
+func NewGame(pgnDir string, engineOptions ...engine.Option) *Game {
 	ebiten.SetVsyncEnabled(true)
 	ebiten.SetScreenClearedEveryFrame(false)
-	eng := engine.NewEngine()
+	eng := engine.NewEngine(engineOptions...)
 	g := &Game{
 		board: board.NewBoard(eng,
 			board.OptSquareSize(SquareSize),
 			board.OptDebugEnabled(true),
 			board.OptWhiteRGB(0xf1, 0xd9, 0xc0),
 			board.OptBlackRGB(0xa9, 0x7a, 0x65),
+			board.OptPGNDir(pgnDir),
+			board.OptEvalBar(true),
 		),
 	}
 	g.board.Setup("")
 	return g
 }
 
+// LoadGame shows a game to step through with the arrow keys
+func (g *Game) LoadGame(pg *pgn.Game) {
+	g.board.LoadGame(pg)
+}
+
 func (g *Game) Update() error {
+	if g.board.IsTyping() {
+		return g.board.Update()
+	}
 	if ebiten.IsKeyPressed(ebiten.KeyQ) {
 		return ebiten.Termination
 	}
+	if g.board.IsEditing() {
+		switch {
+		case inpututil.IsKeyJustPressed(ebiten.KeyEscape):
+			g.board.CancelEdit()
+		case inpututil.IsKeyJustPressed(ebiten.KeyEnter):
+			g.board.StartFromEdit(false)
+		}
+		return g.board.Update()
+	}
+	if g.updateCursor() {
+		return g.board.Update()
+	}
+	command := ebiten.IsKeyPressed(ebiten.KeyControl) || ebiten.IsKeyPressed(ebiten.KeyMeta)
+	shift := ebiten.IsKeyPressed(ebiten.KeyShift)
+	switch {
+	case command && inpututil.IsKeyJustPressed(ebiten.KeyY),
+		command && shift && inpututil.IsKeyJustPressed(ebiten.KeyZ):
+		g.board.Redo()
+	case command && inpututil.IsKeyJustPressed(ebiten.KeyZ):
+		g.board.Takeback()
+	case command && inpututil.IsKeyJustPressed(ebiten.KeyUp):
+		g.board.PromoteVariation()
+	case command && (inpututil.IsKeyJustPressed(ebiten.KeyDelete) || inpututil.IsKeyJustPressed(ebiten.KeyBackspace)):
+		g.board.DeleteFromHere()
+	case inpututil.IsKeyJustPressed(ebiten.KeyR):
+		g.board.Flip()
+	// starting a new game drops the one on the board, so takes Shift
+	case shift && !command && inpututil.IsKeyJustPressed(ebiten.KeyW):
+		g.board.PlayAs(PlayerWhite)
+	case shift && !command && inpututil.IsKeyJustPressed(ebiten.KeyB):
+		g.board.PlayAs(PlayerBlack)
+	case inpututil.IsKeyJustPressed(ebiten.KeyTab):
+		g.board.ToggleCursor()
+	case inpututil.IsKeyJustPressed(ebiten.KeyM):
+		g.board.PromptMove()
+	case inpututil.IsKeyJustPressed(ebiten.KeyA):
+		g.board.ToggleAnalysis()
+	case inpututil.IsKeyJustPressed(ebiten.KeyH):
+		g.board.Hint()
+	case inpututil.IsKeyJustPressed(ebiten.KeyT):
+		g.board.Threat()
+	case inpututil.IsKeyJustPressed(ebiten.KeyX):
+		g.board.ClearAnnotations()
+	case inpututil.IsKeyJustPressed(ebiten.KeyE):
+		g.board.Edit()
+	case inpututil.IsKeyJustPressed(ebiten.KeyF):
+		g.board.ShowFEN()
+	case inpututil.IsKeyJustPressed(ebiten.KeyP):
+		g.board.ShowPGN()
+	case inpututil.IsKeyJustPressed(ebiten.KeyS):
+		g.board.SaveGame()
+	case inpututil.IsKeyJustPressed(ebiten.KeyLeft):
+		g.board.Step(-1)
+	case inpututil.IsKeyJustPressed(ebiten.KeyRight):
+		g.board.Step(1)
+	case inpututil.IsKeyJustPressed(ebiten.KeyHome):
+		g.board.Step(-maxPlies)
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnd):
+		g.board.Step(maxPlies)
+	}
 	return g.board.Update()
 }
 
+// updateCursor moves the square cursor, when it is shown, with the
+// arrow keys and picks up and puts down pieces with Enter or Space. It
+// reports whether it used a key. Keys pressed with Ctrl or Cmd are left
+// to the commands
+func (g *Game) updateCursor() bool {
+	if !g.board.HasCursor() || ebiten.IsKeyPressed(ebiten.KeyControl) || ebiten.IsKeyPressed(ebiten.KeyMeta) {
+		return false
+	}
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyLeft):
+		g.board.MoveCursor(-1, 0)
+	case inpututil.IsKeyJustPressed(ebiten.KeyRight):
+		g.board.MoveCursor(1, 0)
+	case inpututil.IsKeyJustPressed(ebiten.KeyUp):
+		g.board.MoveCursor(0, -1)
+	case inpututil.IsKeyJustPressed(ebiten.KeyDown):
+		g.board.MoveCursor(0, 1)
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnter), inpututil.IsKeyJustPressed(ebiten.KeySpace):
+		g.board.CursorSelect()
+	case inpututil.IsKeyJustPressed(ebiten.KeyEscape):
+		g.board.CursorCancel()
+	default:
+		return false
+	}
+	return true
+}
+
 func (g *Game) Draw(screen *ebiten.Image) {
 	g.board.Draw(screen)
 }
@@ -0,0 +1,212 @@
+package tree
+
+import (
+	"slices"
+	"time"
+	"us.figge.chess/internal/pgn"
+)
+
+// Node is a move in the game tree along with its annotations. The
+// first child of a node is the mainline, the others are sidelines
+type Node struct {
+	Move    string // UCI long algebraic notation, empty for the root
+	SAN     string
+	Comment string
+	NAGs    []int
+	Clock   time.Duration // time left after the move, zero if not recorded
+	Eval    string        // evaluation after the move, see pgn.FormatEval
+	pgn.Annotations
+
+	parent   *Node
+	children []*Node
+}
+
+// Tree is a game with all its variations and the node currently shown
+type Tree struct {
+	root    *Node
+	current *Node
+}
+
+func New() *Tree {
+	root := &Node{}
+	return &Tree{root: root, current: root}
+}
+
+func (t *Tree) Root() *Node {
+	return t.root
+}
+
+func (t *Tree) Current() *Node {
+	return t.current
+}
+
+// Goto makes the node current. It must belong to the tree
+func (t *Tree) Goto(n *Node) {
+	t.current = n
+}
+
+// Back makes the parent of the current node current
+func (t *Tree) Back() bool {
+	if t.current.parent == nil {
+		return false
+	}
+	t.current = t.current.parent
+	return true
+}
+
+// Forward makes the mainline child of the current node current
+func (t *Tree) Forward() bool {
+	if len(t.current.children) == 0 {
+		return false
+	}
+	t.current = t.current.children[0]
+	return true
+}
+
+// Play makes the child of the current node with the move current,
+// adding it when the move hasn't been played from here before
+func (t *Tree) Play(move, san string) *Node {
+	t.current = t.current.AddChild(move, san)
+	return t.current
+}
+
+// Mainline returns the nodes of the mainline, from the first move
+func (t *Tree) Mainline() []*Node {
+	var nodes []*Node
+	for n := t.root; len(n.children) > 0; n = n.children[0] {
+		nodes = append(nodes, n.children[0])
+	}
+	return nodes
+}
+
+// Moves returns the moves of the game, with the sidelines as
+// variations, ready to be written as PGN
+func (t *Tree) Moves() []pgn.Move {
+	return t.root.line()
+}
+
+func (n *Node) Parent() *Node {
+	return n.parent
+}
+
+func (n *Node) Children() []*Node {
+	return n.children
+}
+
+// Child returns the child reached by the move, if it has been played
+func (n *Node) Child(move string) *Node {
+	for _, child := range n.children {
+		if child.Move == move {
+			return child
+		}
+	}
+	return nil
+}
+
+// AddChild returns the child reached by the move, adding it as the
+// last sideline when it is new
+func (n *Node) AddChild(move, san string) *Node {
+	if child := n.Child(move); child != nil {
+		return child
+	}
+	child := &Node{Move: move, SAN: san, parent: n}
+	n.children = append(n.children, child)
+	return child
+}
+
+// Ply returns the number of moves played to reach the node
+func (n *Node) Ply() int {
+	ply := 0
+	for p := n.parent; p != nil; p = p.parent {
+		ply++
+	}
+	return ply
+}
+
+// Path returns the nodes from the first move down to this node
+func (n *Node) Path() []*Node {
+	var path []*Node
+	for p := n; p.parent != nil; p = p.parent {
+		path = append(path, p)
+	}
+	slices.Reverse(path)
+	return path
+}
+
+// IsMainline reports whether the node is on the mainline of the game
+func (n *Node) IsMainline() bool {
+	for p := n; p.parent != nil; p = p.parent {
+		if p.parent.children[0] != p {
+			return false
+		}
+	}
+	return true
+}
+
+// Promote moves the variation holding the node one place up among its
+// siblings, making it the mainline of its parent when it is first
+func (n *Node) Promote() bool {
+	for p := n; p.parent != nil; p = p.parent {
+		siblings := p.parent.children
+		if i := slices.Index(siblings, p); i > 0 {
+			siblings[i-1], siblings[i] = siblings[i], siblings[i-1]
+			return true
+		}
+	}
+	return false
+}
+
+// MakeMainline promotes every move leading to the node so that it is
+// on the mainline of the game
+func (n *Node) MakeMainline() {
+	for p := n; p.parent != nil; p = p.parent {
+		siblings := p.parent.children
+		i := slices.Index(siblings, p)
+		copy(siblings[1:i+1], siblings[:i])
+		siblings[0] = p
+	}
+}
+
+// Delete removes the node and every move after it from the tree. When
+// the current node is removed its parent becomes current
+func (t *Tree) Delete(n *Node) {
+	if n.parent == nil {
+		n.children = nil
+		t.current = n
+		return
+	}
+	for p := t.current; p != nil; p = p.parent {
+		if p == n {
+			t.current = n.parent
+			break
+		}
+	}
+	n.parent.children = slices.DeleteFunc(n.parent.children, func(c *Node) bool { return c == n })
+	n.parent = nil
+}
+
+// line returns the moves following the node, the mainline with the
+// sidelines as variations
+func (n *Node) line() []pgn.Move {
+	var moves []pgn.Move
+	for len(n.children) > 0 {
+		move := n.children[0].pgnMove()
+		for _, side := range n.children[1:] {
+			move.Variations = append(move.Variations, append([]pgn.Move{side.pgnMove()}, side.line()...))
+		}
+		moves = append(moves, move)
+		n = n.children[0]
+	}
+	return moves
+}
+
+func (n *Node) pgnMove() pgn.Move {
+	return pgn.Move{
+		SAN:         n.SAN,
+		NAGs:        slices.Clone(n.NAGs),
+		Comment:     n.Comment,
+		Clock:       n.Clock,
+		Eval:        n.Eval,
+		Annotations: n.Annotations.Clone(),
+	}
+}
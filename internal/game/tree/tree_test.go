@@ -0,0 +1,128 @@
+package tree
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"us.figge.chess/internal/pgn"
+)
+
+// newTree builds 1. e4 e5 (1... c5 2. Nf3) (1... e6) 2. Nf3
+func newTree() (*Tree, map[string]*Node) {
+	t := New()
+	nodes := map[string]*Node{}
+	nodes["e4"] = t.Play("e2e4", "e4")
+	nodes["e5"] = t.Play("e7e5", "e5")
+	nodes["Nf3"] = t.Play("g1f3", "Nf3")
+	t.Goto(nodes["e4"])
+	nodes["c5"] = t.Play("c7c5", "c5")
+	nodes["c5 Nf3"] = t.Play("g1f3", "Nf3")
+	t.Goto(nodes["e4"])
+	nodes["e6"] = t.Play("e7e6", "e6")
+	return t, nodes
+}
+
+func sans(moves []pgn.Move) []string {
+	var s []string
+	for _, move := range moves {
+		s = append(s, move.SAN)
+		for _, variation := range move.Variations {
+			s = append(s, "(")
+			s = append(s, sans(variation)...)
+			s = append(s, ")")
+		}
+	}
+	return s
+}
+
+func TestTree_Navigation(t *testing.T) {
+	tr, nodes := newTree()
+	assert.Equal(t, nodes["e6"], tr.Current())
+	assert.Equal(t, 2, nodes["e6"].Ply())
+	assert.False(t, nodes["e6"].IsMainline())
+	assert.True(t, nodes["Nf3"].IsMainline())
+	assert.Equal(t, []*Node{nodes["e4"], nodes["c5"], nodes["c5 Nf3"]}, nodes["c5 Nf3"].Path())
+
+	require.True(t, tr.Back())
+	require.True(t, tr.Forward())
+	assert.Equal(t, nodes["e5"], tr.Current(), "forward follows the mainline")
+	require.True(t, tr.Back())
+	require.True(t, tr.Back())
+	assert.Equal(t, tr.Root(), tr.Current())
+	assert.False(t, tr.Back())
+
+	// playing a known move reuses its node
+	tr.Goto(nodes["e4"])
+	assert.Equal(t, nodes["c5"], tr.Play("c7c5", "c5"))
+	assert.Len(t, nodes["e4"].Children(), 3)
+	assert.Equal(t, nodes["e5"], nodes["e4"].Child("e7e5"))
+	assert.Nil(t, nodes["e4"].Child("d7d5"))
+	tr.Goto(nodes["Nf3"])
+	assert.False(t, tr.Forward())
+}
+
+func TestTree_Moves(t *testing.T) {
+	tr, nodes := newTree()
+	nodes["e5"].Comment = "classical"
+	nodes["e5"].NAGs = []int{1}
+	moves := tr.Moves()
+	assert.Equal(t, []string{"e4", "e5", "(", "c5", "Nf3", ")", "(", "e6", ")", "Nf3"}, sans(moves))
+	assert.Equal(t, "classical", moves[1].Comment)
+	assert.Equal(t, []int{1}, moves[1].NAGs)
+	assert.Equal(t, []*Node{nodes["e4"], nodes["e5"], nodes["Nf3"]}, tr.Mainline())
+}
+
+func TestTree_Edit(t *testing.T) {
+	tests := map[string]struct {
+		edit     func(tt *testing.T, tr *Tree, nodes map[string]*Node)
+		expected []string
+		current  string
+	}{
+		"promote a sideline one place": {
+			edit:     func(tt *testing.T, tr *Tree, nodes map[string]*Node) { assert.True(tt, nodes["e6"].Promote()) },
+			expected: []string{"e4", "e5", "(", "e6", ")", "(", "c5", "Nf3", ")", "Nf3"},
+			current:  "e6",
+		},
+		"promote from deep in a sideline": {
+			edit:     func(tt *testing.T, tr *Tree, nodes map[string]*Node) { assert.True(tt, nodes["c5 Nf3"].Promote()) },
+			expected: []string{"e4", "c5", "(", "e5", "Nf3", ")", "(", "e6", ")", "Nf3"},
+			current:  "e6",
+		},
+		"promote the mainline": {
+			edit:     func(tt *testing.T, tr *Tree, nodes map[string]*Node) { assert.False(tt, nodes["Nf3"].Promote()) },
+			expected: []string{"e4", "e5", "(", "c5", "Nf3", ")", "(", "e6", ")", "Nf3"},
+			current:  "e6",
+		},
+		"make mainline": {
+			edit:     func(tt *testing.T, tr *Tree, nodes map[string]*Node) { nodes["e6"].MakeMainline() },
+			expected: []string{"e4", "e6", "(", "e5", "Nf3", ")", "(", "c5", "Nf3", ")"},
+			current:  "e6",
+		},
+		"delete the current node": {
+			edit:     func(tt *testing.T, tr *Tree, nodes map[string]*Node) { tr.Delete(nodes["e6"]) },
+			expected: []string{"e4", "e5", "(", "c5", "Nf3", ")", "Nf3"},
+			current:  "e4",
+		},
+		"delete from the mainline": {
+			edit: func(tt *testing.T, tr *Tree, nodes map[string]*Node) {
+				tr.Goto(nodes["Nf3"])
+				tr.Delete(nodes["e5"])
+			},
+			expected: []string{"e4", "c5", "(", "e6", ")", "Nf3"},
+			current:  "e4",
+		},
+		"delete elsewhere": {
+			edit:     func(tt *testing.T, tr *Tree, nodes map[string]*Node) { tr.Delete(nodes["c5"]) },
+			expected: []string{"e4", "e5", "(", "e6", ")", "Nf3"},
+			current:  "e6",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			tr, nodes := newTree()
+			test.edit(tt, tr, nodes)
+			assert.Equal(tt, test.expected, sans(tr.Moves()))
+			assert.Equal(tt, nodes[test.current], tr.Current())
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package pgn
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Results of a game as written in the Result tag and after the moves
+const (
+	ResultWhiteWins = "1-0"
+	ResultBlackWins = "0-1"
+	ResultDraw      = "1/2-1/2"
+	ResultOngoing   = "*"
+)
+
+var (
+	arrowAnnotation  = regexp.MustCompile(`^[GRYB][a-h][1-8][a-h][1-8]$`)
+	circleAnnotation = regexp.MustCompile(`^[GRYB][a-h][1-8]$`)
+)
+
+// sevenTagRoster are the tags every PGN game has, in the order
+// they must be written
+var sevenTagRoster = []string{"Event", "Site", "Date", "Round", "White", "Black", "Result"}
+
+// Tag is a single PGN tag pair
+type Tag struct {
+	Name  string
+	Value string
+}
+
+// Annotations are the arrows and circled squares drawn on the board
+// in a position, as the [%cal] and [%csl] commands record them. Each
+// starts with its colour: G, R, Y or B
+type Annotations struct {
+	Arrows  []string // colour, then the squares from and to, as in "Ge2e4"
+	Circles []string // colour, then the square, as in "Rd4"
+}
+
+// Move is a move of the game along with anything recorded about it
+type Move struct {
+	SAN         string
+	NAGs        []int         // numeric annotation glyphs, $1 for "!" and so on
+	Comment     string        // free text, without the braces
+	Clock       time.Duration // time left after the move, zero if not recorded
+	Eval        string        // evaluation after the move, see FormatEval
+	Variations  [][]Move      // lines played instead of this move
+	Line        int           // where the move was read, zero if it wasn't
+	Column      int
+	Annotations // drawn in the position after the move
+}
+
+// Game is a single game record
+type Game struct {
+	Tags        []Tag
+	Comment     string // comment before the first move
+	Moves       []Move
+	Result      string
+	Annotations // drawn in the starting position
+}
+
+// Error is an error in a game, either in its syntax or an illegal
+// move, found at a line and column of the file it was read from
+type Error struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+// Errorf returns an error at the place the move was read
+func (m Move) Errorf(format string, args ...any) error {
+	return &Error{Line: m.Line, Column: m.Column, Message: fmt.Sprintf(format, args...)}
+}
+
+// Tag returns the value of the named tag
+func (g *Game) Tag(name string) (string, bool) {
+	for _, tag := range g.Tags {
+		if tag.Name == name {
+			return tag.Value, true
+		}
+	}
+	return "", false
+}
+
+// SetTag replaces the value of the named tag, adding it if missing
+func (g *Game) SetTag(name, value string) {
+	for i := range g.Tags {
+		if g.Tags[i].Name == name {
+			g.Tags[i].Value = value
+			return
+		}
+	}
+	g.Tags = append(g.Tags, Tag{Name: name, Value: value})
+}
+
+// FormatEval formats a score from white's point of view the way
+// the [%eval] command expects, pawns or mate in moves
+func FormatEval(score int, mate bool) string {
+	if mate {
+		return fmt.Sprintf("#%d", score)
+	}
+	return fmt.Sprintf("%.2f", float64(score)/100)
+}
+
+// ParseEval reads an evaluation written by FormatEval, or by another
+// program, back into a score from white's point of view
+func ParseEval(eval string) (score int, mate bool, ok bool) {
+	eval = strings.TrimSpace(eval)
+	if moves, found := strings.CutPrefix(eval, "#"); found {
+		score, err := strconv.Atoi(moves)
+		return score, true, err == nil
+	}
+	pawns, err := strconv.ParseFloat(eval, 64)
+	if err != nil {
+		return 0, false, false
+	}
+	return int(math.Round(pawns * 100)), false, true
+}
+
+// FormatClock formats a clock the way the [%clk] command expects
+func FormatClock(clock time.Duration) string {
+	seconds := int(clock / time.Second)
+	return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
+
+// FormatDate formats a date the way the Date tag expects
+func FormatDate(date time.Time) string {
+	return date.Format("2006.01.02")
+}
+
+// startingMove returns the fullmove number and side to move of the
+// first move, taken from the FEN tag when the game has one
+func (g *Game) startingMove() (int, bool) {
+	fen, ok := g.Tag("FEN")
+	if !ok {
+		return 1, false
+	}
+	fields := strings.Fields(fen)
+	black := len(fields) > 1 && fields[1] == "b"
+	number := 1
+	if len(fields) > 5 {
+		if _, err := fmt.Sscanf(fields[5], "%d", &number); err != nil || number < 1 {
+			number = 1
+		}
+	}
+	return number, black
+}
+
+func (m Move) comment() string {
+	var parts []string
+	if m.Clock > 0 {
+		parts = append(parts, "[%clk "+FormatClock(m.Clock)+"]")
+	}
+	if m.Eval != "" {
+		parts = append(parts, "[%eval "+m.Eval+"]")
+	}
+	parts = append(parts, m.commands()...)
+	if m.Comment != "" {
+		// a comment can't be nested, so it can't hold a closing brace
+		parts = append(parts, strings.ReplaceAll(m.Comment, "}", ")"))
+	}
+	return strings.Join(parts, " ")
+}
+
+// comment returns the comment before the first move, with the commands
+// for the annotations of the starting position
+func (g *Game) comment() string {
+	return strings.Join(append(g.commands(), g.Comment), " ")
+}
+
+// Clone returns a copy of the annotations that shares no storage with
+// them, to be changed without changing the game they came from
+func (a Annotations) Clone() Annotations {
+	return Annotations{Arrows: slices.Clone(a.Arrows), Circles: slices.Clone(a.Circles)}
+}
+
+// commands returns the [%csl] and [%cal] commands for the annotations
+func (a Annotations) commands() []string {
+	var commands []string
+	if len(a.Circles) > 0 {
+		commands = append(commands, "[%csl "+strings.Join(a.Circles, ",")+"]")
+	}
+	if len(a.Arrows) > 0 {
+		commands = append(commands, "[%cal "+strings.Join(a.Arrows, ",")+"]")
+	}
+	return commands
+}
+
+// addCommand adds the arrows or circles of a [%cal] or [%csl] command,
+// skipping any that aren't written as they should be
+func (a *Annotations) addCommand(name, value string) {
+	switch name {
+	case "cal":
+		a.Arrows = appendAnnotations(a.Arrows, value, arrowAnnotation)
+	case "csl":
+		a.Circles = appendAnnotations(a.Circles, value, circleAnnotation)
+	}
+}
+
+func appendAnnotations(annotations []string, value string, valid *regexp.Regexp) []string {
+	for _, annotation := range strings.Split(value, ",") {
+		if annotation = strings.TrimSpace(annotation); valid.MatchString(annotation) {
+			annotations = append(annotations, annotation)
+		}
+	}
+	return annotations
+}
@@ -0,0 +1,442 @@
+package pgn
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	tokenEOF = iota
+	tokenTagOpen
+	tokenTagClose
+	tokenString
+	tokenSymbol
+	tokenComment
+	tokenNAG
+	tokenSuffix
+	tokenVariationOpen
+	tokenVariationClose
+)
+
+var (
+	// suffixNAGs are the move suffix annotations and the NAGs they stand for
+	suffixNAGs = map[string]int{"!": 1, "?": 2, "!!": 3, "??": 4, "!?": 5, "?!": 6}
+	commands   = regexp.MustCompile(`\[%(clk|eval|cal|csl)\s+([^\]]*)\]`)
+)
+
+type token struct {
+	kind   int
+	text   string
+	line   int
+	column int
+}
+
+// Reader reads the games of a PGN file one at a time, so files with
+// thousands of games don't need to be held in memory
+type Reader struct {
+	r        *bufio.Reader
+	line     int
+	column   int
+	previous [2]int
+	peeked   *token
+	resync   bool
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r), line: 1, column: 1}
+}
+
+// ReadAll reads every game, stopping at the first error
+func ReadAll(r io.Reader) ([]*Game, error) {
+	var games []*Game
+	reader := NewReader(r)
+	for {
+		g, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return games, nil
+		}
+		if err != nil {
+			return games, err
+		}
+		games = append(games, g)
+	}
+}
+
+// Next returns the next game, or io.EOF when there are no more. After
+// an *Error, calling Next again skips ahead to the following game
+func (r *Reader) Next() (*Game, error) {
+	if r.resync {
+		r.resync = false
+		for {
+			t, err := r.next()
+			if err != nil {
+				return nil, r.fail(err)
+			}
+			if t.kind == tokenEOF || (t.kind == tokenTagOpen && t.column == 1) {
+				r.peeked = &t
+				break
+			}
+		}
+	}
+	t, err := r.peek()
+	if err != nil {
+		return nil, r.fail(err)
+	}
+	if t.kind == tokenEOF {
+		return nil, io.EOF
+	}
+	g := &Game{}
+	if err = r.readTags(g); err != nil {
+		return nil, r.fail(err)
+	}
+	g.Moves, err = r.readMoves(g, false)
+	if err != nil {
+		return nil, r.fail(err)
+	}
+	if g.Result == "" {
+		g.Result, _ = g.Tag("Result")
+	}
+	if g.Result == "" {
+		g.Result = ResultOngoing
+	}
+	return g, nil
+}
+
+func (r *Reader) fail(err error) error {
+	r.resync = true
+	r.peeked = nil
+	return err
+}
+
+func (r *Reader) readTags(g *Game) error {
+	for {
+		t, err := r.peek()
+		if err != nil || t.kind != tokenTagOpen {
+			return err
+		}
+		r.peeked = nil
+		name, err := r.expect(tokenSymbol, "tag name")
+		if err != nil {
+			return err
+		}
+		value, err := r.expect(tokenString, "tag value")
+		if err != nil {
+			return err
+		}
+		if _, err = r.expect(tokenTagClose, "]"); err != nil {
+			return err
+		}
+		g.Tags = append(g.Tags, Tag{Name: name.text, Value: value.text})
+	}
+}
+
+// readMoves reads the moves of the game or, when nested, of a
+// variation up to its closing parenthesis
+func (r *Reader) readMoves(g *Game, nested bool) ([]Move, error) {
+	var moves []Move
+	comment := ""
+	for {
+		t, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		switch t.kind {
+		case tokenComment:
+			if len(moves) > 0 {
+				moves[len(moves)-1].addComment(t.text)
+			} else if nested {
+				comment = strings.TrimSpace(comment + " " + t.text)
+			} else {
+				g.addComment(t.text)
+			}
+		case tokenNAG, tokenSuffix:
+			if len(moves) == 0 {
+				return nil, t.errorf("annotation %s before any move", t.text)
+			}
+			nag, ok := suffixNAGs[t.text]
+			if t.kind == tokenNAG {
+				nag, err = strconv.Atoi(t.text[1:])
+				ok = err == nil && nag < 256
+			}
+			if !ok {
+				return nil, t.errorf("invalid annotation %s", t.text)
+			}
+			moves[len(moves)-1].NAGs = append(moves[len(moves)-1].NAGs, nag)
+		case tokenVariationOpen:
+			if len(moves) == 0 {
+				return nil, t.errorf("variation before any move")
+			}
+			variation, err := r.readMoves(g, true)
+			if err != nil {
+				return nil, err
+			}
+			moves[len(moves)-1].Variations = append(moves[len(moves)-1].Variations, variation)
+		case tokenVariationClose:
+			if !nested {
+				return nil, t.errorf("unexpected )")
+			}
+			return moves, nil
+		case tokenEOF, tokenTagOpen:
+			if nested {
+				return nil, t.errorf("unterminated variation")
+			}
+			r.peeked = &t
+			return moves, nil
+		case tokenSymbol:
+			switch {
+			case isResult(t.text):
+				if nested {
+					return nil, t.errorf("result %s inside a variation", t.text)
+				}
+				g.Result = t.text
+				return moves, nil
+			case isMoveNumber(t.text):
+				continue
+			}
+			moves = append(moves, Move{SAN: t.text, Line: t.line, Column: t.column})
+			if comment != "" {
+				moves[len(moves)-1].addComment(comment)
+				comment = ""
+			}
+		default:
+			return nil, t.errorf("unexpected %q", t.text)
+		}
+	}
+}
+
+// addComment adds the comment to the move, taking the clock, eval and
+// annotation commands out of it
+func (m *Move) addComment(text string) {
+	for _, command := range commands.FindAllStringSubmatch(text, -1) {
+		switch command[1] {
+		case "clk":
+			if clock, ok := parseClock(strings.TrimSpace(command[2])); ok {
+				m.Clock = clock
+			}
+		case "eval":
+			m.Eval = strings.TrimSpace(command[2])
+		default:
+			m.addCommand(command[1], command[2])
+		}
+	}
+	m.Comment = strings.TrimSpace(m.Comment + " " + stripCommands(text))
+}
+
+// addComment adds a comment before the first move to the game, taking
+// the annotations of the starting position out of it
+func (g *Game) addComment(text string) {
+	for _, command := range commands.FindAllStringSubmatch(text, -1) {
+		g.addCommand(command[1], command[2])
+	}
+	g.Comment = strings.TrimSpace(g.Comment + " " + stripCommands(text))
+}
+
+func stripCommands(text string) string {
+	return strings.Join(strings.Fields(commands.ReplaceAllString(text, "")), " ")
+}
+
+// parseClock parses a clock in the h:mm:ss form of the [%clk] command
+func parseClock(text string) (time.Duration, bool) {
+	parts := strings.Split(text, ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+	hours, err1 := strconv.Atoi(parts[0])
+	minutes, err2 := strconv.Atoi(parts[1])
+	seconds, err3 := strconv.ParseFloat(parts[2], 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return 0, false
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute +
+		time.Duration(seconds*float64(time.Second)), true
+}
+
+func isResult(text string) bool {
+	return text == ResultWhiteWins || text == ResultBlackWins || text == ResultDraw || text == ResultOngoing
+}
+
+func isMoveNumber(text string) bool {
+	for _, r := range text {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Reader) expect(kind int, what string) (token, error) {
+	t, err := r.next()
+	if err == nil && t.kind != kind {
+		err = t.errorf("expected %s, found %q", what, t.text)
+	}
+	return t, err
+}
+
+func (r *Reader) peek() (token, error) {
+	if r.peeked == nil {
+		t, err := r.next()
+		if err != nil {
+			return t, err
+		}
+		r.peeked = &t
+	}
+	return *r.peeked, nil
+}
+
+// next returns the next token, skipping white space, periods and
+// lines escaped with a % in the first column
+func (r *Reader) next() (token, error) {
+	if r.peeked != nil {
+		t := *r.peeked
+		r.peeked = nil
+		return t, nil
+	}
+	for {
+		t := token{line: r.line, column: r.column}
+		c, err := r.read()
+		if errors.Is(err, io.EOF) {
+			return t, nil
+		}
+		if err != nil {
+			return t, err
+		}
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '.':
+			continue
+		case c == '%' && t.column == 1, c == ';':
+			text, err := r.readUntil('\n', false)
+			if c == '%' || err != nil {
+				if err != nil && !errors.Is(err, io.EOF) {
+					return t, err
+				}
+				continue
+			}
+			t.kind, t.text = tokenComment, text
+		case c == '{':
+			text, err := r.readUntil('}', true)
+			if err != nil {
+				return t, t.errorf("unterminated comment")
+			}
+			t.kind, t.text = tokenComment, text
+		case c == '"':
+			text, err := r.readString()
+			if err != nil {
+				return t, t.errorf("unterminated string")
+			}
+			t.kind, t.text = tokenString, text
+		case c == '[':
+			t.kind, t.text = tokenTagOpen, "["
+		case c == ']':
+			t.kind, t.text = tokenTagClose, "]"
+		case c == '(':
+			t.kind, t.text = tokenVariationOpen, "("
+		case c == ')':
+			t.kind, t.text = tokenVariationClose, ")"
+		case c == '*':
+			t.kind, t.text = tokenSymbol, "*"
+		case c == '$':
+			t.kind, t.text = tokenNAG, "$"+r.readWhile(isDigit)
+		case c == '!' || c == '?':
+			t.kind, t.text = tokenSuffix, string(c)+r.readWhile(func(c rune) bool { return c == '!' || c == '?' })
+		case isSymbolStart(c):
+			t.kind, t.text = tokenSymbol, string(c)+r.readWhile(isSymbol)
+		default:
+			return t, t.errorf("unexpected character %q", c)
+		}
+		return t, nil
+	}
+}
+
+func (r *Reader) read() (rune, error) {
+	c, _, err := r.r.ReadRune()
+	if err != nil {
+		return c, err
+	}
+	r.previous = [2]int{r.line, r.column}
+	if c == '\n' {
+		r.line++
+		r.column = 1
+	} else {
+		r.column++
+	}
+	return c, nil
+}
+
+func (r *Reader) unread() {
+	_ = r.r.UnreadRune()
+	r.line, r.column = r.previous[0], r.previous[1]
+}
+
+func (r *Reader) readWhile(accept func(rune) bool) string {
+	var sb strings.Builder
+	for {
+		c, err := r.read()
+		if err != nil {
+			return sb.String()
+		}
+		if !accept(c) {
+			r.unread()
+			return sb.String()
+		}
+		sb.WriteRune(c)
+	}
+}
+
+// readUntil reads up to the delimiter, returning io.EOF if the reader
+// runs out first and the delimiter is required
+func (r *Reader) readUntil(delimiter rune, required bool) (string, error) {
+	var sb strings.Builder
+	for {
+		c, err := r.read()
+		if err != nil {
+			if errors.Is(err, io.EOF) && !required {
+				return sb.String(), nil
+			}
+			return sb.String(), err
+		}
+		if c == delimiter {
+			return sb.String(), nil
+		}
+		sb.WriteRune(c)
+	}
+}
+
+func (r *Reader) readString() (string, error) {
+	var sb strings.Builder
+	for {
+		c, err := r.read()
+		if err != nil || c == '\n' {
+			return sb.String(), io.ErrUnexpectedEOF
+		}
+		switch c {
+		case '"':
+			return sb.String(), nil
+		case '\\':
+			if c, err = r.read(); err != nil {
+				return sb.String(), err
+			}
+		}
+		sb.WriteRune(c)
+	}
+}
+
+func (t token) errorf(format string, args ...any) error {
+	return Move{Line: t.line, Column: t.column}.Errorf(format, args...)
+}
+
+func isDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isSymbolStart(c rune) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isSymbol(c rune) bool {
+	return isSymbolStart(c) || strings.ContainsRune("_+#=:-/", c)
+}
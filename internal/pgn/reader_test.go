@@ -0,0 +1,174 @@
+package pgn
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	twoGames = `[Event "Training"]
+[White "Anderssen, Adolf"]
+[Black "Kieseritzky, \"Lionel\""]
+[Result "1-0"]
+
+{The Immortal Game} 1. e4 e5 2. f4 exf4 3. Bc4 Qh4+ $6 4. Kf1 b5!? (4... Nf6
+{is safer} 5. Nc3 (5. d3) 5... c6) 5. Bxb5 ; Black loses a pawn
+Nf6 6. Nf3 {[%clk 0:01:30] [%eval 0.5] [%cal Gf3g5, Rd8d1,Xa1a2] developing} Qh6 1-0
+
+% an escaped line
+[Event "Second"]
+
+{[%csl Gd4]} 1. d4 d5 *
+`
+)
+
+func TestReader(t *testing.T) {
+	games, err := ReadAll(strings.NewReader(twoGames))
+	require.NoError(t, err)
+	require.Len(t, games, 2)
+
+	g := games[0]
+	assert.Equal(t, "1-0", g.Result)
+	assert.Equal(t, "The Immortal Game", g.Comment)
+	black, _ := g.Tag("Black")
+	assert.Equal(t, `Kieseritzky, "Lionel"`, black)
+	var sans []string
+	for _, move := range g.Moves {
+		sans = append(sans, move.SAN)
+	}
+	assert.Equal(t, []string{"e4", "e5", "f4", "exf4", "Bc4", "Qh4+", "Kf1", "b5", "Bxb5", "Nf6", "Nf3", "Qh6"}, sans)
+	assert.Equal(t, []int{6}, g.Moves[5].NAGs)
+	assert.Equal(t, []int{5}, g.Moves[7].NAGs)
+	assert.Equal(t, 6, g.Moves[7].Line)
+	assert.Equal(t, 63, g.Moves[7].Column)
+	require.Len(t, g.Moves[7].Variations, 1)
+	variation := g.Moves[7].Variations[0]
+	require.Len(t, variation, 3)
+	assert.Equal(t, "Nf6", variation[0].SAN)
+	assert.Equal(t, "is safer", variation[0].Comment)
+	assert.Equal(t, [][]Move{{{SAN: "d3", Line: 7, Column: 23}}}, variation[1].Variations)
+	assert.Equal(t, "Black loses a pawn", g.Moves[8].Comment)
+	assert.Equal(t, 90*time.Second, g.Moves[10].Clock)
+	assert.Equal(t, "0.5", g.Moves[10].Eval)
+	assert.Equal(t, "developing", g.Moves[10].Comment)
+	assert.Equal(t, []string{"Gf3g5", "Rd8d1"}, g.Moves[10].Arrows)
+
+	g = games[1]
+	assert.Equal(t, "*", g.Result)
+	assert.Len(t, g.Moves, 2)
+	assert.Empty(t, g.Comment)
+	assert.Equal(t, []string{"Gd4"}, g.Circles)
+}
+
+func TestReader_Errors(t *testing.T) {
+	tests := map[string]struct {
+		pgn     string
+		message string
+	}{
+		"unterminated variation": {
+			pgn:     "1. e4 (1. d4 d5 *",
+			message: "line 1, column 17: result * inside a variation",
+		},
+		"unexpected close": {
+			pgn:     "1. e4 e5)\n",
+			message: "line 1, column 9: unexpected )",
+		},
+		"unterminated comment": {
+			pgn:     "1. e4 {never\nends",
+			message: "line 1, column 7: unterminated comment",
+		},
+		"bad tag": {
+			pgn:     "[Event Casual]\n1. e4 *",
+			message: `line 1, column 8: expected tag value, found "Casual"`,
+		},
+		"annotation first": {
+			pgn:     "$1 e4 *",
+			message: "line 1, column 1: annotation $1 before any move",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			_, err := NewReader(strings.NewReader(test.pgn)).Next()
+			var pgnErr *Error
+			require.True(tt, errors.As(err, &pgnErr), "expected a pgn error, got %v", err)
+			assert.Equal(tt, test.message, err.Error())
+		})
+	}
+}
+
+func TestReader_SkipsBadGames(t *testing.T) {
+	r := NewReader(strings.NewReader("[Event \"Bad\"]\n1. e4 ) e5 *\n\n[Event \"Good\"]\n1. e4 *\n"))
+	_, err := r.Next()
+	assert.Error(t, err)
+	g, err := r.Next()
+	require.NoError(t, err)
+	event, _ := g.Tag("Event")
+	assert.Equal(t, "Good", event)
+	_, err = r.Next()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestParseEval(t *testing.T) {
+	tests := map[string]struct {
+		eval  string
+		score int
+		mate  bool
+		ok    bool
+	}{
+		"pawns":      {eval: "0.50", score: 50, ok: true},
+		"negative":   {eval: "-1.27", score: -127, ok: true},
+		"no decimal": {eval: "3", score: 300, ok: true},
+		"mate":       {eval: "#4", score: 4, mate: true, ok: true},
+		"mated":      {eval: "#-2", score: -2, mate: true, ok: true},
+		"empty":      {eval: ""},
+		"garbage":    {eval: "#x"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			score, mate, ok := ParseEval(test.eval)
+			assert.Equal(tt, test.ok, ok)
+			if test.ok {
+				assert.Equal(tt, test.score, score)
+				assert.Equal(tt, test.mate, mate)
+			}
+		})
+	}
+}
+
+func TestReader_RoundTrip(t *testing.T) {
+	games, err := ReadAll(strings.NewReader(twoGames))
+	require.NoError(t, err)
+	var sb strings.Builder
+	for _, g := range games {
+		require.NoError(t, Write(&sb, g))
+	}
+	again, err := ReadAll(strings.NewReader(sb.String()))
+	require.NoError(t, err)
+	require.Len(t, again, len(games))
+	for i := range games {
+		assert.Equal(t, stripPlaces(games[i].Moves), stripPlaces(again[i].Moves))
+		assert.Equal(t, games[i].Comment, again[i].Comment)
+		assert.Equal(t, games[i].Annotations, again[i].Annotations)
+		assert.Equal(t, games[i].Result, again[i].Result)
+	}
+}
+
+// stripPlaces clears where the moves were read, which changes when
+// they are written out again
+func stripPlaces(moves []Move) []Move {
+	stripped := make([]Move, len(moves))
+	for i, move := range moves {
+		move.Line, move.Column = 0, 0
+		move.Variations = nil
+		for _, variation := range moves[i].Variations {
+			move.Variations = append(move.Variations, stripPlaces(variation))
+		}
+		stripped[i] = move
+	}
+	return stripped
+}
@@ -0,0 +1,117 @@
+package pgn
+
+import (
+	"bufio"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	lineLength = 80
+)
+
+// Write writes the game in PGN export format: the seven tag roster
+// first, with "?" for any that are missing, then the other tags and
+// the movetext wrapped at 80 columns
+func Write(w io.Writer, g *Game) error {
+	bw := bufio.NewWriter(w)
+	result := g.Result
+	if result == "" {
+		result = ResultOngoing
+	}
+	for _, name := range sevenTagRoster {
+		value, ok := g.Tag(name)
+		switch {
+		case name == "Result":
+			value = result
+		case !ok && name == "Date":
+			value = "????.??.??"
+		case !ok:
+			value = "?"
+		}
+		writeTag(bw, name, value)
+	}
+	for _, tag := range g.Tags {
+		if !slices.Contains(sevenTagRoster, tag.Name) {
+			writeTag(bw, tag.Name, tag.Value)
+		}
+	}
+	_, _ = bw.WriteString("\n")
+
+	column := 0
+	for _, token := range g.movetext(result) {
+		if column > 0 && column+1+len(token) > lineLength {
+			_, _ = bw.WriteString("\n")
+			column = 0
+		} else if column > 0 {
+			_, _ = bw.WriteString(" ")
+			column++
+		}
+		_, _ = bw.WriteString(token)
+		column += len(token)
+	}
+	_, _ = bw.WriteString("\n\n")
+	return bw.Flush()
+}
+
+func writeTag(w *bufio.Writer, name, value string) {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	_, _ = w.WriteString("[" + name + " \"" + value + "\"]\n")
+}
+
+// movetext returns the words of the movetext, splitting comments into
+// words so that they wrap along with the moves
+func (g *Game) movetext(result string) []string {
+	tokens := appendComment(nil, g.comment())
+	number, black := g.startingMove()
+	tokens = appendLine(tokens, g.Moves, number, black)
+	return append(tokens, result)
+}
+
+func appendLine(tokens []string, moves []Move, number int, black bool) []string {
+	numbered := false
+	for _, move := range moves {
+		if !black {
+			tokens = append(tokens, strconv.Itoa(number)+".")
+		} else if !numbered {
+			tokens = append(tokens, strconv.Itoa(number)+"...")
+		}
+		tokens = append(tokens, move.SAN)
+		for _, nag := range move.NAGs {
+			tokens = append(tokens, "$"+strconv.Itoa(nag))
+		}
+		numbered = true
+		if comment := move.comment(); comment != "" {
+			tokens = appendComment(tokens, comment)
+			numbered = false
+		}
+		for _, variation := range move.Variations {
+			words := appendLine(nil, variation, number, black)
+			if len(words) == 0 {
+				continue
+			}
+			words[0] = "(" + words[0]
+			words[len(words)-1] += ")"
+			tokens = append(tokens, words...)
+			numbered = false
+		}
+		if black {
+			number++
+		}
+		black = !black
+	}
+	return tokens
+}
+
+func appendComment(tokens []string, comment string) []string {
+	words := strings.Fields(comment)
+	if len(words) == 0 {
+		return tokens
+	}
+	words[0] = "{" + words[0]
+	words[len(words)-1] += "}"
+	return append(tokens, words...)
+}
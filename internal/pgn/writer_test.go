@@ -0,0 +1,141 @@
+package pgn
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	tests := map[string]struct {
+		game     Game
+		expected string
+	}{
+		"empty game": {
+			game: Game{},
+			expected: `[Event "?"]
+[Site "?"]
+[Date "????.??.??"]
+[Round "?"]
+[White "?"]
+[Black "?"]
+[Result "*"]
+
+*
+
+`,
+		},
+		"tags and result": {
+			game: Game{
+				Tags: []Tag{
+					{Name: "WhiteElo", Value: "800"},
+					{Name: "White", Value: `Jason "JF" Figge`},
+					{Name: "Black", Value: "Stockfish 17"},
+					{Name: "Event", Value: "Casual"},
+				},
+				Moves:  []Move{{SAN: "f3"}, {SAN: "e5"}, {SAN: "g4"}, {SAN: "Qh4#"}},
+				Result: ResultBlackWins,
+			},
+			expected: `[Event "Casual"]
+[Site "?"]
+[Date "????.??.??"]
+[Round "?"]
+[White "Jason \"JF\" Figge"]
+[Black "Stockfish 17"]
+[Result "0-1"]
+[WhiteElo "800"]
+
+1. f3 e5 2. g4 Qh4# 0-1
+
+`,
+		},
+		"custom start with black to move": {
+			game: Game{
+				Tags: []Tag{
+					{Name: "SetUp", Value: "1"},
+					{Name: "FEN", Value: "4k3/8/8/8/8/8/4P3/4K3 b - - 0 12"},
+				},
+				Moves: []Move{{SAN: "Kd7"}, {SAN: "e4"}, {SAN: "Ke6"}},
+			},
+			expected: `[Event "?"]
+[Site "?"]
+[Date "????.??.??"]
+[Round "?"]
+[White "?"]
+[Black "?"]
+[Result "*"]
+[SetUp "1"]
+[FEN "4k3/8/8/8/8/8/4P3/4K3 b - - 0 12"]
+
+12... Kd7 13. e4 Ke6 *
+
+`,
+		},
+		"clock and eval comments": {
+			game: Game{
+				Moves: []Move{
+					{SAN: "e4", Clock: 299 * time.Second, Eval: FormatEval(35, false)},
+					{SAN: "e5", Clock: time.Hour + 61*time.Second, Comment: "book {sort of}"},
+					{SAN: "Qh5"},
+					{SAN: "Nc6", Eval: FormatEval(-2, true)},
+				},
+			},
+			expected: `[Event "?"]
+[Site "?"]
+[Date "????.??.??"]
+[Round "?"]
+[White "?"]
+[Black "?"]
+[Result "*"]
+
+1. e4 {[%clk 0:04:59] [%eval 0.35]} 1... e5 {[%clk 1:01:01] book {sort of)} 2.
+Qh5 Nc6 {[%eval #-2]} *
+
+`,
+		},
+		"annotation commands": {
+			game: Game{
+				Comment:     "start",
+				Annotations: Annotations{Circles: []string{"Ge4", "Rd5"}},
+				Moves: []Move{
+					{SAN: "e4", Annotations: Annotations{Arrows: []string{"Gg1f3", "Bf1c4"}}},
+					{SAN: "e5", Comment: "symmetry", Annotations: Annotations{Arrows: []string{"Ye5e4"}, Circles: []string{"Re4"}}},
+				},
+			},
+			expected: `[Event "?"]
+[Site "?"]
+[Date "????.??.??"]
+[Round "?"]
+[White "?"]
+[Black "?"]
+[Result "*"]
+
+{[%csl Ge4,Rd5] start} 1. e4 {[%cal Gg1f3,Bf1c4]} 1... e5 {[%csl Re4] [%cal
+Ye5e4] symmetry} *
+
+`,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			var sb strings.Builder
+			require.NoError(tt, Write(&sb, &test.game))
+			assert.Equal(tt, test.expected, sb.String())
+		})
+	}
+}
+
+func TestWrite_Wraps(t *testing.T) {
+	game := Game{}
+	for range 40 {
+		game.Moves = append(game.Moves, Move{SAN: "Nf3"}, Move{SAN: "Nf6"}, Move{SAN: "Ng1"}, Move{SAN: "Ng8"})
+	}
+	var sb strings.Builder
+	require.NoError(t, Write(&sb, &game))
+	for _, line := range strings.Split(sb.String(), "\n") {
+		assert.LessOrEqual(t, len(line), lineLength)
+	}
+	assert.Contains(t, sb.String(), "80. Ng1 Ng8 *\n")
+}
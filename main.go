@@ -1,11 +1,20 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/hajimehoshi/ebiten/v2"
+	"io"
 	"log"
 	"os"
+	"time"
+	"us.figge.chess/internal/engine"
+	"us.figge.chess/internal/engine/uci"
+	"us.figge.chess/internal/epd"
 	"us.figge.chess/internal/game"
+	"us.figge.chess/internal/game/clock"
+	"us.figge.chess/internal/pgn"
 )
 
 var (
@@ -17,7 +26,20 @@ var (
 )
 
 func main() {
-	if len(os.Args) > 1 && os.Args[1] == "--version" {
+	version := flag.Bool("version", false, "print version information and exit")
+	enginePath := flag.String("engine", "", "`path` to the engine executable")
+	protocol := flag.String("protocol", engine.ProtocolUCI, "protocol spoken by the engine, uci or xboard")
+	transcript := flag.String("transcript", "", "record every line exchanged with the engine to `file`")
+	white := flag.String("white", engine.KindHuman, "white `player`: human, engine, random or script:<moves>")
+	black := flag.String("black", engine.KindEngine, "black `player`: human, engine, random or script:<moves>")
+	pgnDir := flag.String("pgn", ".", "`directory` games are saved to, with S or when the game ends")
+	load := flag.String("load", "", "load a game from a PGN `file` to step through with the arrow keys")
+	gameNumber := flag.Int("game", 1, "`number` of the game to load from the PGN file")
+	timeControl := flag.String("clock", "", "time `control` to play with, e.g. 5+3, 40/90:30+30 or 15d10")
+	replay := flag.String("replay", "", "replay a recorded engine transcript `file` and print the searches")
+	flag.Parse()
+
+	if *version {
 		fmt.Printf("Lutefisk Chess Engine 2.0 - by Jason Figge\n")
 		fmt.Printf("  Git source: %s\n", GitSource)
 		fmt.Printf("  Git commit: %s\n", GitCommit)
@@ -26,7 +48,48 @@ func main() {
 		fmt.Printf("  Built:      %s\n\n", Built)
 		return
 	}
-	g := game.NewGame()
+	if *replay != "" {
+		replayTranscript(*replay)
+		return
+	}
+
+	if *protocol != engine.ProtocolUCI && *protocol != engine.ProtocolXBoard {
+		log.Fatalf("Unknown protocol %q, expected %s or %s\n", *protocol, engine.ProtocolUCI, engine.ProtocolXBoard)
+	}
+	engineOptions := []engine.Option{
+		engine.OptProtocol(*protocol),
+		engine.OptPlayers(*white, *black),
+	}
+	if *enginePath != "" {
+		engineOptions = append(engineOptions, engine.OptEnginePath(*enginePath))
+	}
+	if *timeControl != "" {
+		control, err := clock.Parse(*timeControl)
+		if err != nil {
+			log.Fatalf("Invalid time control: %v\n", err)
+		}
+		engineOptions = append(engineOptions, engine.OptClock(control))
+	}
+	if *transcript != "" {
+		f, err := os.Create(*transcript)
+		if err != nil {
+			log.Fatalf("Failed to create transcript: %v\n", err)
+		}
+		defer func() { _ = f.Close() }()
+		engineOptions = append(engineOptions, engine.OptTranscript(f))
+	}
+	if flag.Arg(0) == "epd" {
+		runEPD(flag.Args()[1:], engineOptions)
+		return
+	}
+	g := game.NewGame(*pgnDir, engineOptions...)
+	if *load != "" {
+		pg, err := readGame(*load, *gameNumber)
+		if err != nil {
+			log.Fatalf("Failed to load game: %v\n", err)
+		}
+		g.LoadGame(pg)
+	}
 	ebiten.SetWindowTitle("Lutefisk Chess Engine 2.0")
 	err := ebiten.RunGame(g)
 	if err != nil {
@@ -34,3 +97,72 @@ func main() {
 	}
 	fmt.Println("Game: Done")
 }
+
+// runEPD runs the configured engine on each position of an EPD test
+// suite: lutefisk [options] epd <file> [--movetime 1s] [--depth n]
+func runEPD(args []string, engineOptions []engine.Option) {
+	flags := flag.NewFlagSet("epd", flag.ExitOnError)
+	movetime := flags.Duration("movetime", time.Second, "time the engine has for each position")
+	depth := flags.Int("depth", 0, "depth to search each position to, unless it has an acd opcode")
+	_ = flags.Parse(args)
+	if flags.NArg() == 0 {
+		log.Fatalf("Usage: lutefisk [options] epd <file> [--movetime 1s] [--depth n]\n")
+	}
+	path := flags.Arg(0)
+	_ = flags.Parse(flags.Args()[1:])
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("Failed to open EPD file: %v\n", err)
+	}
+	records, err := epd.Parse(f)
+	_ = f.Close()
+	if err != nil {
+		log.Fatalf("Failed to read EPD file: %v\n", err)
+	}
+
+	e := engine.NewEngine(append(engineOptions, engine.OptPlayers(engine.KindHuman, engine.KindHuman))...)
+	defer e.Close()
+	summary := epd.Run(e, records, *depth, *movetime, func(result epd.Result) {
+		epd.Print(os.Stdout, result)
+	})
+	fmt.Println(summary)
+}
+
+func replayTranscript(path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("Failed to open transcript: %v\n", err)
+	}
+	defer func() { _ = f.Close() }()
+	searches, err := uci.Replay(f, uci.IncludeLowerbounds|uci.IncludeUpperbounds)
+	for i, search := range searches {
+		fmt.Printf("Search %d: %s\n%s", i+1, search.Command, search.Results)
+	}
+	if err != nil {
+		log.Fatalf("Failed to replay transcript: %v\n", err)
+	}
+}
+
+// readGame reads the numbered game from a PGN file, reading only as
+// far into the file as it needs to
+func readGame(path string, number int) (*pgn.Game, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	r := pgn.NewReader(f)
+	for i := 1; ; i++ {
+		g, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s has only %d games", path, i-1)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("game %d: %w", i, err)
+		}
+		if i == number {
+			return g, nil
+		}
+	}
+}